@@ -96,7 +96,7 @@ func runCmd(ctx *cli.Context) error {
 	}
 	if ctx.GlobalString(GenesisFlag.Name) != "" {
 		gen := readGenesis(ctx.GlobalString(GenesisFlag.Name))
-		_, statedb = gen.ToBlock()
+		_, statedb = gen.ToBlock(nil)
 		chainConfig = gen.Config
 	} else {
 		db, _ := ethdb.NewMemDatabase()
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"sync/atomic"
@@ -35,8 +36,8 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/trie"
-	"github.com/syndtr/goleveldb/leveldb/util"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -48,6 +49,7 @@ var (
 		ArgsUsage: "<genesisPath>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
 			utils.LightModeFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
@@ -65,8 +67,13 @@ It expects the genesis file as argument.`,
 		ArgsUsage: "<filename> (<filename 2> ... <filename N>) ",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.LightModeFlag,
+			utils.GCModeFlag,
+			utils.SnapshotFlag,
+			utils.TxLookupLimitFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -83,6 +90,8 @@ processing will proceed even if an individual RLP-file import failure occurs.`,
 		ArgsUsage: "<filename> [<blockNumFirst> <blockNumLast>]",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.LightModeFlag,
 		},
@@ -92,6 +101,46 @@ Requires a first argument of the file to write to.
 Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
 if already existing.`,
+	}
+	exportStateCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportState),
+		Name:      "export-state",
+		Usage:     "Export the state of a block into file",
+		ArgsUsage: "<filename> [<blockHash> | <blockNum>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
+			utils.CacheFlag,
+			utils.TestnetFlag,
+			utils.RinkebyFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+Requires a first argument of the file to write to, compressed if it ends in .gz.
+The optional second argument selects the block whose state to export, defaulting
+to the current head block.
+
+The state is streamed in a chunked binary format containing all accounts, storage
+slots and contract codes, along with the state root for verification on import.`,
+	}
+	importStateCommand = cli.Command{
+		Action:    utils.MigrateFlags(importState),
+		Name:      "import-state",
+		Usage:     "Import a state export file",
+		ArgsUsage: "<filename>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
+			utils.CacheFlag,
+			utils.TestnetFlag,
+			utils.RinkebyFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The import-state command rebuilds the state tries from a file created by
+export-state and verifies that they match the state root recorded in it.`,
 	}
 	copydbCommand = cli.Command{
 		Action:    utils.MigrateFlags(copyDb),
@@ -100,6 +149,8 @@ if already existing.`,
 		ArgsUsage: "<sourceChaindataDir>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.SyncModeFlag,
 			utils.FakePoWFlag,
@@ -117,11 +168,22 @@ The first argument must be the directory containing the blockchain to download f
 		ArgsUsage: " ",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.LightModeFlag,
+			utils.CacheFlag,
+			utils.PruneStateFlag,
+			utils.PruneRetainFlag,
+			utils.PruneDryRunFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
-Remove blockchain and state databases`,
+Remove blockchain and state databases.
+
+With --prune-state, only the state trie nodes and contract codes not reachable
+from the --prune.retain most recent block states are removed from the chain
+database, keeping the node usable. Use --prune.dryrun to only report how much
+would be removed. An interrupted pruning is resumed on the next invocation.`,
 	}
 	dumpCommand = cli.Command{
 		Action:    utils.MigrateFlags(dump),
@@ -130,6 +192,8 @@ Remove blockchain and state databases`,
 		ArgsUsage: "[<blockHash> | <blockNum>]...",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.CacheFlag,
 			utils.LightModeFlag,
 		},
@@ -211,17 +275,18 @@ func importChain(ctx *cli.Context) error {
 			}
 		}
 	}
-
+	chain.Stop()
 	fmt.Printf("Import done in %v.\n\n", time.Since(start))
 
 	// Output pre-compaction stats mostly to see the import trashing
-	db := chainDb.(*ethdb.LDBDatabase)
-
-	stats, err := db.LDB().GetProperty("leveldb.stats")
-	if err != nil {
-		utils.Fatalf("Failed to read database stats: %v", err)
+	db, isLDB := ethdb.KeyValueStore(chainDb).(*ethdb.LDBDatabase)
+	if isLDB {
+		stats, err := db.LDB().GetProperty("leveldb.stats")
+		if err != nil {
+			utils.Fatalf("Failed to read database stats: %v", err)
+		}
+		fmt.Println(stats)
 	}
-	fmt.Println(stats)
 	fmt.Printf("Trie cache misses:  %d\n", trie.CacheMisses())
 	fmt.Printf("Trie cache unloads: %d\n\n", trie.CacheUnloads())
 
@@ -241,17 +306,18 @@ func importChain(ctx *cli.Context) error {
 	// Compact the entire database to more accurately measure disk io and print the stats
 	start = time.Now()
 	fmt.Println("Compacting entire database...")
-	if err = db.LDB().CompactRange(util.Range{}); err != nil {
+	if err := chainDb.Compact(nil, nil); err != nil {
 		utils.Fatalf("Compaction failed: %v", err)
 	}
 	fmt.Printf("Compaction done in %v.\n\n", time.Since(start))
 
-	stats, err = db.LDB().GetProperty("leveldb.stats")
-	if err != nil {
-		utils.Fatalf("Failed to read database stats: %v", err)
+	if isLDB {
+		stats, err := db.LDB().GetProperty("leveldb.stats")
+		if err != nil {
+			utils.Fatalf("Failed to read database stats: %v", err)
+		}
+		fmt.Println(stats)
 	}
-	fmt.Println(stats)
-
 	return nil
 }
 
@@ -287,6 +353,55 @@ func exportChain(ctx *cli.Context) error {
 	return nil
 }
 
+func exportState(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack := makeFullNode(ctx)
+	chain, chainDb := utils.MakeChain(ctx, stack)
+	defer chainDb.Close()
+
+	block := chain.CurrentBlock()
+	if len(ctx.Args()) > 1 {
+		arg := ctx.Args().Get(1)
+		if hashish(arg) {
+			block = chain.GetBlockByHash(common.HexToHash(arg))
+		} else {
+			num, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				utils.Fatalf("Invalid block number %q: %v", arg, err)
+			}
+			block = chain.GetBlockByNumber(num)
+		}
+		if block == nil {
+			utils.Fatalf("Block %s not found", arg)
+		}
+	}
+	start := time.Now()
+	if err := utils.ExportState(state.NewDatabase(chainDb), block.Root(), ctx.Args().First()); err != nil {
+		utils.Fatalf("Export error: %v", err)
+	}
+	fmt.Printf("Exported state of block #%d [%x…] in %v\n", block.NumberU64(), block.Hash().Bytes()[:4], time.Since(start))
+	return nil
+}
+
+func importState(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack := makeFullNode(ctx)
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	start := time.Now()
+	root, err := utils.ImportState(chainDb, ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Import error: %v", err)
+	}
+	fmt.Printf("Imported state %x in %v\n", root, time.Since(start))
+	return nil
+}
+
 func copyDb(ctx *cli.Context) error {
 	// Ensure we have a source chain directory to copy
 	if len(ctx.Args()) != 1 {
@@ -300,7 +415,7 @@ func copyDb(ctx *cli.Context) error {
 	dl := downloader.New(syncmode, chainDb, new(event.TypeMux), chain, nil, nil)
 
 	// Create a source peer to satisfy downloader requests from
-	db, err := ethdb.NewLDBDatabase(ctx.Args().First(), ctx.GlobalInt(utils.CacheFlag.Name), 256)
+	db, err := ethdb.Open("", ctx.Args().First(), ctx.GlobalInt(utils.CacheFlag.Name), 256)
 	if err != nil {
 		return err
 	}
@@ -327,7 +442,7 @@ func copyDb(ctx *cli.Context) error {
 	// Compact the entire database to remove any sync overhead
 	start = time.Now()
 	fmt.Println("Compacting entire database...")
-	if err = chainDb.(*ethdb.LDBDatabase).LDB().CompactRange(util.Range{}); err != nil {
+	if err = chainDb.Compact(nil, nil); err != nil {
 		utils.Fatalf("Compaction failed: %v", err)
 	}
 	fmt.Printf("Compaction done in %v.\n\n", time.Since(start))
@@ -338,11 +453,25 @@ func copyDb(ctx *cli.Context) error {
 func removeDB(ctx *cli.Context) error {
 	stack, _ := makeConfigNode(ctx)
 
-	for _, name := range []string{"chaindata", "lightchaindata"} {
+	if ctx.Bool(utils.PruneStateFlag.Name) {
+		return pruneState(ctx, stack)
+	}
+	dbdirs := map[string]string{
+		"chaindata":      stack.ResolvePath("chaindata"),
+		"lightchaindata": stack.ResolvePath("lightchaindata"),
+	}
+	// Ancient chain segments outside of the chain database are removed separately
+	if ancient := ctx.GlobalString(utils.AncientFlag.Name); ancient != "" {
+		dbdirs["ancient"] = stack.ResolvePath(ancient)
+	}
+	for _, name := range []string{"chaindata", "lightchaindata", "ancient"} {
+		dbdir, ok := dbdirs[name]
+		if !ok {
+			continue
+		}
 		// Ensure the database exists in the first place
 		logger := log.New("database", name)
 
-		dbdir := stack.ResolvePath(name)
 		if !common.FileExist(dbdir) {
 			logger.Info("Database doesn't exist, skipping", "path", dbdir)
 			continue
@@ -364,6 +493,103 @@ func removeDB(ctx *cli.Context) error {
 	return nil
 }
 
+// pruneState removes all the state trie nodes and contract codes from the chain
+// database which are not reachable from the most recent block states.
+func pruneState(ctx *cli.Context, stack *node.Node) error {
+	if ctx.GlobalBool(utils.LightModeFlag.Name) {
+		utils.Fatalf("Light client databases have no state to prune")
+	}
+	dryrun := ctx.Bool(utils.PruneDryRunFlag.Name)
+
+	dbdir := stack.ResolvePath("chaindata")
+	if !common.FileExist(dbdir) {
+		utils.Fatalf("Database doesn't exist: %s", dbdir)
+	}
+	if !dryrun {
+		fmt.Println(dbdir)
+		confirm, err := console.Stdin.PromptConfirm("Prune unreachable state from this database?")
+		if err != nil {
+			utils.Fatalf("%v", err)
+		}
+		if !confirm {
+			log.Warn("State pruning aborted")
+			return nil
+		}
+	}
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	db := ethdb.KeyValueStore(chainDb)
+
+	// Gather the state roots of the most recent blocks to retain
+	head := core.GetHeadBlockHash(db)
+	if head == (common.Hash{}) {
+		utils.Fatalf("Database has no head block")
+	}
+	var (
+		number = core.GetBlockNumber(db, head)
+		retain = ctx.Uint64(utils.PruneRetainFlag.Name)
+		roots  []common.Hash
+	)
+	for i := uint64(0); i < retain && i <= number; i++ {
+		hash := core.GetCanonicalHash(db, number-i)
+		if header := core.GetHeader(db, hash, number-i); header != nil {
+			roots = append(roots, header.Root)
+		}
+	}
+	// Track the reachable set on disk so an interrupted pruning can be resumed,
+	// dry runs don't modify anything so they can keep it in memory
+	var (
+		marks    ethdb.Database
+		marksdir = stack.ResolvePath("prunemarks")
+	)
+	if dryrun {
+		marks, _ = ethdb.NewMemDatabase()
+	} else {
+		ldb, err := ethdb.NewLDBDatabase(marksdir, 16, 16)
+		if err != nil {
+			utils.Fatalf("Failed to open pruning marker database: %v", err)
+		}
+		marks = ldb
+	}
+	before := dirSize(dbdir)
+	stats, err := state.NewPruner(db, marks, dryrun).Prune(roots)
+	marks.Close()
+	if err != nil {
+		utils.Fatalf("State pruning failed: %v", err)
+	}
+	if dryrun {
+		log.Info("State pruning dry run complete", "prunable", stats.Deleted, "size", stats.Size, "elapsed", common.PrettyDuration(stats.Elapsed))
+		return nil
+	}
+	// Compact the database to actually reclaim the space of the deleted entries
+	start := time.Now()
+	log.Info("Compacting chain database")
+	if err := db.Compact(nil, nil); err != nil {
+		utils.Fatalf("Compaction failed: %v", err)
+	}
+	reclaimed := before - dirSize(dbdir)
+	if reclaimed < 0 {
+		reclaimed = 0 // Compaction overhead on small databases
+	}
+	log.Info("State pruning complete", "deleted", stats.Deleted, "size", stats.Size, "elapsed", common.PrettyDuration(stats.Elapsed),
+		"compaction", common.PrettyDuration(time.Since(start)), "reclaimed", common.StorageSize(reclaimed))
+
+	return os.RemoveAll(marksdir)
+}
+
+// dirSize returns the total size of all the files within a directory.
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
 func dump(ctx *cli.Context) error {
 	stack := makeFullNode(ctx)
 	chain, chainDb := utils.MakeChain(ctx, stack)
@@ -0,0 +1,96 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	dbCommand = cli.Command{
+		Name:      "db",
+		Usage:     "Low level database operations",
+		ArgsUsage: "",
+		Category:  "DATABASE COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Action:    utils.MigrateFlags(inspect),
+				Name:      "inspect",
+				Usage:     "Inspect the storage size for each type of data in the database",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.DBEngineFlag,
+					utils.CacheFlag,
+					utils.LightModeFlag,
+					utils.TestnetFlag,
+					utils.RinkebyFlag,
+					utils.InspectJSONFlag,
+				},
+				Description: `
+Walks the entire chain database and prints the number of entries and their
+total size for every kind of data stored in it: headers, bodies, receipts,
+transaction lookups, bloombits, trie nodes, contract codes, preimages, chain
+configs and the ancient chain segments. Use --json for machine readable output.`,
+			},
+		},
+	}
+)
+
+// inspect walks the chain database and prints the entry counts and sizes of all
+// the data categories within.
+func inspect(ctx *cli.Context) error {
+	stack := makeFullNode(ctx)
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	stats, err := core.InspectDatabase(db)
+	if err != nil {
+		utils.Fatalf("Failed to inspect database: %v", err)
+	}
+	if ctx.Bool(utils.InspectJSONFlag.Name) {
+		out, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			utils.Fatalf("Failed to encode database statistics: %v", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	var (
+		table = tablewriter.NewWriter(os.Stdout)
+		total common.StorageSize
+	)
+	table.SetAutoFormatHeaders(false) // Keeps the decimal point of the total size
+	table.SetHeader([]string{"Database", "Category", "Items", "Size"})
+	for _, stat := range stats {
+		table.Append([]string{stat.Database, stat.Category, fmt.Sprintf("%d", stat.Count), stat.Size.String()})
+		total += stat.Size
+	}
+	table.SetFooter([]string{"", "Total", "", total.String()})
+	table.Render()
+
+	return nil
+}
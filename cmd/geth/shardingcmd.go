@@ -0,0 +1,292 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/sharding"
+	"github.com/ethereum/go-ethereum/sharding/devnet"
+	"github.com/ethereum/go-ethereum/sharding/notary"
+	"github.com/ethereum/go-ethereum/sharding/observer"
+	"github.com/ethereum/go-ethereum/sharding/proposer"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	// Sharding settings, only used by the sharding command
+	vmcAddressFlag = cli.StringFlag{
+		Name:  "vmc",
+		Usage: "Address of the validator manager contract (deployed if missing)",
+	}
+	shardingActorFlag = cli.StringFlag{
+		Name:  "actor",
+		Usage: `Role of the sharding client ("proposer", "notary" or "observer")`,
+		Value: sharding.DefaultConfig.Actor,
+	}
+	shardIDFlag = cli.Int64Flag{
+		Name:  "shardid",
+		Usage: "Shard to propose collations for or to observe",
+	}
+	shardingPortFlag = cli.IntFlag{
+		Name:  "shardport",
+		Usage: "Network listening port of the shard protocol",
+		Value: 30305,
+	}
+	shardingPeersFlag = cli.StringFlag{
+		Name:  "shardpeers",
+		Usage: "Comma separated enode URLs of sharding clients to connect to",
+	}
+	shardingDevProposersFlag = cli.IntFlag{
+		Name:  "dev.proposers",
+		Usage: "Number of proposers to launch in sharding developer mode",
+		Value: devnet.DefaultConfig.Proposers,
+	}
+	shardingDevNotariesFlag = cli.IntFlag{
+		Name:  "dev.notaries",
+		Usage: "Number of notaries to launch in sharding developer mode",
+		Value: devnet.DefaultConfig.Notaries,
+	}
+	shardingDevObserversFlag = cli.IntFlag{
+		Name:  "dev.observers",
+		Usage: "Number of observers to launch in sharding developer mode",
+		Value: devnet.DefaultConfig.Observers,
+	}
+
+	shardingFlags = []cli.Flag{
+		vmcAddressFlag,
+		shardingActorFlag,
+		shardIDFlag,
+		shardingPortFlag,
+		shardingPeersFlag,
+		shardingDevProposersFlag,
+		shardingDevNotariesFlag,
+		shardingDevObserversFlag,
+	}
+
+	shardingCommand = cli.Command{
+		Action:    utils.MigrateFlags(shardingClient),
+		Name:      "sharding",
+		Usage:     "Start a sharding client (connect to node)",
+		ArgsUsage: "[endpoint]",
+		Flags: append([]cli.Flag{
+			utils.DataDirFlag,
+			utils.KeyStoreDirFlag,
+			utils.UnlockedAccountFlag,
+			utils.PasswordFileFlag,
+			utils.NetworkIdFlag,
+			utils.DeveloperFlag,
+			utils.DeveloperPeriodFlag,
+			utils.RPCEnabledFlag,
+			utils.RPCPortFlag,
+		}, shardingFlags...),
+		Category: "SHARDING COMMANDS",
+		Description: `
+The sharding client connects to a running geth node over IPC, deploys the
+validator manager contract if it is not found at the configured address and
+follows the main chain until interrupted.
+
+The client runs in the role given by --actor:
+
+  proposer  packs transactions into collations for the shard given by --shardid
+  notary    deposits into the validator manager contract and submits collation
+            headers for the shards it is sampled for
+  observer  follows the collation headers recorded for the shard given by
+            --shardid
+
+Main chain transactions are signed with the account given by --unlock, or the
+first account in the keystore if none is specified. If no endpoint is given,
+the IPC socket in the data directory is used.
+
+Collations are gossiped between sharding clients over the shard protocol on
+the port given by --shardport. Peer discovery is disabled, other clients must
+be listed via --shardpeers or the static-nodes.json file of the sharding node.
+
+With --dev, no external node is used. Instead a local devnet is launched in a
+single process: a proof-of-authority main chain sealing a block every
+--dev.period seconds, with the validator manager contract and funded accounts
+in its genesis block, and the number of proposers, notaries and observers
+given by --dev.proposers, --dev.notaries and --dev.observers, connected to each
+other. Every node exposes an IPC endpoint in its own directory below the data
+directory (a temporary one unless --datadir is given). With --rpc, the main
+chain node also serves HTTP-RPC on --rpcport and the sharding actors on the
+subsequent ports.`,
+	}
+)
+
+// shardingClient starts a sharding client connected to a running geth node and
+// blocks until it is interrupted.
+func shardingClient(ctx *cli.Context) error {
+	if ctx.GlobalBool(utils.DeveloperFlag.Name) {
+		return shardingDevnet(ctx)
+	}
+	stack := makeShardingNode(ctx)
+
+	// Resolve the IPC endpoint of the main chain node
+	config := sharding.DefaultConfig
+	if config.Endpoint = ctx.Args().First(); config.Endpoint == "" {
+		config.Endpoint = filepath.Join(stack.DataDir(), clientIdentifier+".ipc")
+	}
+	// Assemble the rest of the sharding client configuration
+	if ctx.GlobalIsSet(vmcAddressFlag.Name) {
+		hex := ctx.GlobalString(vmcAddressFlag.Name)
+		if !common.IsHexAddress(hex) {
+			utils.Fatalf("Invalid validator manager contract address: %s", hex)
+		}
+		config.VMCAddress = common.HexToAddress(hex)
+	}
+	if ctx.GlobalIsSet(shardingActorFlag.Name) {
+		config.Actor = ctx.GlobalString(shardingActorFlag.Name)
+	}
+	config.ShardID = ctx.GlobalInt64(shardIDFlag.Name)
+	if config.ShardID < 0 || config.ShardID >= sharding.ShardCount {
+		utils.Fatalf("Invalid shard %d, must be below %d", config.ShardID, sharding.ShardCount)
+	}
+	config.NetworkId = ctx.GlobalUint64(utils.NetworkIdFlag.Name)
+	config.Account = unlockShardingAccount(ctx, stack)
+
+	registerShardingService(stack, &config)
+	utils.StartNode(stack)
+	stack.Wait()
+	return nil
+}
+
+// shardingDevnet launches a local sharding devnet and blocks until it is
+// interrupted.
+func shardingDevnet(ctx *cli.Context) error {
+	config := devnet.DefaultConfig
+	if ctx.GlobalIsSet(utils.DataDirFlag.Name) {
+		config.DataDir = ctx.GlobalString(utils.DataDirFlag.Name)
+	}
+	if period := ctx.GlobalInt(utils.DeveloperPeriodFlag.Name); period > 0 {
+		config.Period = uint64(period)
+	}
+	config.Proposers = ctx.GlobalInt(shardingDevProposersFlag.Name)
+	config.Notaries = ctx.GlobalInt(shardingDevNotariesFlag.Name)
+	config.Observers = ctx.GlobalInt(shardingDevObserversFlag.Name)
+	config.ShardID = ctx.GlobalInt64(shardIDFlag.Name)
+	if ctx.GlobalBool(utils.RPCEnabledFlag.Name) {
+		config.HTTPPort = ctx.GlobalInt(utils.RPCPortFlag.Name)
+	}
+	net, err := devnet.New(&config)
+	if err != nil {
+		utils.Fatalf("Failed to create sharding devnet: %v", err)
+	}
+	if err := net.Start(); err != nil {
+		net.Stop()
+		utils.Fatalf("Failed to start sharding devnet: %v", err)
+	}
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt)
+	defer signal.Stop(sigc)
+
+	<-sigc
+	log.Info("Got interrupt, shutting down...")
+	net.Stop()
+	return nil
+}
+
+// makeShardingNode creates the protocol stack hosting the sharding services. It
+// shares the data directory and keystore with the main chain node, but uses its
+// own instance directory and IPC endpoint.
+func makeShardingNode(ctx *cli.Context) *node.Node {
+	cfg := node.Config{
+		Name:        "sharding",
+		Version:     params.VersionWithCommit(gitCommit),
+		DataDir:     utils.MakeDataDir(ctx),
+		KeyStoreDir: ctx.GlobalString(utils.KeyStoreDirFlag.Name),
+		IPCPath:     "sharding.ipc",
+		P2P: p2p.Config{
+			ListenAddr:  fmt.Sprintf(":%d", ctx.GlobalInt(shardingPortFlag.Name)),
+			MaxPeers:    25,
+			NoDiscovery: true,
+		},
+	}
+	if urls := ctx.GlobalString(shardingPeersFlag.Name); urls != "" {
+		for _, url := range strings.Split(urls, ",") {
+			node, err := discover.ParseNode(url)
+			if err != nil {
+				utils.Fatalf("Invalid sharding peer %s: %v", url, err)
+			}
+			cfg.P2P.StaticNodes = append(cfg.P2P.StaticNodes, node)
+		}
+	}
+	stack, err := node.New(&cfg)
+	if err != nil {
+		utils.Fatalf("Failed to create the sharding node: %v", err)
+	}
+	return stack
+}
+
+// unlockShardingAccount unlocks the account requested via --unlock in the
+// node's keystore, defaulting to the first one available.
+func unlockShardingAccount(ctx *cli.Context, stack *node.Node) common.Address {
+	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+
+	address := strings.TrimSpace(strings.Split(ctx.GlobalString(utils.UnlockedAccountFlag.Name), ",")[0])
+	if address == "" {
+		accs := ks.Accounts()
+		if len(accs) == 0 {
+			utils.Fatalf("No accounts found to sign main chain transactions with")
+		}
+		address = accs[0].Address.Hex()
+	}
+	account, _ := unlockAccount(ctx, ks, address, 0, utils.MakePasswordList(ctx))
+	return account.Address
+}
+
+// registerShardingService adds a sharding client to the stack, along with the
+// service implementing the configured actor.
+func registerShardingService(stack *node.Node, cfg *sharding.Config) {
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		return sharding.New(ctx, cfg)
+	}); err != nil {
+		utils.Fatalf("Failed to register the sharding client: %v", err)
+	}
+	var err error
+	switch cfg.Actor {
+	case sharding.ProposerActor:
+		err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+			return proposer.New(ctx, cfg)
+		})
+	case sharding.NotaryActor:
+		err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+			return notary.New(ctx, cfg)
+		})
+	case sharding.ObserverActor:
+		err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+			return observer.New(ctx, cfg)
+		})
+	default:
+		utils.Fatalf("Unknown sharding actor %q", cfg.Actor)
+	}
+	if err != nil {
+		utils.Fatalf("Failed to register the sharding %s: %v", cfg.Actor, err)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// freezerRecheckInterval is the frequency to check the key-value database for
+	// chain progression that might permit new blocks to be frozen into immutable
+	// storage.
+	freezerRecheckInterval = time.Minute
+
+	// freezerBatchLimit is the maximum number of blocks to freeze in one batch
+	// before doing an fsync and deleting them from the key-value store.
+	freezerBatchLimit = 30000
+)
+
+// emptyReceiptsRLP is the encoding of an empty receipt list, frozen for blocks
+// whose receipts are not in the database.
+var emptyReceiptsRLP, _ = rlp.EncodeToBytes([]*types.ReceiptForStorage{})
+
+// freeze is a background thread that periodically checks the blockchain for any
+// import progress and moves ancient data from the key-value store into the
+// freezer.
+func (bc *BlockChain) freeze(db ethdb.AncientStore) {
+	defer bc.wg.Done()
+
+	threshold := bc.cacheConfig.FreezerThreshold
+	if threshold == 0 {
+		threshold = params.ImmutabilityThreshold
+	}
+	ticker := time.NewTicker(freezerRecheckInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep freezing batches while there's anything left to freeze
+		for {
+			frozen, err := bc.freezeBatch(db, threshold)
+			if err != nil {
+				log.Error("Failed to freeze ancient blocks", "err", err)
+			}
+			if err != nil || frozen < freezerBatchLimit {
+				break
+			}
+			select {
+			case <-bc.quit:
+				return
+			default:
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-bc.quit:
+			return
+		}
+	}
+}
+
+// freezeBatch moves a batch of canonical blocks older than the threshold from
+// the key-value store into the ancient store, returning the number of blocks
+// frozen.
+func (bc *BlockChain) freezeBatch(db ethdb.AncientStore, threshold uint64) (int, error) {
+	// Retrieve the freezing boundaries and skip if there's nothing to do
+	head := bc.CurrentFastBlock().NumberU64()
+	if head < threshold {
+		return 0, nil
+	}
+	limit := head - threshold
+	frozen, err := db.Ancients()
+	if err != nil {
+		return 0, err
+	}
+	if frozen > limit {
+		return 0, nil
+	}
+	if limit-frozen >= freezerBatchLimit {
+		limit = frozen + freezerBatchLimit - 1
+	}
+	// Move the canonical chain data into the ancient store
+	var (
+		start  = time.Now()
+		first  = frozen
+		hashes []common.Hash
+	)
+freezing:
+	for number := first; number <= limit; number++ {
+		// Stop early if the chain is shutting down, but clean up what's frozen
+		select {
+		case <-bc.quit:
+			break freezing
+		default:
+		}
+		hash := GetCanonicalHash(db, number)
+		if hash == (common.Hash{}) {
+			return 0, fmt.Errorf("canonical hash missing, can't freeze block %d", number)
+		}
+		header := GetHeaderRLP(db, hash, number)
+		if len(header) == 0 {
+			return 0, fmt.Errorf("block header missing, can't freeze block %d", number)
+		}
+		body := GetBodyRLP(db, hash, number)
+		if len(body) == 0 {
+			return 0, fmt.Errorf("block body missing, can't freeze block %d", number)
+		}
+		td, _ := db.Get(tdKey(hash, number))
+		if len(td) == 0 {
+			return 0, fmt.Errorf("total difficulty missing, can't freeze block %d", number)
+		}
+		receipts, _ := db.Get(blockReceiptsKey(hash, number))
+		if len(receipts) == 0 {
+			receipts = emptyReceiptsRLP
+		}
+		if err := db.AppendAncient(number, hash[:], header, body, receipts, td); err != nil {
+			return 0, err
+		}
+		hashes = append(hashes, hash)
+	}
+	if len(hashes) == 0 {
+		return 0, nil
+	}
+	if err := db.Sync(); err != nil {
+		return 0, err
+	}
+	// Wipe out the frozen data from the key-value store, keeping the hash to
+	// number mappings for lookups
+	batch := db.NewBatch()
+	for i, hash := range hashes {
+		number := first + uint64(i)
+
+		DeleteCanonicalHash(batch, number)
+		batch.Delete(headerKey(hash, number))
+		DeleteBody(batch, hash, number)
+		DeleteBlockReceipts(batch, hash, number)
+		DeleteTd(batch, hash, number)
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return 0, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+	log.Info("Froze ancient blocks", "number", first+uint64(len(hashes))-1, "count", len(hashes), "elapsed", common.PrettyDuration(time.Since(start)))
+	return len(hashes), nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that canonical blocks beyond the immutability threshold are moved into
+// the ancient store, remain accessible afterwards and are truncated on rewinds.
+func TestFreezeAncientBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-")
+	if err != nil {
+		t.Fatalf("failed to create temporary freezer: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		signer = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	gendb, _ := ethdb.NewMemDatabase()
+	genesis := gspec.MustCommit(gendb)
+
+	blocks, receipts := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 32, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x00}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	// Import the chain into a database with a freezer attached
+	memdb, _ := ethdb.NewMemDatabase()
+	db, err := ethdb.NewDatabaseWithFreezer(memdb, dir)
+	if err != nil {
+		t.Fatalf("failed to create freezer database: %v", err)
+	}
+	defer db.Close()
+
+	gspec.MustCommit(db)
+	chain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	// Freeze everything older than 8 blocks and check the key-value store pruning
+	frozen, err := chain.freezeBatch(db.(ethdb.AncientStore), 8)
+	if err != nil {
+		t.Fatalf("failed to freeze blocks: %v", err)
+	}
+	if frozen != 25 {
+		t.Fatalf("frozen block count mismatch: have %d, want %d", frozen, 25)
+	}
+	if ancients, _ := db.(ethdb.AncientStore).Ancients(); ancients != 25 {
+		t.Fatalf("ancient item count mismatch: have %d, want %d", ancients, 25)
+	}
+	for i, block := range blocks {
+		number, hash := block.NumberU64(), block.Hash()
+
+		stored, _ := memdb.Has(headerKey(hash, number))
+		if want := number > 24; stored != want {
+			t.Errorf("block %d: key-value header presence mismatch: have %v, want %v", number, stored, want)
+		}
+		if have := GetCanonicalHash(db, number); have != hash {
+			t.Errorf("block %d: canonical hash mismatch: have %x, want %x", number, have, hash)
+		}
+		if have := GetBlock(db, hash, number); have == nil || have.Hash() != hash {
+			t.Errorf("block %d: block mismatch: have %v", number, have)
+		}
+		if have := GetTd(db, hash, number); have == nil || have.Cmp(chain.GetTd(hash, number)) != 0 {
+			t.Errorf("block %d: total difficulty mismatch: have %v", number, have)
+		}
+		if have := GetBlockReceipts(db, hash, number, gspec.Config); types.DeriveSha(have) != types.DeriveSha(receipts[i]) {
+			t.Errorf("block %d: receipts mismatch", number)
+		}
+	}
+	// Rewind the chain into the ancient segment and check the freezer follows
+	if err := chain.SetHead(10); err != nil {
+		t.Fatalf("failed to rewind chain: %v", err)
+	}
+	if ancients, _ := db.(ethdb.AncientStore).Ancients(); ancients != 11 {
+		t.Fatalf("ancient item count mismatch after rewind: have %d, want %d", ancients, 11)
+	}
+	if hash := GetCanonicalHash(db, 11); hash != (common.Hash{}) {
+		t.Errorf("rewound block still canonical: %x", hash)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// maintainTxIndex is a background thread that follows the chain head and keeps
+// the transaction lookup entries confined to the most recent blocks, deleting
+// the entries of blocks falling out of the configured range and indexing older
+// blocks again if the range is extended.
+//
+// The tail of the index is tracked in the database. Without one, all the blocks
+// are indexed, as done at import, so with no limit configured nothing is done.
+func (bc *BlockChain) maintainTxIndex() {
+	defer bc.wg.Done()
+
+	heads := make(chan ChainHeadEvent, 1)
+	sub := bc.chainHeadFeed.Subscribe(heads)
+	defer sub.Unsubscribe()
+
+	// Run the (un)indexing in the background, so the chain head events don't
+	// block while a large range is being processed
+	var (
+		head    = bc.CurrentBlock().NumberU64()
+		indexed = head
+		done    = make(chan struct{})
+	)
+	go bc.indexTransactions(head, done)
+
+	for {
+		select {
+		case ev := <-heads:
+			head = ev.Block.NumberU64()
+			if done == nil {
+				indexed, done = head, make(chan struct{})
+				go bc.indexTransactions(head, done)
+			}
+		case <-done:
+			done = nil
+			if indexed != head {
+				indexed, done = head, make(chan struct{})
+				go bc.indexTransactions(head, done)
+			}
+		case <-bc.quit:
+			if done != nil {
+				<-done
+			}
+			return
+		}
+	}
+}
+
+// indexTransactions moves the tail of the transaction index to the first block
+// covered by the lookup limit at the given head, indexing or unindexing blocks
+// as needed. It closes done when finished, or aborted by the chain stopping.
+func (bc *BlockChain) indexTransactions(head uint64, done chan struct{}) {
+	defer close(done)
+
+	var (
+		limit  = bc.cacheConfig.TxLookupLimit
+		tail   = uint64(0)
+		target = uint64(0)
+	)
+	if stored := GetTxIndexTail(bc.chainDb); stored != nil {
+		tail = *stored
+	} else if limit == 0 {
+		return // Everything indexed, nothing to track
+	}
+	if limit != 0 && head >= limit {
+		target = head - limit + 1
+	}
+	var err error
+	switch {
+	case tail < target:
+		err = bc.unindexBlocks(tail, target)
+	case tail > target:
+		atomic.StoreInt32(&bc.txIndexing, 1)
+		err = bc.indexBlocks(target, tail)
+		atomic.StoreInt32(&bc.txIndexing, 0)
+	default:
+		err = WriteTxIndexTail(bc.chainDb, tail)
+	}
+	if err != nil {
+		log.Error("Failed to maintain transaction index", "err", err)
+	}
+}
+
+// unindexBlocks deletes the transaction lookup entries of the canonical blocks in
+// the range [from, to), moving the index tail forward as it progresses.
+func (bc *BlockChain) unindexBlocks(from, to uint64) error {
+	var (
+		start  = time.Now()
+		logged = time.Now()
+		batch  = bc.chainDb.NewBatch()
+		txs    int
+	)
+	for number := from; number < to; number++ {
+		if bc.txIndexStopped() {
+			return nil
+		}
+		block := bc.GetBlockByNumber(number)
+		if block == nil {
+			return fmt.Errorf("canonical block #%d missing", number)
+		}
+		for _, tx := range block.Transactions() {
+			DeleteTxLookupEntry(batch, tx.Hash())
+		}
+		txs += len(block.Transactions())
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize || number == to-1 {
+			WriteTxIndexTail(batch, number+1)
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Unindexing transactions", "blocks", number-from+1, "txs", txs, "tail", number+1, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if to-from > 1 || txs > 0 {
+		log.Info("Unindexed transactions", "blocks", to-from, "txs", txs, "tail", to, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	return nil
+}
+
+// indexBlocks writes the transaction lookup entries of the canonical blocks in
+// the range [from, to), progressing backwards and moving the index tail with it.
+func (bc *BlockChain) indexBlocks(from, to uint64) error {
+	var (
+		start  = time.Now()
+		logged = time.Now()
+		batch  = bc.chainDb.NewBatch()
+		txs    int
+	)
+	for number := to; number > from; number-- {
+		if bc.txIndexStopped() {
+			return nil
+		}
+		block := bc.GetBlockByNumber(number - 1)
+		if block == nil {
+			return fmt.Errorf("canonical block #%d missing", number-1)
+		}
+		if err := WriteTxLookupEntries(batch, block); err != nil {
+			return err
+		}
+		txs += len(block.Transactions())
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize || number == from+1 {
+			WriteTxIndexTail(batch, number-1)
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Indexing transactions", "blocks", to-number+1, "txs", txs, "tail", number-1, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	log.Info("Indexed transactions", "blocks", to-from, "txs", txs, "tail", from, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// TxIndexInProgress reports whether the transaction index is currently being
+// extended to older blocks, e.g. after raising the lookup limit, in which case
+// the transactions below the index tail will become available as it progresses.
+func (bc *BlockChain) TxIndexInProgress() bool {
+	return atomic.LoadInt32(&bc.txIndexing) == 1
+}
+
+// txIndexStopped reports whether the chain is shutting down, in which case any
+// transaction index maintenance is aborted.
+func (bc *BlockChain) txIndexStopped() bool {
+	select {
+	case <-bc.quit:
+		return true
+	default:
+		return false
+	}
+}
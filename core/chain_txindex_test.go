@@ -0,0 +1,91 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the transaction index follows the configured lookup limit, both by
+// unindexing blocks falling out of the limit and by indexing them again when the
+// limit is raised.
+func TestTxIndexLimit(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		db, _   = ethdb.NewMemDatabase()
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{addr: {Balance: big.NewInt(1000000000)}}}
+		genesis = gspec.MustCommit(db)
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 32, func(i int, gen *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr), common.Address{0x01}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+		gen.AddTx(tx)
+	})
+	var chain *BlockChain
+
+	// verify waits for the index tail to reach the expected block and the indexing
+	// to finish, and checks that exactly the blocks from the tail onwards are indexed
+	verify := func(tail uint64) {
+		for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+			if stored := GetTxIndexTail(db); stored != nil && *stored == tail {
+				break
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("index tail mismatch: have %v, want %d", GetTxIndexTail(db), tail)
+			}
+		}
+		for start := time.Now(); chain.TxIndexInProgress(); time.Sleep(10 * time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("indexing still in progress at tail %d", tail)
+			}
+		}
+		for _, block := range blocks {
+			hash, _, _ := GetTxLookupEntry(db, block.Transactions()[0].Hash())
+			if indexed := block.NumberU64() >= tail; indexed != (hash != common.Hash{}) {
+				t.Errorf("block %d: indexing mismatch: have %v, want %v", block.NumberU64(), !indexed, indexed)
+			}
+		}
+	}
+	// Import the chain with a limit, unindexing the old blocks
+	chain, _ = NewBlockChain(db, &CacheConfig{TrieNodeLimit: 256, TrieTimeLimit: 5 * time.Minute, TxLookupLimit: 8}, gspec.Config, ethash.NewFaker(), vm.Config{})
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	verify(25)
+	chain.Stop()
+
+	// Raise the limit, indexing a part of the old blocks again
+	chain, _ = NewBlockChain(db, &CacheConfig{TrieNodeLimit: 256, TrieTimeLimit: 5 * time.Minute, TxLookupLimit: 16}, gspec.Config, ethash.NewFaker(), vm.Config{})
+	verify(17)
+	chain.Stop()
+
+	// Remove the limit, indexing the entire chain
+	chain, _ = NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	verify(0)
+	chain.Stop()
+}
@@ -0,0 +1,198 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Key layout of the flat state snapshot maintained by core/state/snapshot.
+var (
+	snapshotAccountPrefix = []byte("a") // snapshotAccountPrefix + account hash -> slim account
+	snapshotStoragePrefix = []byte("o") // snapshotStoragePrefix + account hash + storage hash -> storage slot
+)
+
+// DatabaseStat is the number and the total size of the database entries of a
+// particular category.
+type DatabaseStat struct {
+	Database string             `json:"database"` // Store holding the entries
+	Category string             `json:"category"` // Kind of data the entries hold
+	Count    uint64             `json:"count"`    // Number of entries
+	Size     common.StorageSize `json:"size"`     // Total size of the keys and values
+}
+
+// add accounts for a single entry of the category.
+func (s *DatabaseStat) add(size int) {
+	s.Count++
+	s.Size += common.StorageSize(size)
+}
+
+// InspectDatabase walks the entire key-value store of a chain database and
+// aggregates the number and size of its entries by category, followed by the
+// sizes of the ancient chain segments if the database has a freezer attached.
+//
+// Contract codes and state trie nodes are both keyed by their hash, so they are
+// told apart by trie nodes being RLP lists of 2 or 17 items. The flat snapshot
+// entries are reported separately from the trie, its root and generation marker
+// as metadata. Entries matching no known key layout are reported as unaccounted.
+func InspectDatabase(db ethdb.Database) ([]*DatabaseStat, error) {
+	const kvstore = "Key-Value store"
+
+	var (
+		headers      = &DatabaseStat{Database: kvstore, Category: "Headers"}
+		bodies       = &DatabaseStat{Database: kvstore, Category: "Bodies"}
+		receipts     = &DatabaseStat{Database: kvstore, Category: "Receipts"}
+		tds          = &DatabaseStat{Database: kvstore, Category: "Difficulties"}
+		numHashes    = &DatabaseStat{Database: kvstore, Category: "Block number->hash"}
+		hashNums     = &DatabaseStat{Database: kvstore, Category: "Block hash->number"}
+		lookups      = &DatabaseStat{Database: kvstore, Category: "Transaction lookups"}
+		bloomBits    = &DatabaseStat{Database: kvstore, Category: "Bloombits"}
+		trieNodes    = &DatabaseStat{Database: kvstore, Category: "Trie nodes"}
+		codes        = &DatabaseStat{Database: kvstore, Category: "Contract codes"}
+		preimages    = &DatabaseStat{Database: kvstore, Category: "Trie preimages"}
+		snapAccounts = &DatabaseStat{Database: kvstore, Category: "Account snapshot"}
+		snapStorage  = &DatabaseStat{Database: kvstore, Category: "Storage snapshot"}
+		configs      = &DatabaseStat{Database: kvstore, Category: "Chain configs"}
+		metadata     = &DatabaseStat{Database: kvstore, Category: "Metadata"}
+		unaccounted  = &DatabaseStat{Database: kvstore, Category: "Unaccounted"}
+		metadataKeys = [][]byte{
+			headHeaderKey, headBlockKey, headFastKey, txIndexTailKey, []byte("BlockchainVersion"),
+			[]byte("SnapshotRoot"), []byte("SnapshotGenerator"),
+		}
+
+		start  = time.Now()
+		logged = time.Now()
+		count  uint64
+	)
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+
+	for it.Next() {
+		key, value := it.Key(), it.Value()
+		size := len(key) + len(value)
+
+		switch {
+		case bytes.HasPrefix(key, headerPrefix) && len(key) == len(headerPrefix)+8+common.HashLength:
+			headers.add(size)
+		case bytes.HasPrefix(key, headerPrefix) && len(key) == len(headerPrefix)+8+common.HashLength+len(tdSuffix) && bytes.HasSuffix(key, tdSuffix):
+			tds.add(size)
+		case bytes.HasPrefix(key, headerPrefix) && len(key) == len(headerPrefix)+8+len(numSuffix) && bytes.HasSuffix(key, numSuffix):
+			numHashes.add(size)
+		case bytes.HasPrefix(key, blockHashPrefix) && len(key) == len(blockHashPrefix)+common.HashLength:
+			hashNums.add(size)
+		case bytes.HasPrefix(key, bodyPrefix) && len(key) == len(bodyPrefix)+8+common.HashLength:
+			bodies.add(size)
+		case bytes.HasPrefix(key, blockReceiptsPrefix) && len(key) == len(blockReceiptsPrefix)+8+common.HashLength:
+			receipts.add(size)
+		case bytes.HasPrefix(key, lookupPrefix) && len(key) == len(lookupPrefix)+common.HashLength:
+			lookups.add(size)
+		case bytes.HasPrefix(key, bloomBitsPrefix) && len(key) == len(bloomBitsPrefix)+2+8+common.HashLength:
+			bloomBits.add(size)
+		case len(key) == common.HashLength:
+			if isTrieNode(value) {
+				trieNodes.add(size)
+			} else {
+				codes.add(size)
+			}
+		case bytes.HasPrefix(key, BloomBitsIndexPrefix):
+			bloomBits.add(size)
+		case bytes.HasPrefix(key, snapshotAccountPrefix) && len(key) == len(snapshotAccountPrefix)+common.HashLength:
+			snapAccounts.add(size)
+		case bytes.HasPrefix(key, snapshotStoragePrefix) && len(key) == len(snapshotStoragePrefix)+2*common.HashLength:
+			snapStorage.add(size)
+		case bytes.HasPrefix(key, []byte(preimagePrefix)) && len(key) == len(preimagePrefix)+common.HashLength:
+			preimages.add(size)
+		case bytes.HasPrefix(key, configPrefix) && len(key) == len(configPrefix)+common.HashLength:
+			configs.add(size)
+		default:
+			accounted := false
+			for _, meta := range metadataKeys {
+				if bytes.Equal(key, meta) {
+					metadata.add(size)
+					accounted = true
+					break
+				}
+			}
+			if !accounted {
+				unaccounted.add(size)
+			}
+		}
+		count++
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Inspecting database", "entries", count, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	stats := []*DatabaseStat{
+		headers, bodies, receipts, tds, numHashes, hashNums, lookups, bloomBits,
+		trieNodes, codes, preimages, snapAccounts, snapStorage, configs, metadata, unaccounted,
+	}
+	// Append the sizes of the ancient chain segments, if there are any
+	if ancients, ok := db.(ethdb.AncientReader); ok {
+		frozen, err := ancients.Ancients()
+		if err != nil {
+			return nil, err
+		}
+		tables := []struct {
+			kind     string
+			category string
+		}{
+			{ethdb.FreezerHeaderTable, "Headers"},
+			{ethdb.FreezerBodiesTable, "Bodies"},
+			{ethdb.FreezerReceiptTable, "Receipts"},
+			{ethdb.FreezerDifficultyTable, "Difficulties"},
+			{ethdb.FreezerHashTable, "Block number->hash"},
+		}
+		for _, table := range tables {
+			size, err := ancients.AncientSize(table.kind)
+			if err != nil {
+				return nil, err
+			}
+			stats = append(stats, &DatabaseStat{
+				Database: "Ancient store",
+				Category: table.category,
+				Count:    frozen,
+				Size:     common.StorageSize(size),
+			})
+		}
+	}
+	log.Info("Inspected database", "entries", count, "elapsed", common.PrettyDuration(time.Since(start)))
+	return stats, nil
+}
+
+// isTrieNode reports whether a blob looks like an encoded trie node: either a
+// short node (list of 2 items) or a full node (list of 17 items).
+func isTrieNode(blob []byte) bool {
+	content, rest, err := rlp.SplitList(blob)
+	if err != nil || len(rest) != 0 {
+		return false
+	}
+	items, err := rlp.CountValues(content)
+	if err != nil {
+		return false
+	}
+	return items == 2 || items == 17
+}
@@ -0,0 +1,100 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that database inspection attributes the entries to the right categories.
+func TestInspectDatabase(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	tx := types.NewTransaction(1, common.BytesToAddress([]byte{0x11}), big.NewInt(111), 1111, big.NewInt(11111), []byte{0x11, 0x11, 0x11})
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1)}, []*types.Transaction{tx}, nil, nil)
+
+	WriteBlock(db, block)
+	WriteTd(db, block.Hash(), 1, big.NewInt(1))
+	WriteCanonicalHash(db, block.Hash(), 1)
+	WriteBlockReceipts(db, block.Hash(), 1, types.Receipts{types.NewReceipt(nil, false, 0)})
+	WriteTxLookupEntries(db, block)
+	WriteHeadBlockHash(db, block.Hash())
+	WriteChainConfig(db, block.Hash(), params.TestChainConfig)
+	WritePreimages(db, 1, map[common.Hash][]byte{crypto.Keccak256Hash([]byte{1}): {1}})
+
+	node, _ := rlp.EncodeToBytes([][]byte{{0x20}, {0x01}})
+	db.Put(crypto.Keccak256(node), node)
+	code := []byte{0x60, 0x00, 0x60, 0x00, 0xf3}
+	db.Put(crypto.Keccak256(code), code)
+	db.Put(append([]byte("a"), crypto.Keccak256([]byte{2})...), []byte{0xc0})
+	db.Put(append(append([]byte("o"), crypto.Keccak256([]byte{2})...), crypto.Keccak256([]byte{3})...), []byte{0x01})
+	db.Put([]byte("SnapshotRoot"), crypto.Keccak256(node))
+	db.Put([]byte("SnapshotGenerator"), []byte{0xc0})
+	db.Put([]byte("junk"), []byte("junk"))
+
+	stats, err := InspectDatabase(db)
+	if err != nil {
+		t.Fatalf("failed to inspect database: %v", err)
+	}
+	want := map[string]uint64{
+		"Headers":             1,
+		"Bodies":              1,
+		"Receipts":            1,
+		"Difficulties":        1,
+		"Block number->hash":  1,
+		"Block hash->number":  1,
+		"Transaction lookups": 1,
+		"Bloombits":           0,
+		"Trie nodes":          1,
+		"Contract codes":      1,
+		"Trie preimages":      1,
+		"Account snapshot":    1,
+		"Storage snapshot":    1,
+		"Chain configs":       1,
+		"Metadata":            3,
+		"Unaccounted":         1,
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("category count mismatch: have %d, want %d", len(stats), len(want))
+	}
+	var total common.StorageSize
+	for _, stat := range stats {
+		if stat.Count != want[stat.Category] {
+			t.Errorf("%s: count mismatch: have %d, want %d", stat.Category, stat.Count, want[stat.Category])
+		}
+		if (stat.Count == 0) != (stat.Size == 0) {
+			t.Errorf("%s: size mismatch: %d entries of %v", stat.Category, stat.Count, stat.Size)
+		}
+		total += stat.Size
+	}
+	var size common.StorageSize
+	for _, key := range db.Keys() {
+		value, _ := db.Get(key)
+		size += common.StorageSize(len(key) + len(value))
+	}
+	if total != size {
+		t.Errorf("total size mismatch: have %v, want %v", total, size)
+	}
+}
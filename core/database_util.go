@@ -48,6 +48,9 @@ var (
 	headBlockKey  = []byte("LastBlock")
 	headFastKey   = []byte("LastFast")
 
+	// txIndexTailKey tracks the oldest block whose transactions are indexed.
+	txIndexTailKey = []byte("TransactionIndexTail")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`).
 	headerPrefix        = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	tdSuffix            = []byte("t") // headerPrefix + num (uint64 big endian) + hash + tdSuffix -> td
@@ -89,9 +92,29 @@ func encodeBlockNumber(number uint64) []byte {
 	return enc
 }
 
+// readAncient retrieves an item from the immutable ancient chain segment, if the
+// database is backed by an ancient store holding the given canonical block.
+func readAncient(db DatabaseReader, kind string, hash common.Hash, number uint64) []byte {
+	adb, ok := db.(ethdb.AncientReader)
+	if !ok {
+		return nil
+	}
+	// The ancient store only holds canonical blocks, ensure it's the one requested
+	if data, _ := adb.Ancient(ethdb.FreezerHashTable, number); common.BytesToHash(data) != hash {
+		return nil
+	}
+	data, _ := adb.Ancient(kind, number)
+	return data
+}
+
 // GetCanonicalHash retrieves a hash assigned to a canonical block number.
 func GetCanonicalHash(db DatabaseReader, number uint64) common.Hash {
 	data, _ := db.Get(append(append(headerPrefix, encodeBlockNumber(number)...), numSuffix...))
+	if len(data) == 0 {
+		if adb, ok := db.(ethdb.AncientReader); ok {
+			data, _ = adb.Ancient(ethdb.FreezerHashTable, number)
+		}
+	}
 	if len(data) == 0 {
 		return common.Hash{}
 	}
@@ -150,6 +173,9 @@ func GetHeadFastBlockHash(db DatabaseReader) common.Hash {
 // if the header's not found.
 func GetHeaderRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
 	data, _ := db.Get(headerKey(hash, number))
+	if len(data) == 0 {
+		data = readAncient(db, ethdb.FreezerHeaderTable, hash, number)
+	}
 	return data
 }
 
@@ -171,6 +197,9 @@ func GetHeader(db DatabaseReader, hash common.Hash, number uint64) *types.Header
 // GetBodyRLP retrieves the block body (transactions and uncles) in RLP encoding.
 func GetBodyRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
 	data, _ := db.Get(blockBodyKey(hash, number))
+	if len(data) == 0 {
+		data = readAncient(db, ethdb.FreezerBodiesTable, hash, number)
+	}
 	return data
 }
 
@@ -182,6 +211,14 @@ func blockBodyKey(hash common.Hash, number uint64) []byte {
 	return append(append(bodyPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
 }
 
+func tdKey(hash common.Hash, number uint64) []byte {
+	return append(headerKey(hash, number), tdSuffix...)
+}
+
+func blockReceiptsKey(hash common.Hash, number uint64) []byte {
+	return append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
 // GetBody retrieves the block body (transactons, uncles) corresponding to the
 // hash, nil if none found.
 func GetBody(db DatabaseReader, hash common.Hash, number uint64) *types.Body {
@@ -200,7 +237,10 @@ func GetBody(db DatabaseReader, hash common.Hash, number uint64) *types.Body {
 // GetTd retrieves a block's total difficulty corresponding to the hash, nil if
 // none found.
 func GetTd(db DatabaseReader, hash common.Hash, number uint64) *big.Int {
-	data, _ := db.Get(append(append(append(headerPrefix, encodeBlockNumber(number)...), hash[:]...), tdSuffix...))
+	data, _ := db.Get(tdKey(hash, number))
+	if len(data) == 0 {
+		data = readAncient(db, ethdb.FreezerDifficultyTable, hash, number)
+	}
 	if len(data) == 0 {
 		return nil
 	}
@@ -232,10 +272,14 @@ func GetBlock(db DatabaseReader, hash common.Hash, number uint64) *types.Block {
 	return types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles)
 }
 
-// GetBlockReceipts retrieves the receipts generated by the transactions included
-// in a block given by its hash.
-func GetBlockReceipts(db DatabaseReader, hash common.Hash, number uint64) types.Receipts {
-	data, _ := db.Get(append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash[:]...))
+// GetRawBlockReceipts retrieves the receipts generated by the transactions included
+// in a block given by its hash, exactly as stored. The implementation fields and
+// log metadata are not derived.
+func GetRawBlockReceipts(db DatabaseReader, hash common.Hash, number uint64) types.Receipts {
+	data, _ := db.Get(blockReceiptsKey(hash, number))
+	if len(data) == 0 {
+		data = readAncient(db, ethdb.FreezerReceiptTable, hash, number)
+	}
 	if len(data) == 0 {
 		return nil
 	}
@@ -251,6 +295,25 @@ func GetBlockReceipts(db DatabaseReader, hash common.Hash, number uint64) types.
 	return receipts
 }
 
+// GetBlockReceipts retrieves the receipts generated by the transactions included
+// in a block given by its hash, along with the fields derived from the block body.
+func GetBlockReceipts(db DatabaseReader, hash common.Hash, number uint64, config *params.ChainConfig) types.Receipts {
+	receipts := GetRawBlockReceipts(db, hash, number)
+	if receipts == nil {
+		return nil
+	}
+	body := GetBody(db, hash, number)
+	if body == nil {
+		log.Error("Missing body but have receipts", "hash", hash, "number", number)
+		return nil
+	}
+	if err := receipts.DeriveFields(config, hash, number, body.Transactions); err != nil {
+		log.Error("Failed to derive block receipts fields", "hash", hash, "number", number, "err", err)
+		return nil
+	}
+	return receipts
+}
+
 // GetTxLookupEntry retrieves the positional metadata associated with a transaction
 // hash to allow retrieving the transaction or receipt by hash.
 func GetTxLookupEntry(db DatabaseReader, hash common.Hash) (common.Hash, uint64, uint64) {
@@ -305,12 +368,12 @@ func GetTransaction(db DatabaseReader, hash common.Hash) (*types.Transaction, co
 
 // GetReceipt retrieves a specific transaction receipt from the database, along with
 // its added positional metadata.
-func GetReceipt(db DatabaseReader, hash common.Hash) (*types.Receipt, common.Hash, uint64, uint64) {
+func GetReceipt(db DatabaseReader, hash common.Hash, config *params.ChainConfig) (*types.Receipt, common.Hash, uint64, uint64) {
 	// Retrieve the lookup metadata and resolve the receipt from the receipts
 	blockHash, blockNumber, receiptIndex := GetTxLookupEntry(db, hash)
 
 	if blockHash != (common.Hash{}) {
-		receipts := GetBlockReceipts(db, blockHash, blockNumber)
+		receipts := GetBlockReceipts(db, blockHash, blockNumber, config)
 		if len(receipts) <= int(receiptIndex) {
 			log.Error("Receipt refereced missing", "number", blockNumber, "hash", blockHash, "index", receiptIndex)
 			return nil, common.Hash{}, 0, 0
@@ -559,6 +622,27 @@ func WritePreimages(db ethdb.Database, number uint64, preimages map[common.Hash]
 	return nil
 }
 
+// GetTxIndexTail retrieves the number of the oldest block whose transaction
+// lookup entries are indexed, or nil if it's not tracked. Without a tracked tail,
+// the transactions of all blocks are indexed.
+func GetTxIndexTail(db DatabaseReader) *uint64 {
+	data, _ := db.Get(txIndexTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteTxIndexTail stores the number of the oldest block whose transaction
+// lookup entries are indexed.
+func WriteTxIndexTail(db ethdb.Putter, number uint64) error {
+	if err := db.Put(txIndexTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store transaction index tail", "err", err)
+	}
+	return nil
+}
+
 // GetBlockChainVersion reads the version number from db.
 func GetBlockChainVersion(db DatabaseReader) int {
 	var vsn uint
@@ -23,8 +23,10 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/crypto/sha3"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
@@ -331,10 +333,19 @@ func TestLookupStorage(t *testing.T) {
 	}
 }
 
-// Tests that receipts associated with a single block can be stored and retrieved.
+// Tests that receipts associated with a single block can be stored and retrieved,
+// and that their non-consensus fields are derived from the block body.
 func TestBlockReceiptStorage(t *testing.T) {
 	db, _ := ethdb.NewMemDatabase()
 
+	// Create a contract creation and a plain transfer to derive the receipts from
+	key, _ := crypto.GenerateKey()
+	signer := types.NewEIP155Signer(params.TestChainConfig.ChainId)
+
+	tx1, _ := types.SignTx(types.NewContractCreation(1, big.NewInt(1), 1, big.NewInt(1), nil), signer, key)
+	tx2, _ := types.SignTx(types.NewTransaction(2, common.HexToAddress("0x2"), big.NewInt(2), 2, big.NewInt(2), nil), signer, key)
+	body := &types.Body{Transactions: types.Transactions{tx1, tx2}}
+
 	receipt1 := &types.Receipt{
 		Status:            types.ReceiptStatusFailed,
 		CumulativeGasUsed: 1,
@@ -342,33 +353,48 @@ func TestBlockReceiptStorage(t *testing.T) {
 			{Address: common.BytesToAddress([]byte{0x11})},
 			{Address: common.BytesToAddress([]byte{0x01, 0x11})},
 		},
-		TxHash:          common.BytesToHash([]byte{0x11, 0x11}),
-		ContractAddress: common.BytesToAddress([]byte{0x01, 0x11, 0x11}),
-		GasUsed:         111111,
+		TxHash:          tx1.Hash(),
+		ContractAddress: crypto.CreateAddress(crypto.PubkeyToAddress(key.PublicKey), 1),
+		GasUsed:         1,
 	}
 	receipt2 := &types.Receipt{
 		PostState:         common.Hash{2}.Bytes(),
-		CumulativeGasUsed: 2,
+		CumulativeGasUsed: 3,
 		Logs: []*types.Log{
 			{Address: common.BytesToAddress([]byte{0x22})},
 			{Address: common.BytesToAddress([]byte{0x02, 0x22})},
 		},
-		TxHash:          common.BytesToHash([]byte{0x22, 0x22}),
-		ContractAddress: common.BytesToAddress([]byte{0x02, 0x22, 0x22}),
-		GasUsed:         222222,
+		TxHash:  tx2.Hash(),
+		GasUsed: 2,
 	}
 	receipts := []*types.Receipt{receipt1, receipt2}
 
 	// Check that no receipt entries are in a pristine database
 	hash := common.BytesToHash([]byte{0x03, 0x14})
-	if rs := GetBlockReceipts(db, hash, 0); len(rs) != 0 {
+	if rs := GetBlockReceipts(db, hash, 0, params.TestChainConfig); len(rs) != 0 {
 		t.Fatalf("non existent receipts returned: %v", rs)
 	}
-	// Insert the receipt slice into the database and check presence
+	// Insert the receipt slice into the database and check that only the consensus
+	// fields were stored
 	if err := WriteBlockReceipts(db, hash, 0, receipts); err != nil {
 		t.Fatalf("failed to write block receipts: %v", err)
 	}
-	if rs := GetBlockReceipts(db, hash, 0); len(rs) == 0 {
+	if rs := GetRawBlockReceipts(db, hash, 0); len(rs) != len(receipts) {
+		t.Fatalf("raw receipt count mismatch: have %d, want %d", len(rs), len(receipts))
+	} else {
+		for i, receipt := range rs {
+			if receipt.TxHash != (common.Hash{}) || receipt.GasUsed != 0 || receipt.Logs[0].TxHash != (common.Hash{}) {
+				t.Fatalf("receipt #%d: derived fields stored: %v", i, receipt)
+			}
+		}
+	}
+	// Receipts can't be derived without the block body
+	if rs := GetBlockReceipts(db, hash, 0, params.TestChainConfig); len(rs) != 0 {
+		t.Fatalf("receipts returned without body: %v", rs)
+	}
+	WriteBody(db, hash, 0, body)
+
+	if rs := GetBlockReceipts(db, hash, 0, params.TestChainConfig); len(rs) == 0 {
 		t.Fatalf("no receipts returned")
 	} else {
 		for i := 0; i < len(receipts); i++ {
@@ -378,11 +404,25 @@ func TestBlockReceiptStorage(t *testing.T) {
 			if !bytes.Equal(rlpHave, rlpWant) {
 				t.Fatalf("receipt #%d: receipt mismatch: have %v, want %v", i, rs[i], receipts[i])
 			}
+			if rs[i].TxHash != receipts[i].TxHash {
+				t.Errorf("receipt #%d: tx hash mismatch: have %x, want %x", i, rs[i].TxHash, receipts[i].TxHash)
+			}
+			if rs[i].ContractAddress != receipts[i].ContractAddress {
+				t.Errorf("receipt #%d: contract address mismatch: have %x, want %x", i, rs[i].ContractAddress, receipts[i].ContractAddress)
+			}
+			if rs[i].GasUsed != receipts[i].GasUsed {
+				t.Errorf("receipt #%d: gas used mismatch: have %d, want %d", i, rs[i].GasUsed, receipts[i].GasUsed)
+			}
+			for j, log := range rs[i].Logs {
+				if log.BlockHash != hash || log.TxHash != receipts[i].TxHash || log.TxIndex != uint(i) || log.Index != uint(2*i+j) {
+					t.Errorf("receipt #%d: log #%d: metadata mismatch: %v", i, j, log)
+				}
+			}
 		}
 	}
 	// Delete the receipt slice and check purge
 	DeleteBlockReceipts(db, hash, 0)
-	if rs := GetBlockReceipts(db, hash, 0); len(rs) != 0 {
+	if rs := GetBlockReceipts(db, hash, 0, params.TestChainConfig); len(rs) != 0 {
 		t.Fatalf("deleted receipts returned: %v", rs)
 	}
 }
@@ -24,6 +24,18 @@ import (
 // TxPreEvent is posted when a transaction enters the transaction pool.
 type TxPreEvent struct{ Tx *types.Transaction }
 
+// ShardTxPreEvent is posted when a transaction enters the shard transaction pool.
+type ShardTxPreEvent struct {
+	ShardID uint64
+	Tx      *types.Transaction
+}
+
+// ShardHeadEvent is posted when the canonical head of a shard changes.
+type ShardHeadEvent struct {
+	ShardID uint64
+	Hash    common.Hash
+}
+
 // PendingLogsEvent is posted pre mining and notifies of pending logs.
 type PendingLogsEvent struct {
 	Logs []*types.Log
@@ -23,6 +23,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 // ChainContext supports retrieving headers and consensus parameters from the
@@ -58,6 +59,26 @@ func NewEVMContext(msg Message, header *types.Header, chain ChainContext, author
 	}
 }
 
+// NewShardEVMContext creates a new context for executing a transaction of a
+// shard collation. Collations carry no timestamp or difficulty and there are no
+// block hashes to look up, the period stands in for the block number.
+func NewShardEVMContext(msg Message, shardID, period *big.Int, proposer common.Address) vm.Context {
+	return vm.Context{
+		CanTransfer: CanTransfer,
+		Transfer:    Transfer,
+		GetHash:     func(uint64) common.Hash { return common.Hash{} },
+		Origin:      msg.From(),
+		Coinbase:    proposer,
+		BlockNumber: new(big.Int).Set(period),
+		Time:        new(big.Int),
+		Difficulty:  new(big.Int),
+		GasLimit:    params.CollationGasLimit,
+		GasPrice:    new(big.Int).Set(msg.GasPrice()),
+		ShardID:     new(big.Int).Set(shardID),
+		Period:      new(big.Int).Set(period),
+	}
+}
+
 // GetHashFn returns a GetHashFunc which retrieves header hashes by number
 func GetHashFn(ref *types.Header, chain ChainContext) func(n uint64) common.Hash {
 	return func(n uint64) common.Hash {
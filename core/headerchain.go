@@ -366,8 +366,10 @@ func (hc *HeaderChain) HasHeader(hash common.Hash, number uint64) bool {
 	if hc.numberCache.Contains(hash) || hc.headerCache.Contains(hash) {
 		return true
 	}
-	ok, _ := hc.chainDb.Has(headerKey(hash, number))
-	return ok
+	if ok, _ := hc.chainDb.Has(headerKey(hash, number)); ok {
+		return true
+	}
+	return len(readAncient(hc.chainDb, ethdb.FreezerHashTable, hash, number)) > 0
 }
 
 // GetHeaderByNumber retrieves a block header from the database by number,
@@ -421,6 +423,12 @@ func (hc *HeaderChain) SetHead(head uint64, delFn DeleteCallback) {
 	for i := height; i > head; i-- {
 		DeleteCanonicalHash(hc.chainDb, i)
 	}
+	// Drop any frozen blocks above the new head from the ancient store
+	if adb, ok := hc.chainDb.(ethdb.AncientStore); ok {
+		if err := adb.TruncateAncients(head + 1); err != nil {
+			log.Crit("Failed to truncate ancient store", "err", err)
+		}
+	}
 	// Clear out any stale content from the caches
 	hc.headerCache.Purge()
 	hc.tdCache.Purge()
@@ -0,0 +1,796 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
+)
+
+const (
+	// shardHeadChanSize is the size of channel listening to ShardHeadEvent.
+	shardHeadChanSize = 64
+)
+
+// ErrUnknownShard is returned if a transaction is targeted at a shard outside
+// of the range accepted by the shard transaction pool.
+var ErrUnknownShard = errors.New("unknown shard")
+
+// ShardChain provides the state of the shard chains to do some pre checks in
+// the shard transaction pool and event subscribers.
+type ShardChain interface {
+	// ShardState retrieves the state of a shard at its current canonical head.
+	ShardState(shardID uint64) (*state.StateDB, error)
+
+	SubscribeShardHeadEvent(ch chan<- ShardHeadEvent) event.Subscription
+}
+
+// ShardTxPool contains all currently known transactions targeted at shards.
+// It maintains a separate transaction pool for every shard, each validated
+// against the state of its own shard and limited by the slot allowances of the
+// pool configuration. Transactions have to be signed for the shard they are
+// submitted to, see types.ShardSigner.
+//
+// Shards are tracked lazily: the pool of a shard is created when the first
+// transaction targeted at it arrives.
+type ShardTxPool struct {
+	config       TxPoolConfig
+	chainconfig  *params.ChainConfig
+	chain        ShardChain
+	shardCount   uint64
+	gasPrice     *big.Int
+	txFeed       event.Feed
+	scope        event.SubscriptionScope
+	shardHeadCh  chan ShardHeadEvent
+	shardHeadSub event.Subscription
+	mu           sync.RWMutex
+
+	locals *accountSet             // Set of local accounts to exempt from eviction rules
+	shards map[uint64]*shardTxList // Transaction pools of the tracked shards
+
+	wg sync.WaitGroup // for shutdown sync
+}
+
+// shardTxList is the transaction pool of a single shard.
+type shardTxList struct {
+	signer       types.Signer        // Signer of the transactions targeted at the shard
+	locals       *accountSet         // Local accounts of the pool, deriving senders with the shard signer
+	currentState *state.StateDB      // Current state in the shard head
+	pendingState *state.ManagedState // Pending state tracking virtual nonces
+	journal      *txJournal          // Journal of local transaction to back up to disk
+
+	pending map[common.Address]*txList         // All currently processable transactions
+	queue   map[common.Address]*txList         // Queued but non-processable transactions
+	beats   map[common.Address]time.Time       // Last heartbeat from each known account
+	all     map[common.Hash]*types.Transaction // All transactions to allow lookups
+	priced  *txPricedList                      // All transactions sorted by price
+}
+
+// NewShardTxPool creates a new shard transaction pool accepting transactions for
+// the first shardCount shards. The slot limits of the configuration are enforced
+// per shard.
+func NewShardTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain ShardChain, shardCount uint64) *ShardTxPool {
+	// Sanitize the input to ensure no vulnerable gas prices are set
+	config = (&config).sanitize()
+
+	// Create the transaction pool with its initial settings
+	pool := &ShardTxPool{
+		config:      config,
+		chainconfig: chainconfig,
+		chain:       chain,
+		shardCount:  shardCount,
+		shards:      make(map[uint64]*shardTxList),
+		shardHeadCh: make(chan ShardHeadEvent, shardHeadChanSize),
+		gasPrice:    new(big.Int).SetUint64(config.PriceLimit),
+	}
+	pool.locals = newAccountSet(nil) // senders are derived through the shard views
+
+	// If local transactions and journaling is enabled, load from disk
+	if !config.NoLocals && config.Journal != "" {
+		for shardID := uint64(0); shardID < shardCount; shardID++ {
+			journal := newTxJournal(shardJournalPath(config.Journal, shardID))
+			if !common.FileExist(journal.path) {
+				continue
+			}
+			shard := pool.shard(shardID)
+			if shard == nil {
+				continue
+			}
+			shard.journal = journal
+
+			add := func(tx *types.Transaction) error { return pool.AddLocal(shardID, tx) }
+			if err := journal.load(add); err != nil {
+				log.Warn("Failed to load shard transaction journal", "shard", shardID, "err", err)
+			}
+			if err := journal.rotate(pool.local(shard)); err != nil {
+				log.Warn("Failed to rotate shard transaction journal", "shard", shardID, "err", err)
+			}
+		}
+	}
+	// Subscribe events from the shard chains
+	pool.shardHeadSub = pool.chain.SubscribeShardHeadEvent(pool.shardHeadCh)
+
+	// Start the event loop and return
+	pool.wg.Add(1)
+	go pool.loop()
+
+	return pool
+}
+
+// shardJournalPath returns the path of the transaction journal of a shard.
+func shardJournalPath(path string, shardID uint64) string {
+	return path + "." + strconv.FormatUint(shardID, 10)
+}
+
+// loop is the shard transaction pool's main event loop, waiting for and reacting
+// to shard head events as well as for transaction eviction and journaling.
+func (pool *ShardTxPool) loop() {
+	defer pool.wg.Done()
+
+	evict := time.NewTicker(evictionInterval)
+	defer evict.Stop()
+
+	journal := time.NewTicker(pool.config.Rejournal)
+	defer journal.Stop()
+
+	// Keep waiting for and reacting to the various events
+	for {
+		select {
+		// Handle ShardHeadEvent
+		case ev := <-pool.shardHeadCh:
+			pool.mu.Lock()
+			if shard := pool.shards[ev.ShardID]; shard != nil {
+				pool.reset(ev.ShardID, shard)
+			}
+			pool.mu.Unlock()
+
+		// Be unsubscribed due to system stopped
+		case <-pool.shardHeadSub.Err():
+			return
+
+		// Handle inactive account transaction eviction
+		case <-evict.C:
+			pool.mu.Lock()
+			for _, shard := range pool.shards {
+				for addr := range shard.queue {
+					// Skip local transactions from the eviction mechanism
+					if pool.locals.contains(addr) {
+						continue
+					}
+					// Any non-locals old enough should be removed
+					if time.Since(shard.beats[addr]) > pool.config.Lifetime {
+						for _, tx := range shard.queue[addr].Flatten() {
+							pool.removeTx(shard, tx.Hash())
+						}
+					}
+				}
+			}
+			pool.mu.Unlock()
+
+		// Handle local transaction journal rotation
+		case <-journal.C:
+			pool.mu.Lock()
+			for shardID, shard := range pool.shards {
+				if shard.journal == nil {
+					continue
+				}
+				if err := shard.journal.rotate(pool.local(shard)); err != nil {
+					log.Warn("Failed to rotate shard transaction journal", "shard", shardID, "err", err)
+				}
+			}
+			pool.mu.Unlock()
+		}
+	}
+}
+
+// shard retrieves the transaction pool of a shard, creating it if the shard is
+// not tracked yet. Nil is returned if the state of the shard is unavailable.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *ShardTxPool) shard(shardID uint64) *shardTxList {
+	if shard := pool.shards[shardID]; shard != nil {
+		return shard
+	}
+	shard := &shardTxList{
+		signer:  types.NewShardSigner(pool.chainconfig.ChainId, new(big.Int).SetUint64(shardID)),
+		pending: make(map[common.Address]*txList),
+		queue:   make(map[common.Address]*txList),
+		beats:   make(map[common.Address]time.Time),
+		all:     make(map[common.Hash]*types.Transaction),
+	}
+	shard.locals = &accountSet{accounts: pool.locals.accounts, signer: shard.signer}
+	shard.priced = newTxPricedList(&shard.all)
+
+	if !pool.reset(shardID, shard) {
+		return nil
+	}
+	pool.shards[shardID] = shard
+	return shard
+}
+
+// reset retrieves the current state of a shard and ensures the content of its
+// transaction pool is valid with regard to it.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *ShardTxPool) reset(shardID uint64, shard *shardTxList) bool {
+	statedb, err := pool.chain.ShardState(shardID)
+	if err != nil {
+		log.Error("Failed to reset shard txpool state", "shard", shardID, "err", err)
+		return false
+	}
+	shard.currentState = statedb
+	shard.pendingState = state.ManageState(statedb)
+
+	// Remove any transactions included in the shard or invalidated by it
+	pool.demoteUnexecutables(shard)
+
+	// Update all accounts to the latest known pending nonce
+	for addr, list := range shard.pending {
+		txs := list.Flatten()
+		shard.pendingState.SetNonce(addr, txs[len(txs)-1].Nonce()+1)
+	}
+	// Check the queue and move transactions over to the pending if possible
+	// or remove those that have become invalid
+	pool.promoteExecutables(shardID, shard, nil)
+	return true
+}
+
+// Stop terminates the shard transaction pool.
+func (pool *ShardTxPool) Stop() {
+	// Unsubscribe all subscriptions registered from txpool
+	pool.scope.Close()
+
+	// Unsubscribe subscriptions registered from the shard chains
+	pool.shardHeadSub.Unsubscribe()
+	pool.wg.Wait()
+
+	for _, shard := range pool.shards {
+		if shard.journal != nil {
+			shard.journal.close()
+		}
+	}
+	log.Info("Shard transaction pool stopped")
+}
+
+// SubscribeShardTxPreEvent registers a subscription of ShardTxPreEvent and
+// starts sending event to the given channel.
+func (pool *ShardTxPool) SubscribeShardTxPreEvent(ch chan<- ShardTxPreEvent) event.Subscription {
+	return pool.scope.Track(pool.txFeed.Subscribe(ch))
+}
+
+// Stats retrieves the current stats of a shard's pool, namely the number of
+// pending and the number of queued (non-executable) transactions.
+func (pool *ShardTxPool) Stats(shardID uint64) (int, int) {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	shard := pool.shards[shardID]
+	if shard == nil {
+		return 0, 0
+	}
+	pending := 0
+	for _, list := range shard.pending {
+		pending += list.Len()
+	}
+	queued := 0
+	for _, list := range shard.queue {
+		queued += list.Len()
+	}
+	return pending, queued
+}
+
+// Pending retrieves all currently processable transactions of a shard, groupped
+// by origin account and sorted by nonce. The returned transaction set is a copy
+// and can be freely modified by calling code.
+func (pool *ShardTxPool) Pending(shardID uint64) (map[common.Address]types.Transactions, error) {
+	if shardID >= pool.shardCount {
+		return nil, ErrUnknownShard
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pending := make(map[common.Address]types.Transactions)
+	if shard := pool.shards[shardID]; shard != nil {
+		for addr, list := range shard.pending {
+			pending[addr] = list.Flatten()
+		}
+	}
+	return pending, nil
+}
+
+// Get returns a transaction of a shard if it is contained in the pool and nil
+// otherwise.
+func (pool *ShardTxPool) Get(shardID uint64, hash common.Hash) *types.Transaction {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	if shard := pool.shards[shardID]; shard != nil {
+		return shard.all[hash]
+	}
+	return nil
+}
+
+// local retrieves all currently known local transactions of a shard, groupped
+// by origin account and sorted by nonce.
+func (pool *ShardTxPool) local(shard *shardTxList) map[common.Address]types.Transactions {
+	txs := make(map[common.Address]types.Transactions)
+	for addr := range pool.locals.accounts {
+		if pending := shard.pending[addr]; pending != nil {
+			txs[addr] = append(txs[addr], pending.Flatten()...)
+		}
+		if queued := shard.queue[addr]; queued != nil {
+			txs[addr] = append(txs[addr], queued.Flatten()...)
+		}
+	}
+	return txs
+}
+
+// validateTx checks whether a transaction is valid according to the consensus
+// rules of its shard and adheres to some heuristic limits of the local node.
+func (pool *ShardTxPool) validateTx(shard *shardTxList, tx *types.Transaction, local bool) error {
+	// Heuristic limit, reject transactions over 32KB to prevent DOS attacks
+	if tx.Size() > 32*1024 {
+		return ErrOversizedData
+	}
+	// Transactions can't be negative. This may never happen using RLP decoded
+	// transactions but may occur if you create a transaction using the RPC.
+	if tx.Value().Sign() < 0 {
+		return ErrNegativeValue
+	}
+	// Ensure the transaction fits into a collation
+	if params.CollationGasLimit < tx.Gas() {
+		return ErrGasLimit
+	}
+	// Make sure the transaction is signed properly
+	from, err := types.Sender(shard.signer, tx)
+	if err != nil {
+		return ErrInvalidSender
+	}
+	// Drop non-local transactions under our own minimal accepted gas price
+	local = local || pool.locals.contains(from) // account may be local even if the transaction arrived from the network
+	if !local && pool.gasPrice.Cmp(tx.GasPrice()) > 0 {
+		return ErrUnderpriced
+	}
+	// Ensure the transaction adheres to nonce ordering within the shard
+	if shard.currentState.GetNonce(from) > tx.Nonce() {
+		return ErrNonceTooLow
+	}
+	// Transactor should have enough funds on the shard to cover the costs
+	// cost == V + GP * GL
+	if shard.currentState.GetBalance(from).Cmp(tx.Cost()) < 0 {
+		return ErrInsufficientFunds
+	}
+	intrGas, err := IntrinsicGas(tx.Data(), tx.To() == nil, true)
+	if err != nil {
+		return err
+	}
+	if tx.Gas() < intrGas {
+		return ErrIntrinsicGas
+	}
+	return nil
+}
+
+// add validates a transaction and inserts it into the non-executable queue of
+// its shard for later pending promotion and execution. If the transaction is a
+// replacement for an already pending or queued one, it overwrites the previous
+// and returns this so outer code doesn't uselessly call promote.
+func (pool *ShardTxPool) add(shardID uint64, tx *types.Transaction, local bool) (bool, error) {
+	if shardID >= pool.shardCount {
+		return false, ErrUnknownShard
+	}
+	shard := pool.shard(shardID)
+	if shard == nil {
+		return false, fmt.Errorf("shard %d state unavailable", shardID)
+	}
+	// If the transaction is already known, discard it
+	hash := tx.Hash()
+	if shard.all[hash] != nil {
+		log.Trace("Discarding already known shard transaction", "shard", shardID, "hash", hash)
+		return false, fmt.Errorf("known transaction: %x", hash)
+	}
+	// If the transaction fails basic validation, discard it
+	if err := pool.validateTx(shard, tx, local); err != nil {
+		log.Trace("Discarding invalid shard transaction", "shard", shardID, "hash", hash, "err", err)
+		return false, err
+	}
+	// If the shard's pool is full, discard underpriced transactions
+	if uint64(len(shard.all)) >= pool.config.GlobalSlots+pool.config.GlobalQueue {
+		// If the new transaction is underpriced, don't accept it
+		if shard.priced.Underpriced(tx, shard.locals) {
+			log.Trace("Discarding underpriced shard transaction", "shard", shardID, "hash", hash, "price", tx.GasPrice())
+			return false, ErrUnderpriced
+		}
+		// New transaction is better than our worse ones, make room for it
+		drop := shard.priced.Discard(len(shard.all)-int(pool.config.GlobalSlots+pool.config.GlobalQueue-1), shard.locals)
+		for _, tx := range drop {
+			log.Trace("Discarding freshly underpriced shard transaction", "shard", shardID, "hash", tx.Hash(), "price", tx.GasPrice())
+			pool.removeTx(shard, tx.Hash())
+		}
+	}
+	// If the transaction is replacing an already pending one, do directly
+	from, _ := types.Sender(shard.signer, tx) // already validated
+	if list := shard.pending[from]; list != nil && list.Overlaps(tx) {
+		// Nonce already pending, check if required price bump is met
+		inserted, old := list.Add(tx, pool.config.PriceBump)
+		if !inserted {
+			return false, ErrReplaceUnderpriced
+		}
+		// New transaction is better, replace old one
+		if old != nil {
+			delete(shard.all, old.Hash())
+			shard.priced.Removed()
+		}
+		shard.all[tx.Hash()] = tx
+		shard.priced.Put(tx)
+		pool.journalTx(shardID, shard, from, tx)
+
+		log.Trace("Pooled new executable shard transaction", "shard", shardID, "hash", hash, "from", from, "to", tx.To())
+
+		// We've directly injected a replacement transaction, notify subsystems
+		go pool.txFeed.Send(ShardTxPreEvent{shardID, tx})
+
+		return old != nil, nil
+	}
+	// New transaction isn't replacing a pending one, push into queue
+	replace, err := pool.enqueueTx(shard, hash, tx)
+	if err != nil {
+		return false, err
+	}
+	// Mark local addresses and journal local transactions
+	if local {
+		pool.locals.add(from)
+	}
+	pool.journalTx(shardID, shard, from, tx)
+
+	log.Trace("Pooled new future shard transaction", "shard", shardID, "hash", hash, "from", from, "to", tx.To())
+	return replace, nil
+}
+
+// enqueueTx inserts a new transaction into the non-executable transaction queue
+// of a shard.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *ShardTxPool) enqueueTx(shard *shardTxList, hash common.Hash, tx *types.Transaction) (bool, error) {
+	// Try to insert the transaction into the future queue
+	from, _ := types.Sender(shard.signer, tx) // already validated
+	if shard.queue[from] == nil {
+		shard.queue[from] = newTxList(false)
+	}
+	inserted, old := shard.queue[from].Add(tx, pool.config.PriceBump)
+	if !inserted {
+		// An older transaction was better, discard this
+		return false, ErrReplaceUnderpriced
+	}
+	// Discard any previous transaction and mark this
+	if old != nil {
+		delete(shard.all, old.Hash())
+		shard.priced.Removed()
+	}
+	shard.all[hash] = tx
+	shard.priced.Put(tx)
+	return old != nil, nil
+}
+
+// journalTx adds the specified transaction to the local disk journal of its
+// shard if it is deemed to have been sent from a local account.
+func (pool *ShardTxPool) journalTx(shardID uint64, shard *shardTxList, from common.Address, tx *types.Transaction) {
+	// Only journal if it's enabled and the transaction is local
+	if pool.config.NoLocals || pool.config.Journal == "" || !pool.locals.contains(from) {
+		return
+	}
+	// Open the shard's journal on its first local transaction
+	if shard.journal == nil {
+		shard.journal = newTxJournal(shardJournalPath(pool.config.Journal, shardID))
+		if err := shard.journal.rotate(pool.local(shard)); err != nil {
+			log.Warn("Failed to rotate shard transaction journal", "shard", shardID, "err", err)
+		}
+		return // The rotation already journaled the transaction
+	}
+	if err := shard.journal.insert(tx); err != nil {
+		log.Warn("Failed to journal local shard transaction", "shard", shardID, "err", err)
+	}
+}
+
+// promoteTx adds a transaction to the pending (processable) list of
+// transactions of a shard.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *ShardTxPool) promoteTx(shardID uint64, shard *shardTxList, addr common.Address, hash common.Hash, tx *types.Transaction) {
+	// Try to insert the transaction into the pending queue
+	if shard.pending[addr] == nil {
+		shard.pending[addr] = newTxList(true)
+	}
+	list := shard.pending[addr]
+
+	inserted, old := list.Add(tx, pool.config.PriceBump)
+	if !inserted {
+		// An older transaction was better, discard this
+		delete(shard.all, hash)
+		shard.priced.Removed()
+		return
+	}
+	// Otherwise discard any previous transaction and mark this
+	if old != nil {
+		delete(shard.all, old.Hash())
+		shard.priced.Removed()
+	}
+	// Set the potentially new pending nonce and notify any subsystems of the new tx
+	shard.beats[addr] = time.Now()
+	shard.pendingState.SetNonce(addr, tx.Nonce()+1)
+
+	go pool.txFeed.Send(ShardTxPreEvent{shardID, tx})
+}
+
+// AddLocal enqueues a single transaction into the pool of a shard if it is
+// valid, marking the sender as a local one in the mean time, ensuring it goes
+// around the local pricing constraints.
+func (pool *ShardTxPool) AddLocal(shardID uint64, tx *types.Transaction) error {
+	errs := pool.addTxs(shardID, []*types.Transaction{tx}, !pool.config.NoLocals)
+	return errs[0]
+}
+
+// AddRemote enqueues a single transaction into the pool of a shard if it is
+// valid. If the sender is not among the locally tracked ones, full pricing
+// constraints will apply.
+func (pool *ShardTxPool) AddRemote(shardID uint64, tx *types.Transaction) error {
+	errs := pool.addTxs(shardID, []*types.Transaction{tx}, false)
+	return errs[0]
+}
+
+// AddRemotes enqueues a batch of transactions into the pool of a shard if they
+// are valid. If the senders are not among the locally tracked ones, full pricing
+// constraints will apply.
+func (pool *ShardTxPool) AddRemotes(shardID uint64, txs []*types.Transaction) []error {
+	return pool.addTxs(shardID, txs, false)
+}
+
+// addTxs attempts to queue a batch of transactions into the pool of a shard if
+// they are valid.
+func (pool *ShardTxPool) addTxs(shardID uint64, txs []*types.Transaction, local bool) []error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	// Add the batch of transaction, tracking the accepted ones
+	dirty := make(map[common.Address]struct{})
+	errs := make([]error, len(txs))
+
+	for i, tx := range txs {
+		var replace bool
+		if replace, errs[i] = pool.add(shardID, tx, local); errs[i] == nil {
+			if !replace {
+				from, _ := types.Sender(pool.shards[shardID].signer, tx) // already validated
+				dirty[from] = struct{}{}
+			}
+		}
+	}
+	// Only reprocess the internal state if something was actually added
+	if len(dirty) > 0 {
+		addrs := make([]common.Address, 0, len(dirty))
+		for addr := range dirty {
+			addrs = append(addrs, addr)
+		}
+		pool.promoteExecutables(shardID, pool.shards[shardID], addrs)
+	}
+	return errs
+}
+
+// removeTx removes a single transaction from the pool of a shard, moving all
+// subsequent transactions back to the future queue.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *ShardTxPool) removeTx(shard *shardTxList, hash common.Hash) {
+	// Fetch the transaction we wish to delete
+	tx, ok := shard.all[hash]
+	if !ok {
+		return
+	}
+	addr, _ := types.Sender(shard.signer, tx) // already validated during insertion
+
+	// Remove it from the list of known transactions
+	delete(shard.all, hash)
+	shard.priced.Removed()
+
+	// Remove the transaction from the pending lists and reset the account nonce
+	if pending := shard.pending[addr]; pending != nil {
+		if removed, invalids := pending.Remove(tx); removed {
+			// If no more transactions are left, remove the list
+			if pending.Empty() {
+				delete(shard.pending, addr)
+				delete(shard.beats, addr)
+			} else {
+				// Otherwise postpone any invalidated transactions
+				for _, tx := range invalids {
+					pool.enqueueTx(shard, tx.Hash(), tx)
+				}
+			}
+			// Update the account nonce if needed
+			if nonce := tx.Nonce(); shard.pendingState.GetNonce(addr) > nonce {
+				shard.pendingState.SetNonce(addr, nonce)
+			}
+			return
+		}
+	}
+	// Transaction is in the future queue
+	if future := shard.queue[addr]; future != nil {
+		future.Remove(tx)
+		if future.Empty() {
+			delete(shard.queue, addr)
+		}
+	}
+}
+
+// promoteExecutables moves transactions that have become processable from the
+// future queue of a shard to its set of pending transactions. During this
+// process, all invalidated transactions (low nonce, low balance) are deleted
+// and the per shard slot limits are enforced.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *ShardTxPool) promoteExecutables(shardID uint64, shard *shardTxList, accounts []common.Address) {
+	// Gather all the accounts potentially needing updates
+	if accounts == nil {
+		accounts = make([]common.Address, 0, len(shard.queue))
+		for addr := range shard.queue {
+			accounts = append(accounts, addr)
+		}
+	}
+	// Iterate over all accounts and promote any executable transactions
+	for _, addr := range accounts {
+		list := shard.queue[addr]
+		if list == nil {
+			continue // Just in case someone calls with a non existing account
+		}
+		// Drop all transactions that are deemed too old (low nonce)
+		for _, tx := range list.Forward(shard.currentState.GetNonce(addr)) {
+			delete(shard.all, tx.Hash())
+			shard.priced.Removed()
+		}
+		// Drop all transactions that are too costly (low balance or out of gas)
+		drops, _ := list.Filter(shard.currentState.GetBalance(addr), params.CollationGasLimit)
+		for _, tx := range drops {
+			delete(shard.all, tx.Hash())
+			shard.priced.Removed()
+		}
+		// Gather all executable transactions and promote them
+		for _, tx := range list.Ready(shard.pendingState.GetNonce(addr)) {
+			pool.promoteTx(shardID, shard, addr, tx.Hash(), tx)
+		}
+		// Drop all transactions over the allowed limit
+		if !pool.locals.contains(addr) {
+			for _, tx := range list.Cap(int(pool.config.AccountQueue)) {
+				delete(shard.all, tx.Hash())
+				shard.priced.Removed()
+			}
+		}
+		// Delete the entire queue entry if it became empty.
+		if list.Empty() {
+			delete(shard.queue, addr)
+		}
+	}
+	// If the pending limit is overflown, trim the largest non-local accounts
+	// down to their guaranteed allowance
+	pending := uint64(0)
+	for _, list := range shard.pending {
+		pending += uint64(list.Len())
+	}
+	if pending > pool.config.GlobalSlots {
+		// Assemble a spam order to penalize large transactors first
+		spammers := prque.New()
+		for addr, list := range shard.pending {
+			if !pool.locals.contains(addr) && uint64(list.Len()) > pool.config.AccountSlots {
+				spammers.Push(addr, float32(list.Len()))
+			}
+		}
+		for pending > pool.config.GlobalSlots && !spammers.Empty() {
+			offender, _ := spammers.Pop()
+			addr := offender.(common.Address)
+			list := shard.pending[addr]
+
+			keep := int(pool.config.AccountSlots)
+			if excess := pending - pool.config.GlobalSlots; uint64(list.Len()-keep) > excess {
+				keep = list.Len() - int(excess)
+			}
+			for _, tx := range list.Cap(keep) {
+				delete(shard.all, tx.Hash())
+				shard.priced.Removed()
+
+				// Update the account nonce to the dropped transaction
+				if nonce := tx.Nonce(); shard.pendingState.GetNonce(addr) > nonce {
+					shard.pendingState.SetNonce(addr, nonce)
+				}
+				pending--
+			}
+		}
+	}
+	// If we've queued more transactions than the hard limit, drop oldest ones
+	queued := uint64(0)
+	for _, list := range shard.queue {
+		queued += uint64(list.Len())
+	}
+	if queued > pool.config.GlobalQueue {
+		// Sort all accounts with queued transactions by heartbeat
+		addresses := make(addresssByHeartbeat, 0, len(shard.queue))
+		for addr := range shard.queue {
+			if !pool.locals.contains(addr) { // don't drop locals
+				addresses = append(addresses, addressByHeartbeat{addr, shard.beats[addr]})
+			}
+		}
+		sort.Sort(addresses)
+
+		// Drop transactions until the total is below the limit or only locals remain
+		for drop := queued - pool.config.GlobalQueue; drop > 0 && len(addresses) > 0; {
+			addr := addresses[len(addresses)-1]
+			txs := shard.queue[addr.address].Flatten()
+
+			addresses = addresses[:len(addresses)-1]
+			for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
+				pool.removeTx(shard, txs[i].Hash())
+				drop--
+			}
+		}
+	}
+}
+
+// demoteUnexecutables removes invalid and processed transactions from the
+// executable/pending queue of a shard and any subsequent transactions that
+// become unexecutable are moved back into the future queue.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *ShardTxPool) demoteUnexecutables(shard *shardTxList) {
+	// Iterate over all accounts and demote any non-executable transactions
+	for addr, list := range shard.pending {
+		nonce := shard.currentState.GetNonce(addr)
+
+		// Drop all transactions that are deemed too old (low nonce)
+		for _, tx := range list.Forward(nonce) {
+			delete(shard.all, tx.Hash())
+			shard.priced.Removed()
+		}
+		// Drop all transactions that are too costly (low balance or out of gas), and queue any invalids back for later
+		drops, invalids := list.Filter(shard.currentState.GetBalance(addr), params.CollationGasLimit)
+		for _, tx := range drops {
+			delete(shard.all, tx.Hash())
+			shard.priced.Removed()
+		}
+		for _, tx := range invalids {
+			pool.enqueueTx(shard, tx.Hash(), tx)
+		}
+		// If there's a gap in front, postpone all transactions
+		if list.Len() > 0 && list.txs.Get(nonce) == nil {
+			for _, tx := range list.Cap(0) {
+				pool.enqueueTx(shard, tx.Hash(), tx)
+			}
+		}
+		// Delete the entire queue entry if it became empty.
+		if list.Empty() {
+			delete(shard.pending, addr)
+			delete(shard.beats, addr)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testShardCount is the number of shards the tested pools accept transactions for.
+const testShardCount = 4
+
+type testShardChain struct {
+	states        map[uint64]*state.StateDB
+	shardHeadFeed *event.Feed
+}
+
+func newTestShardChain() *testShardChain {
+	chain := &testShardChain{
+		states:        make(map[uint64]*state.StateDB),
+		shardHeadFeed: new(event.Feed),
+	}
+	for shard := uint64(0); shard < testShardCount; shard++ {
+		db, _ := ethdb.NewMemDatabase()
+		chain.states[shard], _ = state.New(common.Hash{}, state.NewDatabase(db))
+	}
+	return chain
+}
+
+func (sc *testShardChain) ShardState(shardID uint64) (*state.StateDB, error) {
+	statedb, ok := sc.states[shardID]
+	if !ok {
+		return nil, fmt.Errorf("unknown shard %d", shardID)
+	}
+	return statedb, nil
+}
+
+func (sc *testShardChain) SubscribeShardHeadEvent(ch chan<- ShardHeadEvent) event.Subscription {
+	return sc.shardHeadFeed.Subscribe(ch)
+}
+
+func setupShardTxPool() (*ShardTxPool, *testShardChain, *ecdsa.PrivateKey) {
+	chain := newTestShardChain()
+	key, _ := crypto.GenerateKey()
+	pool := NewShardTxPool(testTxPoolConfig, params.TestChainConfig, chain, testShardCount)
+
+	return pool, chain, key
+}
+
+// shardTransaction creates a transaction signed for the given shard of the test
+// chain configuration.
+func shardTransaction(shardID uint64, nonce uint64, gaslimit uint64, key *ecdsa.PrivateKey) *types.Transaction {
+	signer := types.NewShardSigner(params.TestChainConfig.ChainId, new(big.Int).SetUint64(shardID))
+	tx, _ := types.SignTx(types.NewTransaction(nonce, common.Address{}, big.NewInt(100), gaslimit, big.NewInt(1), nil), signer, key)
+	return tx
+}
+
+// validateShardTxPoolInternals checks various consistency invariants within the
+// pool of a shard.
+func validateShardTxPoolInternals(pool *ShardTxPool, shardID uint64) error {
+	pool.mu.RLock()
+	shard := pool.shards[shardID]
+	pool.mu.RUnlock()
+
+	if shard == nil {
+		return nil
+	}
+	pending, queued := pool.Stats(shardID)
+
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	if total := len(shard.all); total != pending+queued {
+		return fmt.Errorf("total transaction count %d != %d pending + %d queued", total, pending, queued)
+	}
+	if priced := shard.priced.items.Len() - shard.priced.stales; priced != pending+queued {
+		return fmt.Errorf("total priced transaction count %d != %d pending + %d queued", priced, pending, queued)
+	}
+	for addr, txs := range shard.pending {
+		var last uint64
+		for nonce := range txs.txs.items {
+			if last < nonce {
+				last = nonce
+			}
+		}
+		if nonce := shard.pendingState.GetNonce(addr); nonce != last+1 {
+			return fmt.Errorf("pending nonce mismatch: have %v, want %v", nonce, last+1)
+		}
+	}
+	return nil
+}
+
+// Tests that transactions are validated against the state of their own shard.
+func TestShardTxPoolValidation(t *testing.T) {
+	t.Parallel()
+
+	pool, chain, key := setupShardTxPool()
+	defer pool.Stop()
+
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	chain.states[1].AddBalance(addr, big.NewInt(1000000))
+
+	if err := pool.AddRemote(testShardCount, shardTransaction(testShardCount, 0, 100000, key)); err != ErrUnknownShard {
+		t.Errorf("out of range shard error mismatch: have %v, want %v", err, ErrUnknownShard)
+	}
+	if err := pool.AddRemote(0, shardTransaction(0, 0, 100000, key)); err != ErrInsufficientFunds {
+		t.Errorf("unfunded shard error mismatch: have %v, want %v", err, ErrInsufficientFunds)
+	}
+	if err := pool.AddRemote(1, shardTransaction(1, 0, 100000, key)); err != nil {
+		t.Errorf("failed to add transaction to funded shard: %v", err)
+	}
+	if err := pool.AddRemote(1, shardTransaction(1, 1, params.CollationGasLimit+1, key)); err != ErrGasLimit {
+		t.Errorf("collation gas limit error mismatch: have %v, want %v", err, ErrGasLimit)
+	}
+	if _, err := pool.Pending(testShardCount); err != ErrUnknownShard {
+		t.Errorf("out of range pending error mismatch: have %v, want %v", err, ErrUnknownShard)
+	}
+	for shard := uint64(0); shard < testShardCount; shard++ {
+		if err := validateShardTxPoolInternals(pool, shard); err != nil {
+			t.Fatalf("shard %d pool internal state corrupted: %v", shard, err)
+		}
+	}
+}
+
+// Tests that only transactions signed for the shard they are submitted to are
+// accepted, preventing replays from other shards and from the main chain.
+func TestShardTxPoolSigner(t *testing.T) {
+	t.Parallel()
+
+	pool, chain, key := setupShardTxPool()
+	defer pool.Stop()
+
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	chain.states[1].AddBalance(addr, big.NewInt(1000000))
+
+	main, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(100), 100000, big.NewInt(1), nil), types.NewEIP155Signer(params.TestChainConfig.ChainId), key)
+	for i, tx := range []*types.Transaction{shardTransaction(2, 0, 100000, key), main, transaction(0, 100000, key)} {
+		if err := pool.AddRemote(1, tx); err == nil {
+			t.Errorf("transaction %d: foreign transaction accepted", i)
+		}
+	}
+	if pending, queued := pool.Stats(1); pending+queued != 0 {
+		t.Errorf("foreign transactions pooled: %d pending, %d queued", pending, queued)
+	}
+	if err := pool.AddRemote(1, shardTransaction(1, 0, 100000, key)); err != nil {
+		t.Errorf("failed to add transaction signed for the shard: %v", err)
+	}
+}
+
+// Tests that nonces are tracked independently per shard and only executable
+// transactions are returned as pending.
+func TestShardTxPoolPending(t *testing.T) {
+	t.Parallel()
+
+	pool, chain, key := setupShardTxPool()
+	defer pool.Stop()
+
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	chain.states[1].AddBalance(addr, big.NewInt(1000000))
+	chain.states[2].AddBalance(addr, big.NewInt(1000000))
+	chain.states[2].SetNonce(addr, 5)
+
+	// Nonces 0, 1 and 3 on shard 1, with 3 being gapped
+	for _, nonce := range []uint64{0, 1, 3} {
+		if err := pool.AddRemote(1, shardTransaction(1, nonce, 100000, key)); err != nil {
+			t.Fatalf("failed to add transaction %d to shard 1: %v", nonce, err)
+		}
+	}
+	// Nonce 0 is stale on shard 2, nonce 5 executable
+	if err := pool.AddRemote(2, shardTransaction(2, 0, 100000, key)); err != ErrNonceTooLow {
+		t.Errorf("stale nonce error mismatch: have %v, want %v", err, ErrNonceTooLow)
+	}
+	if err := pool.AddRemote(2, shardTransaction(2, 5, 100000, key)); err != nil {
+		t.Fatalf("failed to add transaction to shard 2: %v", err)
+	}
+	if pending, queued := pool.Stats(1); pending != 2 || queued != 1 {
+		t.Errorf("shard 1 stats mismatch: have %d pending, %d queued, want 2, 1", pending, queued)
+	}
+	if pending, queued := pool.Stats(2); pending != 1 || queued != 0 {
+		t.Errorf("shard 2 stats mismatch: have %d pending, %d queued, want 1, 0", pending, queued)
+	}
+	pending, err := pool.Pending(1)
+	if err != nil {
+		t.Fatalf("failed to retrieve shard 1 pending transactions: %v", err)
+	}
+	if txs := pending[addr]; len(txs) != 2 || txs[0].Nonce() != 0 || txs[1].Nonce() != 1 {
+		t.Errorf("shard 1 pending transactions mismatch: %v", txs)
+	}
+	if pending, _ := pool.Pending(3); len(pending) != 0 {
+		t.Errorf("untouched shard has pending transactions: %v", pending)
+	}
+	for shard := uint64(0); shard < testShardCount; shard++ {
+		if err := validateShardTxPoolInternals(pool, shard); err != nil {
+			t.Fatalf("shard %d pool internal state corrupted: %v", shard, err)
+		}
+	}
+}
+
+// Tests that transactions included into a shard are removed from its pool when
+// the shard head changes, without affecting other shards.
+func TestShardTxPoolReset(t *testing.T) {
+	t.Parallel()
+
+	pool, chain, key := setupShardTxPool()
+	defer pool.Stop()
+
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	for shard := uint64(0); shard < 2; shard++ {
+		chain.states[shard].AddBalance(addr, big.NewInt(1000000))
+		for nonce := uint64(0); nonce < 3; nonce++ {
+			if err := pool.AddRemote(shard, shardTransaction(shard, nonce, 100000, key)); err != nil {
+				t.Fatalf("failed to add transaction %d to shard %d: %v", nonce, shard, err)
+			}
+		}
+	}
+	// Include the first two transactions into shard 0 and reset it
+	pool.mu.Lock()
+	chain.states[0].SetNonce(addr, 2)
+	pool.reset(0, pool.shards[0])
+	pool.mu.Unlock()
+
+	if pending, queued := pool.Stats(0); pending != 1 || queued != 0 {
+		t.Errorf("shard 0 stats mismatch: have %d pending, %d queued, want 1, 0", pending, queued)
+	}
+	if pending, queued := pool.Stats(1); pending != 3 || queued != 0 {
+		t.Errorf("shard 1 stats mismatch: have %d pending, %d queued, want 3, 0", pending, queued)
+	}
+	for shard := uint64(0); shard < testShardCount; shard++ {
+		if err := validateShardTxPoolInternals(pool, shard); err != nil {
+			t.Fatalf("shard %d pool internal state corrupted: %v", shard, err)
+		}
+	}
+}
+
+// Tests that the pending transactions of a shard are capped to the global slot
+// allowance, evicting the largest non-local accounts first.
+func TestShardTxPoolPendingLimiting(t *testing.T) {
+	t.Parallel()
+
+	chain := newTestShardChain()
+
+	config := testTxPoolConfig
+	config.AccountSlots = 2
+	config.GlobalSlots = 6
+
+	pool := NewShardTxPool(config, params.TestChainConfig, chain, testShardCount)
+	defer pool.Stop()
+
+	keys := make([]*ecdsa.PrivateKey, 2)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		chain.states[0].AddBalance(crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000))
+	}
+	for nonce := uint64(0); nonce < 5; nonce++ {
+		if err := pool.AddRemote(0, shardTransaction(0, nonce, 100000, keys[0])); err != nil {
+			t.Fatalf("failed to add transaction %d: %v", nonce, err)
+		}
+	}
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		if err := pool.AddRemote(0, shardTransaction(0, nonce, 100000, keys[1])); err != nil {
+			t.Fatalf("failed to add transaction %d: %v", nonce, err)
+		}
+	}
+	if pending, _ := pool.Stats(0); pending != int(config.GlobalSlots) {
+		t.Errorf("pending transaction count mismatch: have %d, want %d", pending, config.GlobalSlots)
+	}
+	if err := validateShardTxPoolInternals(pool, 0); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that local transactions are journaled per shard and reloaded into the
+// right shard after a restart.
+func TestShardTxPoolJournaling(t *testing.T) {
+	t.Parallel()
+
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary journal: %v", err)
+	}
+	journal := file.Name()
+	defer os.Remove(journal)
+
+	file.Close()
+	os.Remove(journal)
+
+	config := testTxPoolConfig
+	config.Journal = journal
+
+	chain := newTestShardChain()
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	chain.states[3].AddBalance(addr, big.NewInt(1000000))
+
+	pool := NewShardTxPool(config, params.TestChainConfig, chain, testShardCount)
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		if err := pool.AddLocal(3, shardTransaction(3, nonce, 100000, key)); err != nil {
+			t.Fatalf("failed to add local transaction %d: %v", nonce, err)
+		}
+	}
+	if err := pool.AddRemote(3, shardTransaction(3, 5, 100000, key)); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	pool.Stop()
+	defer os.Remove(shardJournalPath(journal, 3))
+
+	// Restart the pool and ensure the transactions are back on their shard
+	pool = NewShardTxPool(config, params.TestChainConfig, chain, testShardCount)
+	defer pool.Stop()
+
+	if pending, queued := pool.Stats(3); pending != 2 || queued != 1 {
+		t.Errorf("shard 3 stats mismatch: have %d pending, %d queued, want 2, 1", pending, queued)
+	}
+	for shard := uint64(0); shard < 3; shard++ {
+		if pending, queued := pool.Stats(shard); pending+queued != 0 {
+			t.Errorf("shard %d has journaled transactions: %d pending, %d queued", shard, pending, queued)
+		}
+	}
+	if err := validateShardTxPoolInternals(pool, 3); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// exportVersion is the version of the state export format, bumped on every
+// incompatible change.
+const exportVersion = 1
+
+var (
+	// exportChunkSize is the approximate amount of account, storage and code data
+	// bundled into a single chunk of a state export.
+	exportChunkSize = 4 * 1024 * 1024
+
+	// importFlushLeaves is the number of trie leaves inserted during a state import
+	// after which the tries being built are flushed to disk.
+	importFlushLeaves = 256 * 1024
+)
+
+// exportHeader is the first item of a state export, identifying the format and
+// the state contained within.
+type exportHeader struct {
+	Version uint64
+	Root    common.Hash
+}
+
+// exportChunk is a batch of accounts of a state export, ordered by their hash,
+// along with the contract codes first referenced by them. The storage of the last
+// account in a chunk may continue in the next one, in which case the account is
+// repeated there.
+type exportChunk struct {
+	Accounts []exportAccount
+	Codes    [][]byte
+}
+
+// exportAccount is an account of a state export, along with (a range of) its
+// storage slots, ordered by their hash.
+type exportAccount struct {
+	Hash     common.Hash
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+	Storage  []exportSlot
+}
+
+// exportSlot is a storage slot of a state export.
+type exportSlot struct {
+	Hash  common.Hash
+	Value []byte
+}
+
+// ExportState streams the entire state identified by root into w in a chunked
+// binary format: a header containing the state root, followed by RLP encoded
+// chunks of accounts, storage slots and contract codes. Keys are exported hashed,
+// as they are stored in the tries, so preimages are not needed.
+func ExportState(db Database, root common.Hash, w io.Writer) error {
+	tr, err := db.OpenTrie(root)
+	if err != nil {
+		return err
+	}
+	if err := rlp.Encode(w, &exportHeader{Version: exportVersion, Root: root}); err != nil {
+		return err
+	}
+	var (
+		chunk exportChunk
+		size  int
+		codes = make(map[common.Hash]struct{})
+
+		accounts, slots uint64
+		start           = time.Now()
+		logged          = time.Now()
+	)
+	flush := func() error {
+		if err := rlp.Encode(w, &chunk); err != nil {
+			return err
+		}
+		chunk, size = exportChunk{}, 0
+		return nil
+	}
+	it := trie.NewIterator(tr.NodeIterator(nil))
+	for it.Next() {
+		var data Account
+		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
+			return err
+		}
+		account := exportAccount{
+			Hash:     common.BytesToHash(it.Key),
+			Nonce:    data.Nonce,
+			Balance:  data.Balance,
+			Root:     data.Root,
+			CodeHash: data.CodeHash,
+		}
+		size += common.HashLength + len(it.Value)
+
+		// Bundle the contract code with the first account referencing it
+		if codeHash := common.BytesToHash(data.CodeHash); codeHash != emptyCode {
+			if _, ok := codes[codeHash]; !ok {
+				code, err := db.ContractCode(account.Hash, codeHash)
+				if err != nil {
+					return err
+				}
+				chunk.Codes = append(chunk.Codes, code)
+				size += len(code)
+				codes[codeHash] = struct{}{}
+			}
+		}
+		// Export the storage slots, splitting large storage tries across chunks
+		if data.Root != emptyState {
+			st, err := db.OpenStorageTrie(account.Hash, data.Root)
+			if err != nil {
+				return err
+			}
+			sit := trie.NewIterator(st.NodeIterator(nil))
+			for sit.Next() {
+				account.Storage = append(account.Storage, exportSlot{Hash: common.BytesToHash(sit.Key), Value: common.CopyBytes(sit.Value)})
+				size += common.HashLength + len(sit.Value)
+				slots++
+
+				if size >= exportChunkSize {
+					chunk.Accounts = append(chunk.Accounts, account)
+					if err := flush(); err != nil {
+						return err
+					}
+					account.Storage = nil
+				}
+			}
+			if sit.Err != nil {
+				return sit.Err
+			}
+		}
+		chunk.Accounts = append(chunk.Accounts, account)
+		accounts++
+
+		if size >= exportChunkSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting state", "accounts", accounts, "slots", slots, "codes", len(codes), "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if it.Err != nil {
+		return it.Err
+	}
+	if len(chunk.Accounts) > 0 || len(chunk.Codes) > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+	log.Info("Exported state", "root", root, "accounts", accounts, "slots", slots, "codes", len(codes), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// ImportState rebuilds a state exported by ExportState from r into db, verifying
+// every storage root and finally the state root recorded in the export. Returns
+// the root of the imported state.
+//
+// Tries are flushed to disk while they are built, so a failed import may leave
+// some unreferenced trie nodes behind in the database.
+func ImportState(db ethdb.Database, r io.Reader) (common.Hash, error) {
+	stream := rlp.NewStream(r, 0)
+
+	var header exportHeader
+	if err := stream.Decode(&header); err != nil {
+		return common.Hash{}, fmt.Errorf("invalid state export header: %v", err)
+	}
+	if header.Version != exportVersion {
+		return common.Hash{}, fmt.Errorf("unsupported state export version %d, want %d", header.Version, exportVersion)
+	}
+	imp, err := newStateImporter(db)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	for n := 0; ; n++ {
+		var chunk exportChunk
+		if err := stream.Decode(&chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			return common.Hash{}, fmt.Errorf("invalid state export chunk %d: %v", n, err)
+		}
+		if err := imp.process(&chunk); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	root, err := imp.finish()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if root != header.Root {
+		return common.Hash{}, fmt.Errorf("state root mismatch: have %x, want %x", root, header.Root)
+	}
+	log.Info("Imported state", "root", root, "accounts", imp.accounts, "slots", imp.slots, "codes", len(imp.codes), "elapsed", common.PrettyDuration(time.Since(imp.start)))
+	return root, nil
+}
+
+// stateImporter rebuilds the tries of a state from the ordered accounts and
+// storage slots of a state export.
+type stateImporter struct {
+	diskdb ethdb.Database
+	batch  ethdb.Batch    // Batch of contract codes to write
+	triedb *trie.Database // Intermediate trie node cache of the tries being built
+
+	accTrie *trie.Trie     // Account trie being built
+	account *exportAccount // Account whose storage is being imported
+	storage *trie.Trie     // Storage trie of the account being imported
+	pending int            // Number of leaves inserted since the last flush
+
+	codes           map[common.Hash]struct{} // Contract codes imported so far
+	accounts, slots uint64
+	start, logged   time.Time
+}
+
+// newStateImporter creates an importer building a new state in db.
+func newStateImporter(db ethdb.Database) (*stateImporter, error) {
+	triedb := trie.NewDatabase(db)
+	accTrie, err := trie.New(common.Hash{}, triedb)
+	if err != nil {
+		return nil, err
+	}
+	return &stateImporter{
+		diskdb:  db,
+		batch:   db.NewBatch(),
+		triedb:  triedb,
+		accTrie: accTrie,
+		codes:   make(map[common.Hash]struct{}),
+		start:   time.Now(),
+		logged:  time.Now(),
+	}, nil
+}
+
+// process imports the codes, accounts and storage slots of a chunk.
+func (imp *stateImporter) process(chunk *exportChunk) error {
+	for _, code := range chunk.Codes {
+		hash := crypto.Keccak256Hash(code)
+		if err := imp.batch.Put(hash[:], code); err != nil {
+			return err
+		}
+		imp.codes[hash] = struct{}{}
+	}
+	for i := range chunk.Accounts {
+		account := &chunk.Accounts[i]
+
+		// Finish the previous account unless its storage is continued
+		if imp.account == nil || imp.account.Hash != account.Hash {
+			if imp.account != nil {
+				if bytes.Compare(account.Hash[:], imp.account.Hash[:]) <= 0 {
+					return fmt.Errorf("unordered account %x after %x", account.Hash, imp.account.Hash)
+				}
+				if err := imp.finishAccount(); err != nil {
+					return err
+				}
+			}
+			storage, err := trie.New(common.Hash{}, imp.triedb)
+			if err != nil {
+				return err
+			}
+			imp.account, imp.storage = account, storage
+		}
+		for _, slot := range account.Storage {
+			if err := imp.storage.TryUpdate(slot.Hash[:], slot.Value); err != nil {
+				return err
+			}
+			imp.slots++
+			if imp.pending++; imp.pending >= importFlushLeaves {
+				if err := imp.flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if time.Since(imp.logged) > 8*time.Second {
+			log.Info("Importing state", "accounts", imp.accounts, "slots", imp.slots, "codes", len(imp.codes), "elapsed", common.PrettyDuration(time.Since(imp.start)))
+			imp.logged = time.Now()
+		}
+	}
+	return nil
+}
+
+// finishAccount verifies the storage root and code of the account being imported
+// and inserts it into the account trie.
+func (imp *stateImporter) finishAccount() error {
+	account := imp.account
+
+	root, err := imp.storage.Commit(nil)
+	if err != nil {
+		return err
+	}
+	if root != account.Root {
+		return fmt.Errorf("storage root mismatch for account %x: have %x, want %x", account.Hash, root, account.Root)
+	}
+	if codeHash := common.BytesToHash(account.CodeHash); codeHash != emptyCode {
+		if _, ok := imp.codes[codeHash]; !ok {
+			return fmt.Errorf("missing code %x of account %x", codeHash, account.Hash)
+		}
+	}
+	blob, err := rlp.EncodeToBytes(&Account{
+		Nonce:    account.Nonce,
+		Balance:  account.Balance,
+		Root:     account.Root,
+		CodeHash: account.CodeHash,
+	})
+	if err != nil {
+		return err
+	}
+	if err := imp.accTrie.TryUpdate(account.Hash[:], blob); err != nil {
+		return err
+	}
+	imp.storage = nil
+	imp.accounts++
+
+	if imp.pending++; imp.pending >= importFlushLeaves {
+		return imp.flush()
+	}
+	return nil
+}
+
+// flush commits the tries built so far and writes them to disk, reopening them
+// afterwards to drop the written nodes from memory. As leaves are inserted in
+// order, only the rightmost paths of the tries are loaded back.
+func (imp *stateImporter) flush() error {
+	if imp.storage != nil {
+		root, err := imp.storage.Commit(nil)
+		if err != nil {
+			return err
+		}
+		if err := imp.triedb.Commit(root, false); err != nil {
+			return err
+		}
+		if imp.storage, err = trie.New(root, imp.triedb); err != nil {
+			return err
+		}
+	}
+	root, err := imp.accTrie.Commit(func(leaf []byte, parent common.Hash) error {
+		var account Account
+		if err := rlp.DecodeBytes(leaf, &account); err != nil {
+			return nil
+		}
+		imp.triedb.Reference(account.Root, parent)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := imp.triedb.Commit(root, false); err != nil {
+		return err
+	}
+	if imp.accTrie, err = trie.New(root, imp.triedb); err != nil {
+		return err
+	}
+	if err := imp.batch.Write(); err != nil {
+		return err
+	}
+	imp.batch.Reset()
+	imp.pending = 0
+	return nil
+}
+
+// finish completes the import of the last account and flushes all tries, returning
+// the root of the imported state.
+func (imp *stateImporter) finish() (common.Hash, error) {
+	if imp.account != nil {
+		if err := imp.finishAccount(); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	if err := imp.flush(); err != nil {
+		return common.Hash{}, err
+	}
+	return imp.accTrie.Hash(), nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// makeExportableState creates a state with a mix of plain accounts, contracts
+// sharing code and contracts with storage.
+func makeExportableState(t *testing.T) (Database, common.Hash, []*testAccount, map[common.Address]map[common.Hash]common.Hash) {
+	mem, _ := ethdb.NewMemDatabase()
+	db := NewDatabase(mem)
+	state, _ := New(common.Hash{}, db)
+
+	accounts := []*testAccount{}
+	storage := make(map[common.Address]map[common.Hash]common.Hash)
+	for i := byte(0); i < 64; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		acc := &testAccount{address: addr, balance: big.NewInt(int64(11 * i)), nonce: uint64(42 * i)}
+
+		state.AddBalance(addr, acc.balance)
+		state.SetNonce(addr, acc.nonce)
+		if i%4 == 0 {
+			acc.code = []byte{i % 8, i % 8, i % 8}
+			state.SetCode(addr, acc.code)
+		}
+		if i%5 == 0 {
+			storage[addr] = make(map[common.Hash]common.Hash)
+			for j := 0; j < int(i); j++ {
+				key, value := common.BytesToHash([]byte{i, byte(j)}), common.BytesToHash([]byte{byte(j + 1)})
+				state.SetState(addr, key, value)
+				storage[addr][key] = value
+			}
+		}
+		accounts = append(accounts, acc)
+	}
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := db.TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to write state: %v", err)
+	}
+	return db, root, accounts, storage
+}
+
+// Tests that a state can be exported and imported into an empty database, both
+// with the default chunk sizes and with tiny ones splitting storage across chunks
+// and flushing the tries being imported frequently.
+func TestStateExportImport(t *testing.T) {
+	t.Run("default", func(t *testing.T) { testStateExportImport(t, exportChunkSize, importFlushLeaves) })
+	t.Run("tiny", func(t *testing.T) { testStateExportImport(t, 128, 3) })
+}
+
+func testStateExportImport(t *testing.T, chunkSize, flushLeaves int) {
+	defer func(chunkSize, flushLeaves int) {
+		exportChunkSize, importFlushLeaves = chunkSize, flushLeaves
+	}(exportChunkSize, importFlushLeaves)
+	exportChunkSize, importFlushLeaves = chunkSize, flushLeaves
+
+	db, root, accounts, storage := makeExportableState(t)
+
+	buf := new(bytes.Buffer)
+	if err := ExportState(db, root, buf); err != nil {
+		t.Fatalf("failed to export state: %v", err)
+	}
+	dstdb, _ := ethdb.NewMemDatabase()
+	imported, err := ImportState(dstdb, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to import state: %v", err)
+	}
+	if imported != root {
+		t.Fatalf("imported root mismatch: have %x, want %x", imported, root)
+	}
+	checkStateAccounts(t, dstdb, root, accounts)
+
+	state, _ := New(root, NewDatabase(dstdb))
+	for addr, slots := range storage {
+		for key, value := range slots {
+			if have := state.GetState(addr, key); have != value {
+				t.Errorf("account %x: slot %x mismatch: have %x, want %x", addr, key, have, value)
+			}
+		}
+	}
+}
+
+// Tests that importing a state export fails if its content doesn't match the
+// state root it claims to contain.
+func TestStateImportRootMismatch(t *testing.T) {
+	db, root, _, _ := makeExportableState(t)
+
+	buf := new(bytes.Buffer)
+	if err := ExportState(db, root, buf); err != nil {
+		t.Fatalf("failed to export state: %v", err)
+	}
+	// Replace the header with one claiming a different root
+	stream := rlp.NewStream(bytes.NewReader(buf.Bytes()), 0)
+	header, _ := stream.Raw()
+	rest := buf.Bytes()[len(header):]
+
+	forged, _ := rlp.EncodeToBytes(&exportHeader{Version: exportVersion, Root: crypto.Keccak256Hash(root[:])})
+	dstdb, _ := ethdb.NewMemDatabase()
+	if _, err := ImportState(dstdb, bytes.NewReader(append(forged, rest...))); err == nil {
+		t.Fatalf("state with mismatching root imported")
+	}
+	// Ensure an unknown format version is rejected too
+	forged, _ = rlp.EncodeToBytes(&exportHeader{Version: exportVersion + 1, Root: root})
+	if _, err := ImportState(dstdb, bytes.NewReader(append(forged, rest...))); err == nil {
+		t.Fatalf("state with unknown version imported")
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	pruneRootsKey  = []byte("PruneRoots")  // Retained state roots of an ongoing pruning
+	pruneMarkedKey = []byte("PruneMarked") // Flag set once all reachable nodes are marked
+	pruneSweepKey  = []byte("PruneSweep")  // Last database key swept by an ongoing pruning
+
+	pruneMarkPrefix = []byte("m") // pruneMarkPrefix + hash -> reachable node marker
+)
+
+// errNoRetainedState is returned if none of the state roots to retain are
+// available in the database, which would make pruning delete the entire state.
+var errNoRetainedState = errors.New("none of the retained states are available")
+
+// PruneStats contains the results of a state pruning run.
+type PruneStats struct {
+	Marked  uint64             // Number of reachable trie nodes and contract codes
+	Deleted uint64             // Number of unreachable entries deleted (or prunable on dry runs)
+	Size    common.StorageSize // Total size of the deleted entries
+	Elapsed time.Duration      // Time spent marking and sweeping
+}
+
+// Pruner removes all state trie nodes and contract codes from a database which
+// are not reachable from a set of retained state roots.
+//
+// Pruning is done in two phases: all nodes reachable from the retained roots are
+// marked in a separate database, after which every state entry of the chain
+// database which is not marked is deleted. The progress of both phases is kept
+// in the marker database too, so an interrupted run is resumed on the next one.
+type Pruner struct {
+	db     ethdb.Database // Chain database to prune the state of
+	marks  ethdb.Database // Database holding the reachable set and progress
+	dryrun bool           // Whether to only report the prunable entries
+}
+
+// NewPruner creates a state pruner for the given chain database, tracking the
+// reachable node set and its progress in marks. In dry-run mode nothing is
+// deleted from the chain database and no sweep progress is recorded.
+func NewPruner(db ethdb.Database, marks ethdb.Database, dryrun bool) *Pruner {
+	return &Pruner{
+		db:     db,
+		marks:  marks,
+		dryrun: dryrun,
+	}
+}
+
+// Prune deletes every state entry not reachable from the given roots. Roots not
+// present in the database are ignored, but at least one must be available. If a
+// previous run was interrupted, its retained roots take precedence over the ones
+// given, and the run continues where it left off.
+func (p *Pruner) Prune(roots []common.Hash) (*PruneStats, error) {
+	var (
+		stats = new(PruneStats)
+		start = time.Now()
+	)
+	// Resume any interrupted pruning or start a new one
+	if blob, _ := p.marks.Get(pruneRootsKey); len(blob) > 0 {
+		if err := rlp.DecodeBytes(blob, &roots); err != nil {
+			return nil, err
+		}
+		log.Info("Resuming interrupted state pruning", "roots", len(roots))
+	} else {
+		var available []common.Hash
+		for _, root := range roots {
+			if _, err := New(root, NewDatabase(p.db)); err == nil {
+				available = append(available, root)
+			}
+		}
+		if len(available) == 0 {
+			return nil, errNoRetainedState
+		}
+		roots = available
+
+		blob, err := rlp.EncodeToBytes(roots)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.marks.Put(pruneRootsKey, blob); err != nil {
+			return nil, err
+		}
+	}
+	// Mark all the nodes reachable from the retained roots
+	if marked, _ := p.marks.Get(pruneMarkedKey); len(marked) == 0 {
+		for _, root := range roots {
+			if err := p.mark(root, stats); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.marks.Put(pruneMarkedKey, []byte{0x01}); err != nil {
+			return nil, err
+		}
+	} else {
+		log.Info("Reachable state already marked, skipping")
+	}
+	// Sweep out everything not marked
+	if err := p.sweep(stats); err != nil {
+		return nil, err
+	}
+	stats.Elapsed = time.Since(start)
+	return stats, nil
+}
+
+// mark iterates over all the nodes and contract codes reachable from a state
+// root and adds them to the reachable set.
+func (p *Pruner) mark(root common.Hash, stats *PruneStats) error {
+	statedb, err := New(root, NewDatabase(p.db))
+	if err != nil {
+		return err
+	}
+	var (
+		batch  = p.marks.NewBatch()
+		it     = NewNodeIterator(statedb)
+		logged = time.Now()
+	)
+	for it.Next() {
+		if it.Hash == (common.Hash{}) {
+			continue // Embedded node, stored within its parent
+		}
+		if err := batch.Put(append(pruneMarkPrefix, it.Hash[:]...), nil); err != nil {
+			return err
+		}
+		stats.Marked++
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Marking reachable state", "root", root, "nodes", stats.Marked)
+			logged = time.Now()
+		}
+	}
+	if it.Error != nil {
+		return it.Error
+	}
+	log.Info("Marked reachable state", "root", root, "nodes", stats.Marked)
+	return batch.Write()
+}
+
+// sweep deletes all the state entries from the chain database which are not in
+// the reachable set, periodically recording the last swept key.
+func (p *Pruner) sweep(stats *PruneStats) error {
+	var origin []byte
+	if !p.dryrun {
+		origin, _ = p.marks.Get(pruneSweepKey)
+	}
+	it := p.db.NewIterator(nil, origin)
+	defer it.Release()
+
+	var (
+		batch  = p.db.NewBatch()
+		logged = time.Now()
+	)
+	for it.Next() {
+		// State trie nodes and contract codes are the only entries keyed by the
+		// hash of their content, everything else is prefixed
+		key, value := it.Key(), it.Value()
+		if len(key) != common.HashLength || !bytes.Equal(key, crypto.Keccak256(value)) {
+			continue
+		}
+		if ok, _ := p.marks.Has(append(pruneMarkPrefix, key...)); ok {
+			continue
+		}
+		stats.Deleted++
+		stats.Size += common.StorageSize(len(key) + len(value))
+
+		if p.dryrun {
+			continue
+		}
+		if err := batch.Delete(common.CopyBytes(key)); err != nil {
+			return err
+		}
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := p.flush(batch, key); err != nil {
+				return err
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Sweeping unreachable state", "deleted", stats.Deleted, "size", stats.Size)
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if p.dryrun {
+		return nil
+	}
+	if err := p.flush(batch, nil); err != nil {
+		return err
+	}
+	// Pruning finished, drop the progress markers
+	for _, key := range [][]byte{pruneRootsKey, pruneMarkedKey, pruneSweepKey} {
+		if err := p.marks.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush writes out a batch of deletions and records the last swept key, so an
+// interrupted sweep can continue from there.
+func (p *Pruner) flush(batch ethdb.Batch, last []byte) error {
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	batch.Reset()
+
+	if last == nil {
+		return nil
+	}
+	return p.marks.Put(pruneSweepKey, common.CopyBytes(last))
+}
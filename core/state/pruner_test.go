@@ -0,0 +1,158 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// makePrunableState creates a temporary database holding two consecutive states,
+// the second of which modifies some of the accounts and storage of the first.
+func makePrunableState(t *testing.T) (*ethdb.LDBDatabase, string, common.Hash, common.Hash) {
+	dir, err := ioutil.TempDir("", "pruner-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	db, err := ethdb.NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	sdb := NewDatabase(db)
+	state, _ := New(common.Hash{}, sdb)
+	for i := byte(0); i < 64; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		state.AddBalance(addr, big.NewInt(int64(i)+1))
+		if i%4 == 0 {
+			state.SetCode(addr, []byte{i, i, i})
+			state.SetState(addr, common.Hash{i}, common.Hash{i, i})
+		}
+	}
+	first, _ := state.Commit(false)
+	sdb.TrieDB().Commit(first, false)
+
+	state, _ = New(first, sdb)
+	for i := byte(0); i < 64; i += 2 {
+		addr := common.BytesToAddress([]byte{i})
+		state.AddBalance(addr, big.NewInt(1))
+		if i%4 == 0 {
+			state.SetState(addr, common.Hash{i}, common.Hash{i, i, i})
+		}
+	}
+	second, _ := state.Commit(false)
+	sdb.TrieDB().Commit(second, false)
+
+	return db, dir, first, second
+}
+
+// countStateEntries counts the entries of a database keyed by content hash.
+func countStateEntries(db ethdb.Database) int {
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+
+	count := 0
+	for it.Next() {
+		if len(it.Key()) == common.HashLength {
+			count++
+		}
+	}
+	return count
+}
+
+// Tests that pruning retains all the reachable state and removes everything else,
+// and that dry runs don't delete anything.
+func TestPrune(t *testing.T) {
+	db, dir, first, second := makePrunableState(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	entries := countStateEntries(db)
+
+	// Dry runs should report prunable entries, but leave them in place
+	marks, _ := ethdb.NewMemDatabase()
+	stats, err := NewPruner(db, marks, true).Prune([]common.Hash{second})
+	if err != nil {
+		t.Fatalf("failed to dry run pruning: %v", err)
+	}
+	if stats.Deleted == 0 {
+		t.Fatalf("no prunable entries reported")
+	}
+	if have := countStateEntries(db); have != entries {
+		t.Fatalf("dry run modified database: have %d entries, want %d", have, entries)
+	}
+	// Real runs should delete exactly the reported entries
+	marks, _ = ethdb.NewMemDatabase()
+	if stats, err = NewPruner(db, marks, false).Prune([]common.Hash{second}); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	if have, want := countStateEntries(db), entries-int(stats.Deleted); have != want {
+		t.Fatalf("entry count mismatch: have %d, want %d", have, want)
+	}
+	if have := countStateEntries(db); uint64(have) != stats.Marked {
+		t.Errorf("retained entry count mismatch: have %d, want %d", have, stats.Marked)
+	}
+	if err := checkStateConsistency(db, second); err != nil {
+		t.Errorf("retained state inconsistent: %v", err)
+	}
+	if _, err := New(first, NewDatabase(db)); err == nil {
+		t.Errorf("pruned state still available")
+	}
+	for _, key := range [][]byte{pruneRootsKey, pruneMarkedKey, pruneSweepKey} {
+		if ok, _ := marks.Has(key); ok {
+			t.Errorf("progress marker %q not cleaned up", key)
+		}
+	}
+}
+
+// Tests that an interrupted pruning is resumed with its original retained roots.
+func TestPruneResume(t *testing.T) {
+	db, dir, first, second := makePrunableState(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	// Simulate a run retaining both states which was interrupted after marking
+	marks, _ := ethdb.NewMemDatabase()
+	if _, err := NewPruner(db, marks, true).Prune([]common.Hash{first, second}); err != nil {
+		t.Fatalf("failed to dry run pruning: %v", err)
+	}
+	// Resuming should retain both states, even if asked for only one
+	if _, err := NewPruner(db, marks, false).Prune([]common.Hash{second}); err != nil {
+		t.Fatalf("failed to resume pruning: %v", err)
+	}
+	for _, root := range []common.Hash{first, second} {
+		if err := checkStateConsistency(db, root); err != nil {
+			t.Errorf("state %x inconsistent: %v", root, err)
+		}
+	}
+}
+
+// Tests that pruning refuses to run if none of the retained states exist.
+func TestPruneMissingState(t *testing.T) {
+	db, dir, _, _ := makePrunableState(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	marks, _ := ethdb.NewMemDatabase()
+	if _, err := NewPruner(db, marks, false).Prune([]common.Hash{{0x01}}); err != errNoRetainedState {
+		t.Fatalf("error mismatch: have %v, want %v", err, errNoRetainedState)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// diskLayer is a low level persistent snapshot built on top of a key-value store.
+type diskLayer struct {
+	diskdb ethdb.Database // Key-value store containing the base snapshot
+	triedb *trie.Database // Trie node cache for reconstruction purposes
+	root   common.Hash    // Root hash of the base snapshot
+	stale  bool           // Signals that the layer became stale (state progressed)
+
+	genMarker []byte             // Last account hash indexed during initial layer generation (nil = done)
+	genAbort  chan chan struct{} // Notification channel to abort generating the snapshot in this layer
+
+	lock sync.RWMutex
+}
+
+// loadSnapshot opens the persisted snapshot if it belongs to the given state
+// root, resuming its generation if it was interrupted. Nil is returned if there
+// is no snapshot of the requested state in the database.
+func loadSnapshot(diskdb ethdb.Database, triedb *trie.Database, root common.Hash) *diskLayer {
+	if blob, _ := diskdb.Get(snapshotRootKey); len(blob) != common.HashLength || common.BytesToHash(blob) != root {
+		return nil
+	}
+	base := &diskLayer{
+		diskdb: diskdb,
+		triedb: triedb,
+		root:   root,
+	}
+	if has, _ := diskdb.Has(snapshotGeneratorKey); has {
+		marker, _ := diskdb.Get(snapshotGeneratorKey)
+		base.genMarker = append([]byte{}, marker...)
+		base.genAbort = make(chan chan struct{})
+
+		log.Info("Resuming state snapshot generation", "root", root, "at", common.BytesToHash(marker))
+		go base.generate()
+	}
+	return base
+}
+
+// Root returns root hash for which this snapshot was made.
+func (dl *diskLayer) Root() common.Hash {
+	return dl.root
+}
+
+// Parent always returns nil as there's no layer below the disk.
+func (dl *diskLayer) Parent() snapshot {
+	return nil
+}
+
+// Stale return whether this layer has become stale (was flattened across) or if
+// it's still live.
+func (dl *diskLayer) Stale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+// markStale flags the layer as stale, failing all subsequent data accesses.
+func (dl *diskLayer) markStale() {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.stale = true
+}
+
+// Account directly retrieves the account associated with a particular hash in
+// the snapshot slim data format.
+func (dl *diskLayer) Account(hash common.Hash) (*Account, error) {
+	data, err := dl.AccountRLP(hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 { // can be both nil and []byte{}
+		return nil, nil
+	}
+	account := new(Account)
+	if err := rlp.DecodeBytes(data, account); err != nil {
+		panic(err)
+	}
+	return account, nil
+}
+
+// AccountRLP directly retrieves the account RLP associated with a particular
+// hash in the snapshot slim data format.
+func (dl *diskLayer) AccountRLP(hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	// If the layer was flattened into, consider it invalid (any live reference to
+	// the original should be marked as unusable).
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	// If the layer is being generated, ensure the requested hash has already been
+	// covered by the generator.
+	if dl.genMarker != nil && bytes.Compare(hash[:], dl.genMarker) > 0 {
+		return nil, ErrNotCoveredYet
+	}
+	blob, _ := dl.diskdb.Get(accountSnapshotKey(hash))
+	return blob, nil
+}
+
+// Storage directly retrieves the storage data associated with a particular hash,
+// within a particular account.
+func (dl *diskLayer) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	// If the layer was flattened into, consider it invalid (any live reference to
+	// the original should be marked as unusable).
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	// If the layer is being generated, ensure the requested account and all its
+	// storage slots have already been covered by the generator.
+	if dl.genMarker != nil && bytes.Compare(accountHash[:], dl.genMarker) > 0 {
+		return nil, ErrNotCoveredYet
+	}
+	blob, _ := dl.diskdb.Get(storageSnapshotKey(accountHash, storageHash))
+	return blob, nil
+}
+
+// Update creates a new layer on top of the existing snapshot diff tree with
+// the specified data items. Note, the maps are retained by the method to avoid
+// copying everything.
+func (dl *diskLayer) Update(blockRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) *diffLayer {
+	return newDiffLayer(dl, blockRoot, destructs, accounts, storage)
+}
+
+// stopGeneration aborts the snapshot generation running on the layer, if any,
+// and waits until its progress is persisted. The method is not thread safe, it
+// is only ever called with the snapshot tree locked.
+func (dl *diskLayer) stopGeneration() {
+	if dl.genAbort == nil {
+		return
+	}
+	abort := make(chan struct{})
+	dl.genAbort <- abort
+	<-abort
+
+	dl.genAbort = nil
+}
+
+// diffToDisk merges a bottom-most diff into the persistent disk layer underneath
+// it, returning a new disk layer. The old disk layer and the merged diff are
+// marked stale. If the snapshot was still being generated, generation resumes
+// on the new layer from the same position.
+func diffToDisk(base *diskLayer, bottom *diffLayer) *diskLayer {
+	// Halt any generation on the base and invalidate it
+	base.stopGeneration()
+	base.markStale()
+
+	base.lock.RLock()
+	marker := base.genMarker
+	base.lock.RUnlock()
+
+	// Push all the modifications of the diff layer into the database
+	bottom.lock.RLock()
+	batch := base.diskdb.NewBatch()
+	flush := func() {
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				log.Crit("Failed to write state snapshot", "err", err)
+			}
+			batch.Reset()
+		}
+	}
+	for hash := range bottom.destructSet {
+		batch.Delete(accountSnapshotKey(hash))
+		if err := wipeKeyRange(base.diskdb, storageSnapshotsKey(hash), len(storageSnapshotPrefix)+2*common.HashLength); err != nil {
+			log.Crit("Failed to wipe destructed storage snapshot", "err", err)
+		}
+		flush()
+	}
+	for hash, data := range bottom.accountData {
+		if len(data) > 0 {
+			batch.Put(accountSnapshotKey(hash), data)
+		} else {
+			batch.Delete(accountSnapshotKey(hash))
+		}
+		flush()
+	}
+	for accountHash, storage := range bottom.storageData {
+		for storageHash, data := range storage {
+			if len(data) > 0 {
+				batch.Put(storageSnapshotKey(accountHash, storageHash), data)
+			} else {
+				batch.Delete(storageSnapshotKey(accountHash, storageHash))
+			}
+		}
+		flush()
+	}
+	bottom.lock.RUnlock()
+
+	// Update the snapshot metadata and persist everything
+	batch.Put(snapshotRootKey, bottom.root[:])
+	if marker != nil {
+		batch.Put(snapshotGeneratorKey, marker)
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write state snapshot", "err", err)
+	}
+	bottom.markStale()
+
+	res := &diskLayer{
+		diskdb:    base.diskdb,
+		triedb:    base.triedb,
+		root:      bottom.root,
+		genMarker: marker,
+	}
+	if marker != nil {
+		res.genAbort = make(chan chan struct{})
+		go res.generate()
+	}
+	return res
+}
@@ -0,0 +1,234 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// generateSnapshot regenerates a brand new snapshot based on an existing state
+// database and head block asynchronously. The snapshot is returned immediately
+// and generation is continued in the background until done.
+func generateSnapshot(diskdb ethdb.Database, triedb *trie.Database, root common.Hash) *diskLayer {
+	batch := diskdb.NewBatch()
+	batch.Put(snapshotRootKey, root[:])
+	batch.Put(snapshotGeneratorKey, []byte{})
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write snapshot generator", "err", err)
+	}
+	base := &diskLayer{
+		diskdb:    diskdb,
+		triedb:    triedb,
+		root:      root,
+		genMarker: []byte{}, // Initialized but empty!
+		genAbort:  make(chan chan struct{}),
+	}
+	go base.generate()
+	return base
+}
+
+// generate is a background thread that iterates over the state and storage tries
+// of the disk layer and constructs the flat snapshot data in the database for
+// all the accounts after the current generator marker. Progress is persisted
+// regularly, so generation can be resumed after an abort or a restart.
+func (dl *diskLayer) generate() {
+	dl.lock.RLock()
+	marker := dl.genMarker
+	dl.lock.RUnlock()
+
+	var (
+		batch   = dl.diskdb.NewBatch()
+		last    []byte // Last account completely generated in this run
+		abort   chan struct{}
+		start   = time.Now()
+		logged  = time.Now()
+		written uint64
+		slots   uint64
+	)
+	// checkpoint flushes the generated data into the database along with the
+	// progress made, and checks whether the generator was requested to stop.
+	checkpoint := func() {
+		if last != nil {
+			batch.Put(snapshotGeneratorKey, last)
+		}
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to write state snapshot", "err", err)
+		}
+		batch.Reset()
+
+		if last != nil {
+			dl.lock.Lock()
+			dl.genMarker = last
+			dl.lock.Unlock()
+		}
+		select {
+		case abort = <-dl.genAbort:
+		default:
+		}
+	}
+	// A fresh generation starts by deleting any leftover snapshot data
+	if len(marker) == 0 {
+		if err := wipeSnapshot(dl.diskdb); err != nil {
+			log.Crit("Failed to wipe state snapshot", "err", err)
+		}
+	}
+	err := func() error {
+		accTrie, err := trie.New(dl.root, dl.triedb)
+		if err != nil {
+			return err
+		}
+		it := trie.NewIterator(accTrie.NodeIterator(marker))
+		for it.Next() {
+			if bytes.Equal(it.Key, marker) {
+				continue // Generated in a previous run
+			}
+			accountHash := common.BytesToHash(it.Key)
+
+			var acc Account
+			if err := rlp.DecodeBytes(it.Value, &acc); err != nil {
+				return fmt.Errorf("invalid account %x: %v", accountHash, err)
+			}
+			batch.Put(accountSnapshotKey(accountHash), SlimAccountRLP(acc.Nonce, acc.Balance, common.BytesToHash(acc.Root), acc.CodeHash))
+			written++
+
+			if !bytes.Equal(acc.Root, emptyRoot[:]) {
+				storeTrie, err := trie.New(common.BytesToHash(acc.Root), dl.triedb)
+				if err != nil {
+					dl.rollback(batch, accountHash)
+					return err
+				}
+				storeIt := trie.NewIterator(storeTrie.NodeIterator(nil))
+				for storeIt.Next() {
+					batch.Put(storageSnapshotKey(accountHash, common.BytesToHash(storeIt.Key)), storeIt.Value)
+					slots++
+
+					// Large contracts are flushed in chunks, but aborting drops the
+					// partially generated account
+					if batch.ValueSize() >= ethdb.IdealBatchSize {
+						checkpoint()
+						if abort != nil {
+							dl.rollback(batch, accountHash)
+							return nil
+						}
+					}
+				}
+				if storeIt.Err != nil {
+					dl.rollback(batch, accountHash)
+					return storeIt.Err
+				}
+			}
+			last = accountHash[:]
+
+			select {
+			case abort = <-dl.genAbort:
+			default:
+			}
+			if abort != nil || batch.ValueSize() >= ethdb.IdealBatchSize {
+				checkpoint()
+				if abort != nil {
+					return nil
+				}
+			}
+			if time.Since(logged) > 8*time.Second {
+				log.Info("Generating state snapshot", "root", dl.root, "at", accountHash, "accounts", written, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+				logged = time.Now()
+			}
+		}
+		return it.Err
+	}()
+	switch {
+	case abort != nil:
+		log.Debug("Aborted state snapshot generation", "root", dl.root, "accounts", written, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+		close(abort)
+		return
+
+	case err != nil:
+		// Most probably the state got garbage collected from under the generator,
+		// keep what's done and wait until it's resumed on a newer state
+		batch.Reset()
+		log.Warn("Paused state snapshot generation", "root", dl.root, "err", err)
+
+	default:
+		batch.Delete(snapshotGeneratorKey)
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to write state snapshot", "err", err)
+		}
+		dl.lock.Lock()
+		dl.genMarker = nil
+		dl.lock.Unlock()
+
+		log.Info("Generated state snapshot", "root", dl.root, "accounts", written, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	// Someone will be looking for us, wait it out
+	abort = <-dl.genAbort
+	close(abort)
+}
+
+// rollback discards the pending writes of the generator and removes any data of
+// a partially generated account already flushed to the database.
+func (dl *diskLayer) rollback(batch ethdb.Batch, accountHash common.Hash) {
+	batch.Reset()
+	if err := dl.diskdb.Delete(accountSnapshotKey(accountHash)); err != nil {
+		log.Crit("Failed to delete account snapshot", "err", err)
+	}
+	if err := wipeKeyRange(dl.diskdb, storageSnapshotsKey(accountHash), len(storageSnapshotPrefix)+2*common.HashLength); err != nil {
+		log.Crit("Failed to wipe storage snapshot", "err", err)
+	}
+}
+
+// wipeSnapshot deletes all the account and storage snapshot data from the
+// database.
+func wipeSnapshot(db ethdb.Database) error {
+	if err := wipeKeyRange(db, accountSnapshotPrefix, len(accountSnapshotPrefix)+common.HashLength); err != nil {
+		return err
+	}
+	return wipeKeyRange(db, storageSnapshotPrefix, len(storageSnapshotPrefix)+2*common.HashLength)
+}
+
+// wipeKeyRange deletes all the keys of the given length with a specific prefix
+// from the database. Keys of different lengths are left alone, as they might
+// belong to other data sharing the prefix.
+func wipeKeyRange(db ethdb.Database, prefix []byte, keylen int) error {
+	it := db.NewIterator(prefix, nil)
+	defer it.Release()
+
+	batch := db.NewBatch()
+	for it.Next() {
+		if len(it.Key()) != keylen {
+			continue
+		}
+		batch.Delete(common.CopyBytes(it.Key()))
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return batch.Write()
+}
@@ -0,0 +1,231 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// seedHash generates a deterministic hash from a seed byte.
+func seedHash(seed byte) common.Hash {
+	return common.BytesToHash(bytes.Repeat([]byte{seed}, common.HashLength))
+}
+
+// newTestTree creates a snapshot tree with an already generated, empty disk layer.
+func newTestTree(root common.Hash) (*Tree, *ethdb.MemDatabase) {
+	db, _ := ethdb.NewMemDatabase()
+	base := &diskLayer{
+		diskdb: db,
+		triedb: trie.NewDatabase(db),
+		root:   root,
+	}
+	return &Tree{
+		diskdb: db,
+		triedb: base.triedb,
+		layers: map[common.Hash]snapshot{root: base},
+	}, db
+}
+
+// Tests that account and storage lookups resolve through the diff layers down
+// to the disk layer, honouring deletions and destructed accounts.
+func TestDiffLayerLookups(t *testing.T) {
+	tree, db := newTestTree(seedHash(0x00))
+
+	// Populate the disk layer with an account and a storage slot
+	db.Put(accountSnapshotKey(seedHash(0xa1)), SlimAccountRLP(1, big.NewInt(1), emptyRoot, emptyCode[:]))
+	db.Put(accountSnapshotKey(seedHash(0xa2)), SlimAccountRLP(2, big.NewInt(2), emptyRoot, emptyCode[:]))
+	db.Put(storageSnapshotKey(seedHash(0xa2), seedHash(0xb1)), []byte{0x01})
+
+	// Modify the first account, destruct the second one
+	if err := tree.Update(seedHash(0x01), seedHash(0x00), nil, map[common.Hash][]byte{
+		seedHash(0xa1): SlimAccountRLP(3, big.NewInt(3), emptyRoot, emptyCode[:]),
+	}, nil); err != nil {
+		t.Fatalf("failed to create diff layer: %v", err)
+	}
+	if err := tree.Update(seedHash(0x02), seedHash(0x01), map[common.Hash]struct{}{seedHash(0xa2): {}}, nil, nil); err != nil {
+		t.Fatalf("failed to create diff layer: %v", err)
+	}
+	if err := tree.Update(seedHash(0x03), seedHash(0xff), nil, nil, nil); err == nil {
+		t.Fatalf("diff layer created on unknown parent")
+	}
+	// Check the lookups at every layer
+	snap := tree.Snapshot(seedHash(0x01))
+	if acc, err := snap.Account(seedHash(0xa1)); err != nil || acc.Nonce != 3 {
+		t.Errorf("modified account mismatch: have %v, %v", acc, err)
+	}
+	if acc, err := snap.Account(seedHash(0xa2)); err != nil || acc.Nonce != 2 {
+		t.Errorf("inherited account mismatch: have %v, %v", acc, err)
+	}
+	if slot, err := snap.Storage(seedHash(0xa2), seedHash(0xb1)); err != nil || !bytes.Equal(slot, []byte{0x01}) {
+		t.Errorf("inherited slot mismatch: have %x, %v", slot, err)
+	}
+	snap = tree.Snapshot(seedHash(0x02))
+	if acc, err := snap.Account(seedHash(0xa2)); err != nil || acc != nil {
+		t.Errorf("destructed account mismatch: have %v, %v", acc, err)
+	}
+	if slot, err := snap.Storage(seedHash(0xa2), seedHash(0xb1)); err != nil || slot != nil {
+		t.Errorf("destructed slot mismatch: have %x, %v", slot, err)
+	}
+	if acc, err := snap.Account(seedHash(0xa3)); err != nil || acc != nil {
+		t.Errorf("missing account mismatch: have %v, %v", acc, err)
+	}
+}
+
+// Tests that capping the tree flattens the bottom layers into the database,
+// invalidating the old layers and discarding forks that don't build on the new
+// disk layer.
+func TestDiffLayerCap(t *testing.T) {
+	tree, db := newTestTree(seedHash(0x00))
+	db.Put(storageSnapshotKey(seedHash(0xa2), seedHash(0xb1)), []byte{0x01})
+
+	for i := byte(1); i <= 4; i++ {
+		accounts := map[common.Hash][]byte{
+			seedHash(0xa1): SlimAccountRLP(uint64(i), big.NewInt(0), emptyRoot, emptyCode[:]),
+		}
+		var destructs map[common.Hash]struct{}
+		if i == 1 {
+			destructs = map[common.Hash]struct{}{seedHash(0xa2): {}}
+		}
+		if err := tree.Update(seedHash(i), seedHash(i-1), destructs, accounts, nil); err != nil {
+			t.Fatalf("failed to create diff layer %d: %v", i, err)
+		}
+	}
+	// Create a fork off the first layer, which will be discarded
+	if err := tree.Update(seedHash(0xf1), seedHash(0x01), nil, nil, nil); err != nil {
+		t.Fatalf("failed to create fork layer: %v", err)
+	}
+	bottom, fork := tree.Snapshot(seedHash(0x02)), tree.Snapshot(seedHash(0xf1))
+
+	if err := tree.Cap(seedHash(0x04), 2); err != nil {
+		t.Fatalf("failed to cap tree: %v", err)
+	}
+	if have := len(tree.layers); have != 3 {
+		t.Errorf("layer count mismatch: have %d, want %d", have, 3)
+	}
+	if _, err := bottom.Account(seedHash(0xa1)); err != ErrSnapshotStale {
+		t.Errorf("flattened layer error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	if _, err := fork.Account(seedHash(0xa1)); err != ErrSnapshotStale {
+		t.Errorf("discarded fork error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	if tree.Snapshot(seedHash(0xf1)) != nil {
+		t.Errorf("discarded fork still in tree")
+	}
+	// Check the flattened data in the database and the live layers
+	if root, _ := db.Get(snapshotRootKey); !bytes.Equal(root, seedHash(0x02).Bytes()) {
+		t.Errorf("persisted root mismatch: have %x, want %x", root, seedHash(0x02))
+	}
+	if blob, _ := db.Get(storageSnapshotKey(seedHash(0xa2), seedHash(0xb1))); blob != nil {
+		t.Errorf("destructed storage not wiped: %x", blob)
+	}
+	if acc, err := tree.Snapshot(seedHash(0x02)).Account(seedHash(0xa1)); err != nil || acc.Nonce != 2 {
+		t.Errorf("disk layer account mismatch: have %v, %v", acc, err)
+	}
+	if acc, err := tree.Snapshot(seedHash(0x04)).Account(seedHash(0xa1)); err != nil || acc.Nonce != 4 {
+		t.Errorf("diff layer account mismatch: have %v, %v", acc, err)
+	}
+	// Flatten everything and check the head becomes the disk layer
+	if err := tree.Cap(seedHash(0x04), 0); err != nil {
+		t.Fatalf("failed to flatten tree: %v", err)
+	}
+	if _, ok := tree.Snapshot(seedHash(0x04)).(*diskLayer); !ok || len(tree.layers) != 1 {
+		t.Errorf("tree not flattened: %d layers", len(tree.layers))
+	}
+}
+
+// Tests that a snapshot generated from the state tries contains all the accounts
+// and storage slots in the slim format.
+func TestGeneration(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	triedb := trie.NewDatabase(db)
+
+	// Create a storage trie and an account trie referencing it
+	storage, _ := trie.New(common.Hash{}, triedb)
+	for i := byte(1); i <= 16; i++ {
+		storage.Update(seedHash(i).Bytes(), []byte{i})
+	}
+	storageRoot, _ := storage.Commit(nil)
+
+	accounts, _ := trie.New(common.Hash{}, triedb)
+	for i := byte(1); i <= 64; i++ {
+		acc := Account{Nonce: uint64(i), Balance: big.NewInt(int64(i)), Root: emptyRoot[:], CodeHash: emptyCode[:]}
+		if i%8 == 0 {
+			acc.Root = storageRoot[:]
+		}
+		blob, _ := rlp.EncodeToBytes(acc)
+		accounts.Update(seedHash(i).Bytes(), blob)
+	}
+	root, _ := accounts.Commit(func(leaf []byte, parent common.Hash) error {
+		triedb.Reference(storageRoot, parent)
+		return nil
+	})
+	triedb.Commit(root, false)
+
+	// Leave some junk in the database to be wiped and generate the snapshot
+	db.Put(accountSnapshotKey(seedHash(0xff)), []byte{0x01})
+
+	snap := generateSnapshot(db, triedb, root)
+	for start := time.Now(); ; {
+		snap.lock.RLock()
+		done := snap.genMarker == nil
+		snap.lock.RUnlock()
+
+		if done {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("snapshot generation timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer snap.stopGeneration()
+
+	for i := byte(1); i <= 64; i++ {
+		acc, err := snap.Account(seedHash(i))
+		if err != nil || acc == nil || acc.Nonce != uint64(i) || acc.Balance.Cmp(big.NewInt(int64(i))) != 0 || len(acc.CodeHash) != 0 {
+			t.Fatalf("account %d mismatch: have %v, %v", i, acc, err)
+		}
+		if i%8 != 0 {
+			if len(acc.Root) != 0 {
+				t.Errorf("account %d: empty root not slimmed: %x", i, acc.Root)
+			}
+			continue
+		}
+		if !bytes.Equal(acc.Root, storageRoot[:]) {
+			t.Errorf("account %d: storage root mismatch: have %x, want %x", i, acc.Root, storageRoot)
+		}
+		for j := byte(1); j <= 16; j++ {
+			if slot, err := snap.Storage(seedHash(i), seedHash(j)); err != nil || !bytes.Equal(slot, []byte{j}) {
+				t.Errorf("account %d: slot %d mismatch: have %x, %v", i, j, slot, err)
+			}
+		}
+	}
+	if acc, err := snap.Account(seedHash(0xff)); err != nil || acc != nil {
+		t.Errorf("junk account not wiped: have %v, %v", acc, err)
+	}
+	if has, _ := db.Has(snapshotGeneratorKey); has {
+		t.Errorf("generator marker not removed after generation")
+	}
+}
@@ -31,7 +31,9 @@ import (
 	check "gopkg.in/check.v1"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 )
 
@@ -97,12 +99,20 @@ func TestIntermediateLeaks(t *testing.T) {
 	}
 
 	// Commit and cross check the databases.
-	if _, err := transState.CommitTo(transDb, false); err != nil {
+	transRoot, err := transState.Commit(false)
+	if err != nil {
 		t.Fatalf("failed to commit transition state: %v", err)
 	}
-	if _, err := finalState.CommitTo(finalDb, false); err != nil {
+	if err = transState.Database().TrieDB().Commit(transRoot, false); err != nil {
+		t.Fatalf("failed to flush transition state: %v", err)
+	}
+	finalRoot, err := finalState.Commit(false)
+	if err != nil {
 		t.Fatalf("failed to commit final state: %v", err)
 	}
+	if err = finalState.Database().TrieDB().Commit(finalRoot, false); err != nil {
+		t.Fatalf("failed to flush final state: %v", err)
+	}
 	for _, key := range finalDb.Keys() {
 		if _, err := transDb.Get(key); err != nil {
 			val, _ := finalDb.Get(key)
@@ -117,6 +127,48 @@ func TestIntermediateLeaks(t *testing.T) {
 	}
 }
 
+// Tests that replacing the storage of an account drops all its previous slots,
+// both from reads and from the committed storage trie.
+func TestSetStorage(t *testing.T) {
+	// Create a state with an account holding a few storage slots
+	db, _ := ethdb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	addr := common.Address{0x01}
+	for i := byte(1); i <= 4; i++ {
+		state.SetState(addr, common.Hash{i}, common.Hash{i, i})
+	}
+	root, _ := state.Commit(false)
+	state.Database().TrieDB().Commit(root, false)
+
+	// Replace the storage and ensure only the new slots are visible
+	state, _ = New(root, state.Database())
+	state.SetStorage(addr, map[common.Hash]common.Hash{
+		{0x02}: {0x22},
+		{0x05}: {0x55},
+	})
+	want := map[common.Hash]common.Hash{
+		{0x01}: {},
+		{0x02}: {0x22},
+		{0x03}: {},
+		{0x05}: {0x55},
+	}
+	for key, val := range want {
+		if have := state.GetState(addr, key); have != val {
+			t.Errorf("slot %x: value mismatch: have %x, want %x", key, have, val)
+		}
+	}
+	// Ensure the committed state matches one created with the new storage only
+	finalDb, _ := ethdb.NewMemDatabase()
+	final, _ := New(common.Hash{}, NewDatabase(finalDb))
+	final.SetState(addr, common.Hash{0x02}, common.Hash{0x22})
+	final.SetState(addr, common.Hash{0x05}, common.Hash{0x55})
+
+	if have, want := state.IntermediateRoot(false), final.IntermediateRoot(false); have != want {
+		t.Errorf("state root mismatch: have %x, want %x", have, want)
+	}
+}
+
 // TestCopy tests that copying a statedb object indeed makes the original and
 // the copy independent of each other. This test is a regression test against
 // https://github.com/ethereum/go-ethereum/pull/15549.
@@ -409,7 +461,7 @@ func (test *snapshotTest) checkEqual(state, checkstate *StateDB) error {
 
 func (s *StateSuite) TestTouchDelete(c *check.C) {
 	s.state.GetOrNewStateObject(common.Address{})
-	root, _ := s.state.CommitTo(s.db, false)
+	root, _ := s.state.Commit(false)
 	s.state.Reset(root)
 
 	snapshot := s.state.Snapshot()
@@ -423,3 +475,81 @@ func (s *StateSuite) TestTouchDelete(c *check.C) {
 		c.Fatal("expected no dirty state object")
 	}
 }
+
+// Tests that committing a state backed by a snapshot pushes the modifications
+// into the snapshot tree, and that the new snapshot serves the same data as the
+// committed trie.
+func TestSnapshotTracking(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	sdb := NewDatabase(db)
+
+	// Create an initial state with a few accounts and storage slots
+	state, _ := New(common.Hash{}, sdb)
+	for i := byte(0); i < 16; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		state.AddBalance(addr, big.NewInt(int64(i)+1))
+		state.SetNonce(addr, uint64(i))
+		state.SetState(addr, common.Hash{i}, common.Hash{i, i})
+	}
+	root, _ := state.Commit(false)
+	sdb.TrieDB().Commit(root, false)
+
+	snaps := snapshot.New(db, sdb.TrieDB(), root)
+	defer snaps.Stop()
+
+	// Modify, delete and create a few accounts on top of the snapshot
+	modify := func(state *StateDB) {
+		state.AddBalance(common.BytesToAddress([]byte{1}), big.NewInt(100))
+		state.SetState(common.BytesToAddress([]byte{2}), common.Hash{2}, common.Hash{})
+		state.SetState(common.BytesToAddress([]byte{2}), common.Hash{0xff}, common.Hash{0xff})
+		state.Suicide(common.BytesToAddress([]byte{3}))
+		state.AddBalance(common.BytesToAddress([]byte{0xff}), big.NewInt(1))
+	}
+	plain, _ := New(root, sdb)
+	modify(plain)
+	want := plain.IntermediateRoot(false)
+
+	state, _ = NewWithSnapshot(root, sdb, snaps)
+	if state.snap == nil {
+		t.Fatalf("state not linked to snapshot")
+	}
+	modify(state)
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if root != want {
+		t.Fatalf("state root mismatch: have %x, want %x", root, want)
+	}
+	snap := snaps.Snapshot(root)
+	if snap == nil {
+		t.Fatalf("snapshot of committed state missing")
+	}
+	if acc, err := snap.Account(crypto.Keccak256Hash(common.BytesToAddress([]byte{3}).Bytes())); err != nil || acc != nil {
+		t.Errorf("deleted account in snapshot: %v, %v", acc, err)
+	}
+	if acc, err := snap.Account(crypto.Keccak256Hash(common.BytesToAddress([]byte{1}).Bytes())); err != nil || acc == nil || acc.Balance.Cmp(big.NewInt(102)) != 0 {
+		t.Errorf("modified account mismatch in snapshot: %v, %v", acc, err)
+	}
+	// Cross check the snapshot backed state with the plain trie one
+	snapState, _ := NewWithSnapshot(root, sdb, snaps)
+	trieState, _ := New(root, sdb)
+
+	for _, i := range []byte{0, 1, 2, 3, 4, 15, 0xff} {
+		addr := common.BytesToAddress([]byte{i})
+		if have, want := snapState.Exist(addr), trieState.Exist(addr); have != want {
+			t.Errorf("account %d: existence mismatch: have %v, want %v", i, have, want)
+		}
+		if have, want := snapState.GetBalance(addr), trieState.GetBalance(addr); have.Cmp(want) != 0 {
+			t.Errorf("account %d: balance mismatch: have %v, want %v", i, have, want)
+		}
+		if have, want := snapState.GetNonce(addr), trieState.GetNonce(addr); have != want {
+			t.Errorf("account %d: nonce mismatch: have %v, want %v", i, have, want)
+		}
+		for _, key := range []common.Hash{{i}, {0xff}} {
+			if have, want := snapState.GetState(addr, key), trieState.GetState(addr, key); have != want {
+				t.Errorf("account %d: slot %x mismatch: have %x, want %x", i, key, have, want)
+			}
+		}
+	}
+}
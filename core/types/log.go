@@ -69,7 +69,13 @@ type rlpLog struct {
 	Data    []byte
 }
 
-type rlpStorageLog struct {
+// rlpStorageLog is the storage encoding of a log. The derived fields are not
+// persisted, they are recomputed when loading the receipts of a block.
+type rlpStorageLog rlpLog
+
+// legacyRlpStorageLog is the previous storage encoding of a log, which also
+// persisted the derived fields.
+type legacyRlpStorageLog struct {
 	Address     common.Address
 	Topics      []common.Hash
 	Data        []byte
@@ -99,39 +105,51 @@ func (l *Log) String() string {
 	return fmt.Sprintf(`log: %x %x %x %x %d %x %d`, l.Address, l.Topics, l.Data, l.TxHash, l.TxIndex, l.BlockHash, l.Index)
 }
 
-// LogForStorage is a wrapper around a Log that flattens and parses the entire content of
-// a log including non-consensus fields.
+// LogForStorage is a wrapper around a Log that flattens and parses the stored
+// content of a log. The derived fields are only decoded from legacy entries.
 type LogForStorage Log
 
 // EncodeRLP implements rlp.Encoder.
 func (l *LogForStorage) EncodeRLP(w io.Writer) error {
 	return rlp.Encode(w, rlpStorageLog{
-		Address:     l.Address,
-		Topics:      l.Topics,
-		Data:        l.Data,
-		BlockNumber: l.BlockNumber,
-		TxHash:      l.TxHash,
-		TxIndex:     l.TxIndex,
-		BlockHash:   l.BlockHash,
-		Index:       l.Index,
+		Address: l.Address,
+		Topics:  l.Topics,
+		Data:    l.Data,
 	})
 }
 
 // DecodeRLP implements rlp.Decoder.
+//
+// Note some redundant fields (e.g. block number, tx hash etc) will be assembled
+// later.
 func (l *LogForStorage) DecodeRLP(s *rlp.Stream) error {
+	blob, err := s.Raw()
+	if err != nil {
+		return err
+	}
 	var dec rlpStorageLog
-	err := s.Decode(&dec)
-	if err == nil {
+	if err := rlp.DecodeBytes(blob, &dec); err == nil {
 		*l = LogForStorage{
-			Address:     dec.Address,
-			Topics:      dec.Topics,
-			Data:        dec.Data,
-			BlockNumber: dec.BlockNumber,
-			TxHash:      dec.TxHash,
-			TxIndex:     dec.TxIndex,
-			BlockHash:   dec.BlockHash,
-			Index:       dec.Index,
+			Address: dec.Address,
+			Topics:  dec.Topics,
+			Data:    dec.Data,
 		}
+		return nil
 	}
-	return err
+	// Try to decode the log in the legacy format
+	var legacy legacyRlpStorageLog
+	if err := rlp.DecodeBytes(blob, &legacy); err != nil {
+		return err
+	}
+	*l = LogForStorage{
+		Address:     legacy.Address,
+		Topics:      legacy.Topics,
+		Data:        legacy.Data,
+		BlockNumber: legacy.BlockNumber,
+		TxHash:      legacy.TxHash,
+		TxIndex:     legacy.TxIndex,
+		BlockHash:   legacy.BlockHash,
+		Index:       legacy.Index,
+	}
+	return nil
 }
@@ -20,9 +20,12 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
@@ -71,7 +74,19 @@ type receiptRLP struct {
 	Logs              []*Log
 }
 
-type receiptStorageRLP struct {
+// storedReceiptRLP is the storage encoding of a receipt. All implementation
+// fields are derived from the block body on retrieval, so only the consensus
+// fields are persisted.
+type storedReceiptRLP struct {
+	PostStateOrStatus []byte
+	CumulativeGasUsed uint64
+	Bloom             Bloom
+	Logs              []*LogForStorage
+}
+
+// legacyStoredReceiptRLP is the previous storage encoding of a receipt, which
+// also persisted the implementation fields.
+type legacyStoredReceiptRLP struct {
 	PostStateOrStatus []byte
 	CumulativeGasUsed uint64
 	Bloom             Bloom
@@ -145,20 +160,18 @@ func (r *Receipt) String() string {
 }
 
 // ReceiptForStorage is a wrapper around a Receipt that flattens and parses the
-// entire content of a receipt, as opposed to only the consensus fields originally.
+// stored content of a receipt. Only the consensus fields are encoded, the rest
+// need to be derived via Receipts.DeriveFields after decoding.
 type ReceiptForStorage Receipt
 
-// EncodeRLP implements rlp.Encoder, and flattens all content fields of a receipt
+// EncodeRLP implements rlp.Encoder, and flattens the stored fields of a receipt
 // into an RLP stream.
 func (r *ReceiptForStorage) EncodeRLP(w io.Writer) error {
-	enc := &receiptStorageRLP{
+	enc := &storedReceiptRLP{
 		PostStateOrStatus: (*Receipt)(r).statusEncoding(),
 		CumulativeGasUsed: r.CumulativeGasUsed,
 		Bloom:             r.Bloom,
-		TxHash:            r.TxHash,
-		ContractAddress:   r.ContractAddress,
 		Logs:              make([]*LogForStorage, len(r.Logs)),
-		GasUsed:           r.GasUsed,
 	}
 	for i, log := range r.Logs {
 		enc.Logs[i] = (*LogForStorage)(log)
@@ -166,11 +179,34 @@ func (r *ReceiptForStorage) EncodeRLP(w io.Writer) error {
 	return rlp.Encode(w, enc)
 }
 
-// DecodeRLP implements rlp.Decoder, and loads both consensus and implementation
-// fields of a receipt from an RLP stream.
+// DecodeRLP implements rlp.Decoder, and loads the stored fields of a receipt
+// from an RLP stream. Receipts in the legacy storage format are also accepted,
+// in which case the implementation fields are loaded too.
 func (r *ReceiptForStorage) DecodeRLP(s *rlp.Stream) error {
-	var dec receiptStorageRLP
-	if err := s.Decode(&dec); err != nil {
+	blob, err := s.Raw()
+	if err != nil {
+		return err
+	}
+	var dec storedReceiptRLP
+	if err := rlp.DecodeBytes(blob, &dec); err != nil {
+		return r.decodeLegacy(blob)
+	}
+	if err := (*Receipt)(r).setStatus(dec.PostStateOrStatus); err != nil {
+		return err
+	}
+	r.CumulativeGasUsed, r.Bloom = dec.CumulativeGasUsed, dec.Bloom
+	r.Logs = make([]*Log, len(dec.Logs))
+	for i, log := range dec.Logs {
+		r.Logs[i] = (*Log)(log)
+	}
+	return nil
+}
+
+// decodeLegacy loads a receipt stored in the legacy format, which contains
+// both consensus and implementation fields.
+func (r *ReceiptForStorage) decodeLegacy(blob []byte) error {
+	var dec legacyStoredReceiptRLP
+	if err := rlp.DecodeBytes(blob, &dec); err != nil {
 		return err
 	}
 	if err := (*Receipt)(r).setStatus(dec.PostStateOrStatus); err != nil {
@@ -201,3 +237,44 @@ func (r Receipts) GetRlp(i int) []byte {
 	}
 	return bytes
 }
+
+// DeriveFields fills the receipts with their implementation fields and the log
+// metadata, computed from the block they were generated in and its transactions.
+func (r Receipts) DeriveFields(config *params.ChainConfig, hash common.Hash, number uint64, txs Transactions) error {
+	if len(txs) != len(r) {
+		return fmt.Errorf("transaction and receipt count mismatch: %d != %d", len(txs), len(r))
+	}
+	signer := MakeSigner(config, new(big.Int).SetUint64(number))
+
+	logIndex := uint(0)
+	for i := 0; i < len(r); i++ {
+		// The transaction hash can be retrieved from the transaction itself
+		r[i].TxHash = txs[i].Hash()
+
+		// The contract address can be derived from the transaction itself
+		if txs[i].To() == nil {
+			// Deriving the sender is expensive, only do if it's actually needed
+			from, err := Sender(signer, txs[i])
+			if err != nil {
+				return fmt.Errorf("failed to derive sender of tx #%d: %v", i, err)
+			}
+			r[i].ContractAddress = crypto.CreateAddress(from, txs[i].Nonce())
+		}
+		// The used gas can be calculated based on previous receipts
+		if i == 0 {
+			r[i].GasUsed = r[i].CumulativeGasUsed
+		} else {
+			r[i].GasUsed = r[i].CumulativeGasUsed - r[i-1].CumulativeGasUsed
+		}
+		// The derived log fields can simply be set from the block and transaction
+		for j := 0; j < len(r[i].Logs); j++ {
+			r[i].Logs[j].BlockNumber = number
+			r[i].Logs[j].BlockHash = hash
+			r[i].Logs[j].TxHash = r[i].TxHash
+			r[i].Logs[j].TxIndex = uint(i)
+			r[i].Logs[j].Index = logIndex
+			logIndex++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that receipts stored in the legacy format, which persisted the derived
+// fields too, can still be decoded, and are converted to the slim format when
+// encoded again.
+func TestLegacyReceiptDecoding(t *testing.T) {
+	legacy := &legacyStoredReceiptRLP{
+		PostStateOrStatus: receiptStatusSuccessfulRLP,
+		CumulativeGasUsed: 1,
+		TxHash:            common.BytesToHash([]byte{0x11, 0x11}),
+		ContractAddress:   common.BytesToAddress([]byte{0x01, 0x11, 0x11}),
+		GasUsed:           1,
+	}
+	logs := []*legacyRlpStorageLog{{
+		Address:     common.BytesToAddress([]byte{0x11}),
+		Topics:      []common.Hash{common.HexToHash("dead"), common.HexToHash("beef")},
+		Data:        []byte{0x01, 0x00, 0xff},
+		BlockNumber: 1,
+		TxHash:      legacy.TxHash,
+		BlockHash:   common.BytesToHash([]byte{0x22, 0x22}),
+	}}
+	blob, err := rlp.EncodeToBytes([]interface{}{
+		legacy.PostStateOrStatus, legacy.CumulativeGasUsed, legacy.Bloom,
+		legacy.TxHash, legacy.ContractAddress, logs, legacy.GasUsed,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode legacy receipt: %v", err)
+	}
+	var receipt ReceiptForStorage
+	if err := rlp.DecodeBytes(blob, &receipt); err != nil {
+		t.Fatalf("failed to decode legacy receipt: %v", err)
+	}
+	if receipt.Status != ReceiptStatusSuccessful || receipt.CumulativeGasUsed != legacy.CumulativeGasUsed {
+		t.Errorf("consensus fields mismatch: %v", (*Receipt)(&receipt))
+	}
+	if receipt.TxHash != legacy.TxHash || receipt.ContractAddress != legacy.ContractAddress || receipt.GasUsed != legacy.GasUsed {
+		t.Errorf("implementation fields mismatch: have %x %x %d, want %x %x %d",
+			receipt.TxHash, receipt.ContractAddress, receipt.GasUsed, legacy.TxHash, legacy.ContractAddress, legacy.GasUsed)
+	}
+	if len(receipt.Logs) != 1 {
+		t.Fatalf("log count mismatch: have %d, want 1", len(receipt.Logs))
+	}
+	if log := receipt.Logs[0]; log.Address != logs[0].Address || !bytes.Equal(log.Data, logs[0].Data) || log.BlockHash != logs[0].BlockHash {
+		t.Errorf("log mismatch: have %v, want %v", log, logs[0])
+	}
+	// Re-encode the receipt and ensure the derived fields are dropped
+	slim, err := rlp.EncodeToBytes(&receipt)
+	if err != nil {
+		t.Fatalf("failed to encode receipt: %v", err)
+	}
+	if len(slim) >= len(blob) {
+		t.Errorf("receipt not slimmed: have %d bytes, legacy %d bytes", len(slim), len(blob))
+	}
+	var dec ReceiptForStorage
+	if err := rlp.DecodeBytes(slim, &dec); err != nil {
+		t.Fatalf("failed to decode slim receipt: %v", err)
+	}
+	if dec.TxHash != (common.Hash{}) || dec.Logs[0].BlockHash != (common.Hash{}) {
+		t.Errorf("derived fields stored in slim receipt: %v", (*Receipt)(&dec))
+	}
+}
+
+// Tests that the non-consensus fields of receipts are derived from the block and
+// its transactions, recovering the senders with the signer of the chain config.
+func TestDeriveFields(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := NewEIP155Signer(params.TestChainConfig.ChainId)
+
+	tx1, _ := SignTx(NewContractCreation(0, big.NewInt(1), 1, big.NewInt(1), nil), signer, key)
+	tx2, _ := SignTx(NewTransaction(1, common.HexToAddress("0x2"), big.NewInt(2), 2, big.NewInt(2), nil), signer, key)
+	txs := Transactions{tx1, tx2}
+
+	receipts := Receipts{
+		{CumulativeGasUsed: 1, Logs: []*Log{{Address: common.BytesToAddress([]byte{0x11})}}},
+		{CumulativeGasUsed: 3, Logs: []*Log{{Address: common.BytesToAddress([]byte{0x22})}}},
+	}
+	hash, number := common.BytesToHash([]byte{0x03, 0x14}), uint64(1)
+	if err := receipts.DeriveFields(params.TestChainConfig, hash, number, txs); err != nil {
+		t.Fatalf("failed to derive receipt fields: %v", err)
+	}
+	if want := crypto.CreateAddress(crypto.PubkeyToAddress(key.PublicKey), 0); receipts[0].ContractAddress != want {
+		t.Errorf("contract address mismatch: have %x, want %x", receipts[0].ContractAddress, want)
+	}
+	for i, receipt := range receipts {
+		if receipt.TxHash != txs[i].Hash() {
+			t.Errorf("receipt %d: tx hash mismatch: have %x, want %x", i, receipt.TxHash, txs[i].Hash())
+		}
+		if want := uint64(i + 1); receipt.GasUsed != want {
+			t.Errorf("receipt %d: gas used mismatch: have %d, want %d", i, receipt.GasUsed, want)
+		}
+		if log := receipt.Logs[0]; log.BlockHash != hash || log.BlockNumber != number || log.TxHash != txs[i].Hash() || log.TxIndex != uint(i) || log.Index != uint(i) {
+			t.Errorf("receipt %d: log metadata mismatch: %v", i, log)
+		}
+	}
+	// Transactions can't be matched up with a different number of receipts
+	if err := receipts[:1].DeriveFields(params.TestChainConfig, hash, number, txs); err == nil {
+		t.Errorf("derived fields despite receipt count mismatch")
+	}
+}
@@ -52,6 +52,16 @@ func MakeSigner(config *params.ChainConfig, blockNumber *big.Int) Signer {
 	return signer
 }
 
+// MakeShardSigner returns the Signer of transactions executed in the given shard
+// and period. Once the sharding ruleset is active, shard transactions have to be
+// signed for their shard, before that the main chain rules apply.
+func MakeShardSigner(config *params.ChainConfig, shardId, period *big.Int) Signer {
+	if config.IsSharding(period) {
+		return NewShardSigner(config.ChainId, shardId)
+	}
+	return MakeSigner(config, period)
+}
+
 // SignTx signs the transaction using the given signer and private key
 func SignTx(tx *Transaction, s Signer, prv *ecdsa.PrivateKey) (*Transaction, error) {
 	h := s.Hash(tx)
@@ -164,6 +174,53 @@ func (s EIP155Signer) Hash(tx *Transaction) common.Hash {
 	})
 }
 
+// ShardSigner implements Signer for transactions targeted at a shard. It uses
+// the EIP155 signature encoding, but the signed hash also commits to the shard
+// ID, so a transaction is only valid on the shard it was signed for and never on
+// the main chain. Unprotected transactions are rejected.
+type ShardSigner struct {
+	EIP155Signer
+	shardId *big.Int
+}
+
+func NewShardSigner(chainId, shardId *big.Int) ShardSigner {
+	if shardId == nil {
+		shardId = new(big.Int)
+	}
+	return ShardSigner{
+		EIP155Signer: NewEIP155Signer(chainId),
+		shardId:      shardId,
+	}
+}
+
+func (s ShardSigner) Equal(s2 Signer) bool {
+	shard, ok := s2.(ShardSigner)
+	return ok && shard.chainId.Cmp(s.chainId) == 0 && shard.shardId.Cmp(s.shardId) == 0
+}
+
+func (s ShardSigner) Sender(tx *Transaction) (common.Address, error) {
+	if tx.ChainId().Cmp(s.chainId) != 0 {
+		return common.Address{}, ErrInvalidChainId
+	}
+	V := new(big.Int).Sub(tx.data.V, s.chainIdMul)
+	V.Sub(V, big8)
+	return recoverPlain(s.Hash(tx), tx.data.R, tx.data.S, V, true)
+}
+
+// Hash returns the hash to be signed by the sender.
+// It does not uniquely identify the transaction.
+func (s ShardSigner) Hash(tx *Transaction) common.Hash {
+	return rlpHash([]interface{}{
+		tx.data.AccountNonce,
+		tx.data.Price,
+		tx.data.GasLimit,
+		tx.data.Recipient,
+		tx.data.Amount,
+		tx.data.Payload,
+		s.chainId, s.shardId, uint(0),
+	})
+}
+
 // HomesteadTransaction implements TransactionInterface using the
 // homestead rules.
 type HomesteadSigner struct{ FrontierSigner }
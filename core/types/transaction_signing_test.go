@@ -76,6 +76,38 @@ func TestEIP155ChainId(t *testing.T) {
 	}
 }
 
+func TestShardSigning(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	signer := NewShardSigner(big.NewInt(18), big.NewInt(3))
+	tx, err := SignTx(NewTransaction(0, addr, new(big.Int), 0, new(big.Int), nil), signer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := Sender(signer, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != addr {
+		t.Errorf("expected from and address to be equal. Got %x want %x", from, addr)
+	}
+	// The signature must not be valid on other shards or on the main chain
+	for _, other := range []Signer{NewShardSigner(big.NewInt(18), big.NewInt(4)), NewEIP155Signer(big.NewInt(18))} {
+		if from, err := Sender(other, tx); err == nil && from == addr {
+			t.Errorf("shard transaction accepted by %T %v", other, other)
+		}
+	}
+	// Unprotected transactions are invalid on all shards
+	tx, err = SignTx(NewTransaction(0, addr, new(big.Int), 0, new(big.Int), nil), HomesteadSigner{}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Sender(signer, tx); err != ErrInvalidChainId {
+		t.Errorf("unprotected transaction error mismatch: have %v, want %v", err, ErrInvalidChainId)
+	}
+}
+
 func TestEIP155SigningVitalik(t *testing.T) {
 	// Test vectors come from http://vitalik.ca/files/eip155_testvec.txt
 	for i, test := range []struct {
@@ -73,6 +73,10 @@ type Context struct {
 	BlockNumber *big.Int       // Provides information for NUMBER
 	Time        *big.Int       // Provides information for TIME
 	Difficulty  *big.Int       // Provides information for DIFFICULTY
+
+	// Shard information (sharding rules only)
+	ShardID *big.Int // Provides information for SHARDID
+	Period  *big.Int // Provides information for PERIOD
 }
 
 // EVM is the Ethereum Virtual Machine base object and provides
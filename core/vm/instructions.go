@@ -466,6 +466,24 @@ func opNumber(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *S
 	return nil, nil
 }
 
+func opShardID(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	shard := new(big.Int)
+	if evm.ShardID != nil {
+		shard.Set(evm.ShardID)
+	}
+	stack.push(math.U256(shard))
+	return nil, nil
+}
+
+func opPeriod(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	period := new(big.Int)
+	if evm.Period != nil {
+		period.Set(evm.Period)
+	}
+	stack.push(math.U256(period))
+	return nil, nil
+}
+
 func opDifficulty(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
 	stack.push(math.U256(new(big.Int).Set(evm.Difficulty)))
 	return nil, nil
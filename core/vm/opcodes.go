@@ -94,6 +94,10 @@ const (
 	NUMBER
 	DIFFICULTY
 	GASLIMIT
+
+	// sharding extensions
+	SHARDID
+	PERIOD
 )
 
 const (
@@ -264,6 +268,8 @@ var opCodeToString = map[OpCode]string{
 	NUMBER:     "NUMBER",
 	DIFFICULTY: "DIFFICULTY",
 	GASLIMIT:   "GASLIMIT",
+	SHARDID:    "SHARDID",
+	PERIOD:     "PERIOD",
 
 	// 0x50 range - 'storage' and execution
 	POP: "POP",
@@ -426,6 +432,8 @@ var stringToOp = map[string]OpCode{
 	"NUMBER":         NUMBER,
 	"DIFFICULTY":     DIFFICULTY,
 	"GASLIMIT":       GASLIMIT,
+	"SHARDID":        SHARDID,
+	"PERIOD":         PERIOD,
 	"POP":            POP,
 	"MLOAD":          MLOAD,
 	"MSTORE":         MSTORE,
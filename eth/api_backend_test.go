@@ -0,0 +1,418 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// newTestAPIClient creates a chain with the given genesis allocation and a few
+// empty blocks on top, and returns an in-process RPC client serving the public
+// blockchain API of a full node backed by it.
+func newTestAPIClient(t *testing.T, alloc core.GenesisAlloc) (*rpc.Client, func()) {
+	var (
+		db, _         = ethdb.NewMemDatabase()
+		gspec         = &core.Genesis{Config: params.TestChainConfig, Alloc: alloc}
+		genesis       = gspec.MustCommit(db)
+		blockchain, _ = core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	)
+	chain, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 2, nil)
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("Failed to import chain: %v", err)
+	}
+	backend := &EthApiBackend{eth: &Ethereum{chainConfig: gspec.Config, blockchain: blockchain, chainDb: db}}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", ethapi.NewPublicBlockChainAPI(backend)); err != nil {
+		t.Fatalf("Failed to register blockchain API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+
+	return client, func() {
+		client.Close()
+		server.Stop()
+		blockchain.Stop()
+	}
+}
+
+// Tests that a balance override of the sender of a call replaces the funding
+// eth_call otherwise hands to the sender to pay for the gas.
+func TestCallSenderBalanceOverride(t *testing.T) {
+	// CALLER, BALANCE, PUSH1 0, MSTORE, PUSH1 32, PUSH1 0, RETURN
+	contract := common.Address{0xc0}
+	client, stop := newTestAPIClient(t, core.GenesisAlloc{
+		contract: {Code: common.FromHex("0x333160005260206000f3"), Balance: new(big.Int)},
+	})
+	defer stop()
+
+	var (
+		from      = common.Address{0x01}
+		balance   = big.NewInt(params.Ether)
+		overrides = map[common.Address]interface{}{
+			from: map[string]interface{}{"balance": (*hexutil.Big)(balance)},
+		}
+		args = map[string]interface{}{
+			"from":     from,
+			"to":       contract,
+			"gas":      hexutil.Uint64(100000),
+			"gasPrice": (*hexutil.Big)(big.NewInt(1)),
+		}
+	)
+	var result hexutil.Bytes
+	if err := client.Call(&result, "eth_call", args, "latest", overrides); err != nil {
+		t.Fatalf("Failed to execute call: %v", err)
+	}
+	// The gas of the call is bought up front, before the contract runs
+	want := new(big.Int).Sub(balance, big.NewInt(100000))
+	if have := new(big.Int).SetBytes(result); have.Cmp(want) != 0 {
+		t.Errorf("Sender balance mismatch: have %v, want %v", have, want)
+	}
+}
+
+// Tests that eth_call reports every failed execution as an error, carrying the
+// revert data only if the execution returned any.
+func TestCallFailures(t *testing.T) {
+	var (
+		reverter = common.Address{0xc0}
+		reasoner = common.Address{0xc1}
+		reason   = "0x08c379a0" + // Error(string) selector
+			"0000000000000000000000000000000000000000000000000000000000000020" +
+			"0000000000000000000000000000000000000000000000000000000000000004" +
+			"626f6f6d00000000000000000000000000000000000000000000000000000000" // "boom"
+	)
+	client, stop := newTestAPIClient(t, core.GenesisAlloc{
+		// PUSH1 0, PUSH1 0, REVERT
+		reverter: {Code: common.FromHex("0x60006000fd"), Balance: new(big.Int)},
+		// PUSH1 100, PUSH1 12, PUSH1 0, CODECOPY, PUSH1 100, PUSH1 0, REVERT, <reason>
+		reasoner: {Code: common.FromHex("0x6064600c60003960646000fd" + reason[2:]), Balance: new(big.Int)},
+	})
+	defer stop()
+
+	from := common.Address{0x01}
+	tests := []struct {
+		args map[string]interface{}
+		err  string
+		data interface{}
+	}{
+		// Revert with a reason, returning the reason and the revert data
+		{map[string]interface{}{"from": from, "to": reasoner}, "execution reverted: boom", reason},
+		// Revert without any data
+		{map[string]interface{}{"from": from, "to": reverter}, "execution failed", nil},
+		// Out of gas in the ecrecover precompile, as the call only pays the intrinsic gas
+		{map[string]interface{}{"from": from, "to": common.BytesToAddress([]byte{1}), "gas": hexutil.Uint64(params.TxGas)}, "execution failed", nil},
+	}
+	for i, tt := range tests {
+		var result hexutil.Bytes
+		err := client.Call(&result, "eth_call", tt.args, "latest")
+		if err == nil {
+			t.Errorf("test %d: call succeeded: %x", i, result)
+			continue
+		}
+		if err.Error() != tt.err {
+			t.Errorf("test %d: error mismatch: have %q, want %q", i, err, tt.err)
+		}
+		if data := err.(rpc.DataError).ErrorData(); data != tt.data {
+			t.Errorf("test %d: error data mismatch: have %v, want %v", i, data, tt.data)
+		}
+	}
+}
+
+// tokenCode is the runtime code of the sample token contract of ethereum.org,
+// which keeps the balances in slot 3 and the allowances in slot 4.
+const tokenCode = "0x" +
+	"606060405236156100775760e060020a600035046306fdde03811461007f57806323b872dd146100dc578063313ce5671461010e57806370a082311461011a57" +
+	"806395d89b4114610132578063a9059cbb1461018e578063cae9ca51146101bd578063dc3080f21461031c578063dd62ed3e14610341575b610365610002565b" +
+	"61036760008054602060026001831615610100026000190190921691909104601f810182900490910260809081016040526060828152929190828280156104eb" +
+	"5780601f106104c0576101008083540402835291602001916104eb565b6103d5600435602435604435600160a060020a03831660009081526003602052604081" +
+	"2054829010156104f357610002565b6103e760025460ff1681565b6103d560043560036020526000908152604090205481565b61036760018054602060028284" +
+	"1615610100026000190190921691909104601f810182900490910260809081016040526060828152929190828280156104eb5780601f106104c0576101008083" +
+	"540402835291602001916104eb565b610365600435602435600160a060020a033316600090815260036020526040902054819010156103f157610002565b6080" +
+	"6020604435600481810135601f8101849004909302840160405260608381526103d5948235946024803595606494939101919081908382808284375094965050" +
+	"505050505060006000836004600050600033600160a060020a03168152602001908152602001600020600050600087600160a060020a03168152602001908152" +
+	"6020016000206000508190555084905080600160a060020a0316638f4ffcb1338630876040518560e060020a0281526004018085600160a060020a0316815260" +
+	"200184815260200183600160a060020a03168152602001806020018281038252838181518152602001915080519060200190808383829060006004602084601f" +
+	"0104600f02600301f150905090810190601f1680156102f25780820380516001836020036101000a031916815260200191505b50955050505050506000604051" +
+	"808303816000876161da5a03f11561000257505050509392505050565b6005602090815260043560009081526040808220909252602435815220546103d59081" +
+	"565b60046020818152903560009081526040808220909252602435815220546103d59081565b005b604051808060200182810382528381815181526020019150" +
+	"80519060200190808383829060006004602084601f0104600f02600301f150905090810190601f1680156103c75780820380516001836020036101000a031916" +
+	"815260200191505b509250505060405180910390f35b60408051918252519081900360200190f35b6060908152602090f35b600160a060020a03821660009081" +
+	"526040902054808201101561041357610002565b806003600050600033600160a060020a03168152602001908152602001600020600082828250540392505081" +
+	"905550806003600050600084600160a060020a0316815260200190815260200160002060008282825054019250508190555081600160a060020a031633600160" +
+	"a060020a03167fddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef836040518082815260200191505060405180910390a3505056" +
+	"5b820191906000526020600020905b8154815290600101906020018083116104ce57829003601f168201915b505050505081565b600160a060020a0383168152" +
+	"6040812054808301101561051257610002565b600160a060020a0380851680835260046020908152604080852033949094168086529382528085205492855260" +
+	"058252808520938552929052908220548301111561055c57610002565b816003600050600086600160a060020a03168152602001908152602001600020600082" +
+	"828250540392505081905550816003600050600085600160a060020a031681526020019081526020016000206000828282505401925050819055508160056000" +
+	"50600086600160a060020a03168152602001908152602001600020600050600033600160a060020a031681526020019081526020016000206000828282505401" +
+	"9250508190555082600160a060020a031633600160a060020a03167fddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef84604051" +
+	"8082815260200191505060405180910390a3939250505056"
+
+// tokenABI is the interface of the sample token contract of ethereum.org, limited
+// to the methods used by the tests.
+const tokenABI = `[{"constant":false,"inputs":[{"name":"_from","type":"address"},{"name":"_to","type":"address"},{"name":"_value","type":"uint256"}],"name":"transferFrom","outputs":[{"name":"success","type":"bool"}],"type":"function"},{"constant":true,"inputs":[{"name":"","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"type":"function"},{"constant":false,"inputs":[{"name":"_spender","type":"address"},{"name":"_value","type":"uint256"},{"name":"_extraData","type":"bytes"}],"name":"approveAndCall","outputs":[{"name":"success","type":"bool"}],"type":"function"}]`
+
+// Tests that the calls of a bundle see the state changes of the previous ones,
+// such as a token allowance granted right before it is spent.
+func TestCallBundleDependentCalls(t *testing.T) {
+	var (
+		token                = common.Address{0xc0}
+		owner, spender, dest = common.Address{0x01}, common.Address{0x02}, common.Address{0x03}
+	)
+	// Give the owner 1000 tokens
+	slot := crypto.Keccak256Hash(common.LeftPadBytes(owner.Bytes(), 32), common.LeftPadBytes([]byte{3}, 32))
+	client, stop := newTestAPIClient(t, core.GenesisAlloc{
+		token: {
+			Code:    common.FromHex(tokenCode),
+			Storage: map[common.Hash]common.Hash{slot: common.BigToHash(big.NewInt(1000))},
+			Balance: new(big.Int),
+		},
+	})
+	defer stop()
+
+	parsed, err := abi.JSON(strings.NewReader(tokenABI))
+	if err != nil {
+		t.Fatalf("Failed to parse token ABI: %v", err)
+	}
+	pack := func(method string, args ...interface{}) hexutil.Bytes {
+		data, err := parsed.Pack(method, args...)
+		if err != nil {
+			t.Fatalf("Failed to pack %s call: %v", method, err)
+		}
+		return data
+	}
+	calls := []map[string]interface{}{
+		{"from": owner, "to": token, "data": pack("approveAndCall", spender, big.NewInt(100), []byte{})},
+		{"from": spender, "to": token, "data": pack("transferFrom", owner, dest, big.NewInt(100))},
+		{"from": dest, "to": token, "data": pack("balanceOf", dest)},
+	}
+	var results []*ethapi.BundleCallResult
+	if err := client.Call(&results, "eth_callBundle", calls, "latest"); err != nil {
+		t.Fatalf("Failed to execute call bundle: %v", err)
+	}
+	if len(results) != len(calls) {
+		t.Fatalf("Result count mismatch: have %d, want %d", len(results), len(calls))
+	}
+	for i, result := range results {
+		if result.Failed {
+			t.Fatalf("Call %d failed", i)
+		}
+	}
+	if len(results[1].Logs) != 1 {
+		t.Errorf("Transfer log count mismatch: have %d, want 1", len(results[1].Logs))
+	}
+	if balance := new(big.Int).SetBytes(results[2].ReturnValue); balance.Cmp(big.NewInt(100)) != 0 {
+		t.Errorf("Token balance mismatch: have %v, want 100", balance)
+	}
+	// Without the allowance, the transfer fails
+	if err := client.Call(&results, "eth_callBundle", calls[1:2], "latest"); err != nil {
+		t.Fatalf("Failed to execute call bundle: %v", err)
+	}
+	if !results[0].Failed {
+		t.Errorf("Transfer without allowance succeeded")
+	}
+}
+
+// Tests that the senders of a bundle are funded only once, so their balance
+// changes carry over to their later calls.
+func TestCallBundleSenderFunding(t *testing.T) {
+	// CALLER, BALANCE, PUSH1 0, MSTORE, PUSH1 32, PUSH1 0, RETURN
+	contract := common.Address{0xc0}
+	client, stop := newTestAPIClient(t, core.GenesisAlloc{
+		contract: {Code: common.FromHex("0x333160005260206000f3"), Balance: new(big.Int)},
+	})
+	defer stop()
+
+	var (
+		from  = common.Address{0x01}
+		price = (*hexutil.Big)(big.NewInt(1))
+		value = big.NewInt(params.Ether)
+	)
+	calls := []map[string]interface{}{
+		{"from": from, "to": common.Address{0x02}, "gasPrice": price, "value": (*hexutil.Big)(value)},
+		{"from": from, "to": contract, "gasPrice": price, "gas": hexutil.Uint64(100000)},
+	}
+	var results []*ethapi.BundleCallResult
+	if err := client.Call(&results, "eth_callBundle", calls, "latest"); err != nil {
+		t.Fatalf("Failed to execute call bundle: %v", err)
+	}
+	// The sender paid for the transfer, its gas and the gas bought by the second call
+	want := new(big.Int).Sub(math.MaxBig256, value)
+	want.Sub(want, new(big.Int).SetUint64(uint64(results[0].GasUsed)+100000))
+	if have := new(big.Int).SetBytes(results[1].ReturnValue); have.Cmp(want) != 0 {
+		t.Errorf("Sender balance mismatch: have %v, want %v", have, want)
+	}
+}
+
+// Tests that the block context of the calls of a bundle can be overridden.
+func TestCallBundleBlockOverrides(t *testing.T) {
+	// NUMBER, PUSH1 0, MSTORE, TIMESTAMP, PUSH1 32, MSTORE, COINBASE, PUSH1 64,
+	// MSTORE, PUSH1 96, PUSH1 0, RETURN
+	contract := common.Address{0xc0}
+	client, stop := newTestAPIClient(t, core.GenesisAlloc{
+		contract: {Code: common.FromHex("0x43600052426020524160405260606000f3"), Balance: new(big.Int)},
+	})
+	defer stop()
+
+	var (
+		number   = big.NewInt(100)
+		time     = big.NewInt(1234567890)
+		coinbase = common.Address{0xcb}
+	)
+	calls := []map[string]interface{}{{"from": common.Address{0x01}, "to": contract}}
+	overrides := map[string]interface{}{
+		"number":    (*hexutil.Big)(number),
+		"timestamp": (*hexutil.Big)(time),
+		"coinbase":  coinbase,
+	}
+	var results []*ethapi.BundleCallResult
+	if err := client.Call(&results, "eth_callBundle", calls, "latest", overrides); err != nil {
+		t.Fatalf("Failed to execute call bundle: %v", err)
+	}
+	ret := results[0].ReturnValue
+	if len(ret) != 96 {
+		t.Fatalf("Return value length mismatch: have %d, want 96", len(ret))
+	}
+	if have := new(big.Int).SetBytes(ret[:32]); have.Cmp(number) != 0 {
+		t.Errorf("Block number mismatch: have %v, want %v", have, number)
+	}
+	if have := new(big.Int).SetBytes(ret[32:64]); have.Cmp(time) != 0 {
+		t.Errorf("Timestamp mismatch: have %v, want %v", have, time)
+	}
+	if have := common.BytesToAddress(ret[64:]); have != coinbase {
+		t.Errorf("Coinbase mismatch: have %x, want %x", have, coinbase)
+	}
+	// Without overrides, the context of the requested block is used
+	if err := client.Call(&results, "eth_callBundle", calls, "latest"); err != nil {
+		t.Fatalf("Failed to execute call bundle: %v", err)
+	}
+	if have := new(big.Int).SetBytes(results[0].ReturnValue[:32]); have.Uint64() != 2 {
+		t.Errorf("Block number mismatch: have %v, want 2", have)
+	}
+}
+
+// Tests that the calls of a bundle are capped to the gas limit of the block they
+// are executed on, so a never ending call runs out of gas instead of hanging.
+func TestCallBundleInfiniteLoop(t *testing.T) {
+	// JUMPDEST, PUSH1 0, JUMP
+	contract := common.Address{0xc0}
+	client, stop := newTestAPIClient(t, core.GenesisAlloc{
+		contract: {Code: common.FromHex("0x5b600056"), Balance: new(big.Int)},
+	})
+	defer stop()
+
+	var block map[string]interface{}
+	if err := client.Call(&block, "eth_getBlockByNumber", "latest", false); err != nil {
+		t.Fatalf("Failed to retrieve head block: %v", err)
+	}
+	limit, _ := hexutil.DecodeUint64(block["gasLimit"].(string))
+
+	// A single looping call consumes all the gas of the block
+	calls := []map[string]interface{}{{"from": common.Address{0x01}, "to": contract}}
+
+	var results []*ethapi.BundleCallResult
+	if err := client.Call(&results, "eth_callBundle", calls, "latest"); err != nil {
+		t.Fatalf("Failed to execute call bundle: %v", err)
+	}
+	if !results[0].Failed {
+		t.Errorf("Looping call succeeded")
+	}
+	if uint64(results[0].GasUsed) != limit {
+		t.Errorf("Gas used mismatch: have %d, want %d", results[0].GasUsed, limit)
+	}
+	// Any further call exceeds the gas limit of the bundle, even if it asks for more
+	calls = append(calls, map[string]interface{}{"from": common.Address{0x01}, "to": contract, "gas": hexutil.Uint64(2 * limit)})
+	if err := client.Call(&results, "eth_callBundle", calls, "latest"); err == nil || !strings.Contains(err.Error(), "bundle gas limit") {
+		t.Errorf("Bundle gas limit error mismatch: have %v, want bundle gas limit exhausted", err)
+	}
+}
+
+// Tests that looking up transactions of blocks outside the transaction lookup
+// limit is reported as an error once the index is trimmed, instead of as unknown.
+func TestGetTransactionByHashUnindexed(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		db, _   = ethdb.NewMemDatabase()
+		gspec   = &core.Genesis{Config: params.TestChainConfig, Alloc: core.GenesisAlloc{addr: {Balance: big.NewInt(params.Ether)}}}
+		genesis = gspec.MustCommit(db)
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 8, func(i int, gen *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr), common.Address{0x01}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+		gen.AddTx(tx)
+	})
+	config := &core.CacheConfig{TrieNodeLimit: 256, TrieTimeLimit: 5 * time.Minute, TxLookupLimit: 4}
+	blockchain, _ := core.NewBlockChain(db, config, gspec.Config, ethash.NewFaker(), vm.Config{})
+	defer blockchain.Stop()
+
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("Failed to import chain: %v", err)
+	}
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if tail := core.GetTxIndexTail(db); tail != nil && *tail == 5 && !blockchain.TxIndexInProgress() {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Transaction index not trimmed: tail %v", core.GetTxIndexTail(db))
+		}
+	}
+	poolConfig := core.DefaultTxPoolConfig
+	poolConfig.Journal = ""
+	txpool := core.NewTxPool(poolConfig, gspec.Config, blockchain)
+	defer txpool.Stop()
+
+	backend := &EthApiBackend{eth: &Ethereum{chainConfig: gspec.Config, blockchain: blockchain, txPool: txpool, chainDb: db}}
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("eth", ethapi.NewPublicTransactionPoolAPI(backend, new(ethapi.AddrLocker))); err != nil {
+		t.Fatalf("Failed to register transaction pool API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	// Transactions of indexed blocks are found, the others are reported as unindexed
+	for _, block := range blocks {
+		var result map[string]interface{}
+		err := client.Call(&result, "eth_getTransactionByHash", block.Transactions()[0].Hash())
+		if block.NumberU64() >= 5 {
+			if err != nil || result == nil {
+				t.Errorf("Block %d: failed to retrieve indexed transaction: %v", block.NumberU64(), err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "indexing not available") {
+			t.Errorf("Block %d: unindexed transaction error mismatch: have %v, want indexing not available", block.NumberU64(), err)
+		}
+	}
+}
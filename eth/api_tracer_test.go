@@ -0,0 +1,136 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that debug_traceCall traces a call on top of the requested block, even
+// if the sender can't afford the gas of the call.
+func TestTraceCall(t *testing.T) {
+	var (
+		db, _    = ethdb.NewMemDatabase()
+		contract = common.Address{0xc0}
+		gspec    = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: core.GenesisAlloc{
+				// PUSH1 1, PUSH1 0, SSTORE, STOP
+				contract: {Code: common.FromHex("0x600160005500"), Balance: new(big.Int)},
+			},
+		}
+		genesis       = gspec.MustCommit(db)
+		blockchain, _ = core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	)
+	defer blockchain.Stop()
+
+	chain, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 2, nil)
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("Failed to import chain: %v", err)
+	}
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("debug", NewPrivateDebugAPI(gspec.Config, &Ethereum{blockchain: blockchain, chainDb: db})); err != nil {
+		t.Fatalf("Failed to register debug API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	// The sender is unfunded and pays the default gas price
+	args := ethapi.CallArgs{From: common.Address{0x01}, To: &contract}
+	for _, block := range []interface{}{"latest", "0x1", map[string]interface{}{"blockHash": chain[0].Hash()}} {
+		var result ethapi.ExecutionResult
+		if err := client.Call(&result, "debug_traceCall", args, block); err != nil {
+			t.Fatalf("Failed to trace call on block %v: %v", block, err)
+		}
+		if result.Failed {
+			t.Errorf("Call on block %v failed", block)
+		}
+		if len(result.StructLogs) != 4 {
+			t.Fatalf("Trace length mismatch on block %v: have %d, want 4", block, len(result.StructLogs))
+		}
+		if op := result.StructLogs[2].Op; op != "SSTORE" {
+			t.Errorf("Traced opcode mismatch on block %v: have %s, want SSTORE", block, op)
+		}
+	}
+}
+
+// Tests that debug_traceCall caps the gas allowance of the call to the gas limit
+// of the block and aborts calls running for longer than the requested timeout.
+func TestTraceCallLimits(t *testing.T) {
+	var (
+		db, _    = ethdb.NewMemDatabase()
+		gasCall  = common.Address{0xc0}
+		loopCall = common.Address{0xc1}
+		gspec    = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: core.GenesisAlloc{
+				// GAS, PUSH1 0, MSTORE, PUSH1 32, PUSH1 0, RETURN
+				gasCall: {Code: common.FromHex("0x5a60005260206000f3"), Balance: new(big.Int)},
+				// JUMPDEST, PUSH1 0, JUMP
+				loopCall: {Code: common.FromHex("0x5b600056"), Balance: new(big.Int)},
+			},
+		}
+		genesis       = gspec.MustCommit(db)
+		blockchain, _ = core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	)
+	defer blockchain.Stop()
+
+	chain, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 2, nil)
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("Failed to import chain: %v", err)
+	}
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("debug", NewPrivateDebugAPI(gspec.Config, &Ethereum{blockchain: blockchain, chainDb: db})); err != nil {
+		t.Fatalf("Failed to register debug API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	// Calls without or with an excessive gas allowance get the block gas limit
+	limit := chain[len(chain)-1].GasLimit()
+	for _, gas := range []hexutil.Uint64{0, hexutil.Uint64(2 * limit)} {
+		var result ethapi.ExecutionResult
+		if err := client.Call(&result, "debug_traceCall", ethapi.CallArgs{From: common.Address{0x01}, To: &gasCall, Gas: gas}, "latest"); err != nil {
+			t.Fatalf("Failed to trace call with gas %d: %v", gas, err)
+		}
+		left, _ := new(big.Int).SetString(result.ReturnValue, 16)
+		if left == nil || left.Uint64() >= limit-params.TxGas {
+			t.Errorf("Gas allowance with gas %d not capped: %v left, block limit %d", gas, left, limit)
+		}
+	}
+	// Calls running for too long are aborted by the structured logger too
+	timeout := "10ms"
+	config := &TraceConfig{Timeout: &timeout}
+	var result ethapi.ExecutionResult
+	if err := client.Call(&result, "debug_traceCall", ethapi.CallArgs{From: common.Address{0x01}, To: &loopCall}, "latest", config); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Timeout error mismatch: have %v, want execution timeout", err)
+	}
+}
@@ -64,7 +64,7 @@ type Ethereum struct {
 
 	// Channel for shutting down the service
 	shutdownChan  chan bool    // Channel for shutting down the ethereum
-	stopDbUpgrade func() error // stop chain db sequential key upgrade
+	stopDbUpgrade func() error // stop chain db background upgrades
 
 	// Handlers
 	txPool          *core.TxPool
@@ -108,11 +108,11 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	if !config.SyncMode.IsValid() {
 		return nil, fmt.Errorf("invalid sync mode %d", config.SyncMode)
 	}
-	chainDb, err := CreateDB(ctx, config, "chaindata")
+	chainDb, err := createChainDB(ctx, config)
 	if err != nil {
 		return nil, err
 	}
-	stopDbUpgrade := upgradeDeduplicateData(chainDb)
+	stopDbUpgrade := upgradeDatabase(chainDb)
 	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlock(chainDb, config.Genesis)
 	if _, ok := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !ok {
 		return nil, genesisErr
@@ -145,8 +145,18 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		core.WriteBlockChainVersion(chainDb, core.BlockChainVersion)
 	}
 
-	vmConfig := vm.Config{EnablePreimageRecording: config.EnablePreimageRecording}
-	eth.blockchain, err = core.NewBlockChain(chainDb, eth.chainConfig, eth.engine, vmConfig)
+	var (
+		vmConfig    = vm.Config{EnablePreimageRecording: config.EnablePreimageRecording}
+		cacheConfig = &core.CacheConfig{
+			Disabled:         config.NoPruning,
+			TrieNodeLimit:    config.TrieCache,
+			TrieTimeLimit:    config.TrieTimeout,
+			FreezerThreshold: config.FreezerThreshold,
+			Snapshot:         config.Snapshot,
+			TxLookupLimit:    config.TxLookupLimit,
+		}
+	)
+	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, eth.chainConfig, eth.engine, vmConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -208,6 +218,19 @@ func CreateDB(ctx *node.ServiceContext, config *Config, name string) (ethdb.Data
 	return db, nil
 }
 
+// createChainDB creates the chain database of a full node, with a freezer moving
+// the immutable ancient chain segment into append-only flat files.
+func createChainDB(ctx *node.ServiceContext, config *Config) (ethdb.Database, error) {
+	db, err := ctx.OpenDatabaseWithFreezer("chaindata", config.DatabaseCache, config.DatabaseHandles, config.DatabaseFreezer)
+	if err != nil {
+		return nil, err
+	}
+	if db, ok := ethdb.KeyValueStore(db).(*ethdb.LDBDatabase); ok {
+		db.Meter("eth/db/chaindata/")
+	}
+	return db, nil
+}
+
 // CreateConsensusEngine creates the required type of consensus engine instance for an Ethereum service
 func CreateConsensusEngine(ctx *node.ServiceContext, config *ethash.Config, chainConfig *params.ChainConfig, db ethdb.Database) consensus.Engine {
 	// If proof-of-authority is requested, set it up
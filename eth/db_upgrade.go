@@ -23,12 +23,40 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
-var deduplicateData = []byte("dbUpgrade_20170714deduplicateData")
+var (
+	deduplicateData = []byte("dbUpgrade_20170714deduplicateData")
+	slimReceipts    = []byte("dbUpgrade_20180319slimReceipts")
+)
+
+// upgradeDatabase starts all the background database upgrades necessary. Returns
+// a stop function that blocks until all of them have been safely stopped, or nil
+// if there was nothing to upgrade.
+func upgradeDatabase(db ethdb.Database) func() error {
+	var stops []func() error
+	for _, upgrade := range []func(ethdb.Database) func() error{upgradeDeduplicateData, upgradeReceiptStorage} {
+		if stop := upgrade(db); stop != nil {
+			stops = append(stops, stop)
+		}
+	}
+	if len(stops) == 0 {
+		return nil
+	}
+	return func() error {
+		var failed error
+		for _, stop := range stops {
+			if err := stop(); err != nil && failed == nil {
+				failed = err
+			}
+		}
+		return failed
+	}
+}
 
 // upgradeDeduplicateData checks the chain database version and
 // starts a background process to make upgrades if necessary.
@@ -50,7 +78,7 @@ func upgradeDeduplicateData(db ethdb.Database) func() error {
 
 	go func() {
 		// Create an iterator to read the entire database and covert old lookup entires
-		it := db.(*ethdb.LDBDatabase).NewIterator()
+		it := db.NewIterator(nil, nil)
 		defer func() {
 			if it != nil {
 				it.Release()
@@ -100,8 +128,7 @@ func upgradeDeduplicateData(db ethdb.Database) func() error {
 			converted++
 			if converted%100000 == 0 {
 				it.Release()
-				it = db.(*ethdb.LDBDatabase).NewIterator()
-				it.Seek(key)
+				it = db.NewIterator(nil, key)
 
 				log.Info("Deduplicating database entries", "deduped", converted)
 			}
@@ -133,3 +160,109 @@ func upgradeDeduplicateData(db ethdb.Database) func() error {
 		return <-errc
 	}
 }
+
+// upgradeReceiptStorage checks the chain database version and starts a background
+// process to convert receipts stored in the legacy format, which persisted all the
+// derivable fields too, if necessary. Receipts already moved into the ancient store
+// are left as they are, they are still readable. Returns a stop function that blocks
+// until the process has been safely stopped.
+func upgradeReceiptStorage(db ethdb.Database) func() error {
+	// If the database is already converted or empty, bail out
+	data, _ := db.Get(slimReceipts)
+	if len(data) > 0 && data[0] == 42 {
+		return nil
+	}
+	if data, _ := db.Get([]byte("LastHeader")); len(data) == 0 {
+		db.Put(slimReceipts, []byte{42})
+		return nil
+	}
+	// Start the receipt conversion on a new goroutine
+	log.Warn("Upgrading database to use slim receipts")
+	stop := make(chan chan error)
+
+	go func() {
+		// Create an iterator over all the block receipts and convert the legacy ones
+		prefix := []byte("r")
+
+		it := db.NewIterator(prefix, nil)
+		defer func() {
+			if it != nil {
+				it.Release()
+			}
+		}()
+
+		var (
+			batch     = db.NewBatch()
+			converted uint64
+			failed    error
+		)
+		for failed == nil && it.Next() {
+			// Check for termination without slowing down the iteration
+			select {
+			case errc := <-stop:
+				errc <- batch.Write()
+				return
+			default:
+			}
+			// Skip any entries that don't look like block receipts (r<number><hash>)
+			key := it.Key()
+			if len(key) != len(prefix)+8+common.HashLength {
+				continue
+			}
+			// Skip any entries that don't decode (name clash with other 'r' prefixed keys)
+			var receipts []*types.ReceiptForStorage
+			if err := rlp.DecodeBytes(it.Value(), &receipts); err != nil {
+				continue
+			}
+			// Skip any entries already in the slim format, convert the rest
+			blob, err := rlp.EncodeToBytes(receipts)
+			if err != nil {
+				failed = err
+				break
+			}
+			if bytes.Equal(blob, it.Value()) {
+				continue
+			}
+			if failed = batch.Put(common.CopyBytes(key), blob); failed != nil {
+				break
+			}
+			if batch.ValueSize() >= ethdb.IdealBatchSize {
+				if failed = batch.Write(); failed != nil {
+					break
+				}
+				batch.Reset()
+			}
+			// Bump the conversion counter, and recreate the iterator occasionally to
+			// avoid too high memory consumption.
+			converted++
+			if converted%100000 == 0 {
+				start := common.CopyBytes(key[len(prefix):])
+				it.Release()
+				it = db.NewIterator(prefix, start)
+
+				log.Info("Converting database receipts", "converted", converted)
+			}
+		}
+		if failed == nil {
+			failed = batch.Write()
+		}
+		// Upgrade finished, mark a such and terminate
+		if failed == nil {
+			log.Info("Database receipt conversion successful", "converted", converted)
+			db.Put(slimReceipts, []byte{42})
+		} else {
+			log.Error("Database receipt conversion failed", "converted", converted, "err", failed)
+		}
+		it.Release()
+		it = nil
+
+		errc := <-stop
+		errc <- failed
+	}()
+	// Assembly the cancellation callback
+	return func() error {
+		errc := make(chan error)
+		stop <- errc
+		return <-errc
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that receipts stored in the legacy format are converted to the slim one
+// by the background database upgrade.
+func TestReceiptStorageUpgrade(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	core.WriteHeadHeaderHash(db, common.Hash{0x01})
+
+	// Store a few receipt lists in the legacy format, containing the derived fields
+	legacy := make(map[common.Hash][]byte)
+	for i := uint64(0); i < 10; i++ {
+		hash := common.Hash{byte(i)}
+		blob, _ := rlp.EncodeToBytes([][]interface{}{{
+			[]byte{0x01}, i, types.Bloom{}, hash, common.Address{}, []interface{}{}, i,
+		}})
+		key := append(append([]byte("r"), encodeNumber(i)...), hash.Bytes()...)
+		db.Put(key, blob)
+		legacy[hash] = blob
+	}
+	// Run the upgrade and wait for it to finish
+	stop := upgradeReceiptStorage(db)
+	if stop == nil {
+		t.Fatalf("receipt upgrade not started")
+	}
+	for i := 0; ; i++ {
+		if data, _ := db.Get(slimReceipts); len(data) > 0 && data[0] == 42 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("receipt upgrade didn't finish")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := stop(); err != nil {
+		t.Fatalf("receipt upgrade failed: %v", err)
+	}
+	// Ensure all receipts were converted without losing the consensus fields
+	for i := uint64(0); i < 10; i++ {
+		hash := common.Hash{byte(i)}
+
+		blob, _ := db.Get(append(append([]byte("r"), encodeNumber(i)...), hash.Bytes()...))
+		if bytes.Equal(blob, legacy[hash]) {
+			t.Fatalf("receipts #%d: not converted", i)
+		}
+		receipts := core.GetRawBlockReceipts(db, hash, i)
+		if len(receipts) != 1 || receipts[0].CumulativeGasUsed != i || receipts[0].Status != types.ReceiptStatusSuccessful {
+			t.Fatalf("receipts #%d: content mismatch: %v", i, receipts)
+		}
+	}
+	// A second run should not start as the database is already upgraded
+	if stop := upgradeReceiptStorage(db); stop != nil {
+		stop()
+		t.Fatalf("receipt upgrade restarted on upgraded database")
+	}
+}
+
+func encodeNumber(number uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, number)
+	return enc
+}
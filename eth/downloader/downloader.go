@@ -1374,7 +1374,7 @@ func (d *Downloader) processFastSyncContent(latest *types.Header) error {
 	stateSync := d.syncState(latest.Root)
 	defer stateSync.Cancel()
 	go func() {
-		if err := stateSync.Wait(); err != nil {
+		if err := stateSync.Wait(); err != nil && err != errCancelStateFetch {
 			d.queue.Close() // wake up WaitResults
 		}
 	}()
@@ -1383,7 +1383,13 @@ func (d *Downloader) processFastSyncContent(latest *types.Header) error {
 	for {
 		results := d.queue.WaitResults()
 		if len(results) == 0 {
-			return stateSync.Cancel()
+			// All content was processed, so the head state is not needed any more,
+			// either because the pivot state was synced or because the chain is too
+			// short to have a pivot. Aborting its download is not a failure.
+			if err := stateSync.Cancel(); err != errCancelStateFetch {
+				return err
+			}
+			return nil
 		}
 		if d.chainInsertHook != nil {
 			d.chainInsertHook(results)
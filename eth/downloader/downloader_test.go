@@ -293,7 +293,7 @@ func (dl *downloadTester) CurrentFastBlock() *types.Block {
 func (dl *downloadTester) FastSyncCommitHead(hash common.Hash) error {
 	// For now only check that the state trie is correct
 	if block := dl.GetBlockByHash(hash); block != nil {
-		_, err := trie.NewSecure(block.Root(), dl.stateDb, 0)
+		_, err := trie.NewSecure(block.Root(), trie.NewDatabase(dl.stateDb), 0)
 		return err
 	}
 	return fmt.Errorf("non existent block: %x", hash[:4])
@@ -609,6 +609,16 @@ func (dlp *downloadTesterPeer) RequestNodeData(hashes []common.Hash) error {
 	return nil
 }
 
+// stallingStatePeer is a download tester peer never answering state requests.
+type stallingStatePeer struct {
+	*downloadTesterPeer
+}
+
+// RequestNodeData implements downloader.Peer, dropping the request.
+func (dlp *stallingStatePeer) RequestNodeData(hashes []common.Hash) error {
+	return nil
+}
+
 // assertOwnChain checks if the local chain contains the correct number of items
 // of the various chain components.
 func assertOwnChain(t *testing.T, tester *downloadTester, length int) {
@@ -696,6 +706,32 @@ func testCanonicalSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 	assertOwnChain(t, tester, targetBlocks+1)
 }
 
+// Tests that fast syncing a chain too short to have a pivot block, whose blocks
+// are thus all imported in full, succeeds even though the head state download is
+// aborted once the blocks are processed.
+func TestShortChainFastSync63(t *testing.T) { testShortChainFastSync(t, 63) }
+func TestShortChainFastSync64(t *testing.T) { testShortChainFastSync(t, 64) }
+
+func testShortChainFastSync(t *testing.T, protocol int) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	// Create a chain short enough for all its blocks to be imported in full, served
+	// by a peer never answering state requests, so block processing always finishes
+	// before the head state download
+	hashes, headers, blocks, receipts := tester.makeChain(fsMinFullBlocks, 0, tester.genesis, nil, false)
+	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+	tester.downloader.UnregisterPeer("peer")
+	tester.downloader.RegisterPeer("peer", protocol, &stallingStatePeer{&downloadTesterPeer{dl: tester, id: "peer"}})
+
+	if err := tester.sync("peer", nil, FastSync); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	assertOwnChain(t, tester, fsMinFullBlocks+1)
+}
+
 // Tests that if a large batch of blocks are being downloaded, it is throttled
 // until the cached blocks are retrieved.
 func TestThrottling62(t *testing.T)     { testThrottling(t, 62, FullSync) }
@@ -18,6 +18,7 @@ package filters
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"io/ioutil"
 	"math/big"
 	"os"
@@ -33,13 +34,18 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 )
 
-func makeReceipt(addr common.Address) *types.Receipt {
-	receipt := types.NewReceipt(nil, false, 0)
-	receipt.Logs = []*types.Log{
-		{Address: addr},
-	}
-	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
-	return receipt
+// logCode is the runtime code of a contract emitting a log with the first word
+// of the call data as its only topic: PUSH1 0, CALLDATALOAD, PUSH1 0, PUSH1 0, LOG1
+var logCode = common.FromHex("0x60003560006000a1")
+
+// addLogTx adds a transaction to the block, calling the log emitting contract at
+// the given address with the given topic.
+func addLogTx(gen *core.BlockGen, key *ecdsa.PrivateKey, contract common.Address, topic common.Hash) {
+	signer := types.NewEIP155Signer(params.TestChainConfig.ChainId)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+
+	tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(from), contract, new(big.Int), 50000, nil, topic.Bytes()), signer, key)
+	gen.AddTx(tx)
 }
 
 func BenchmarkFilters(b *testing.B) {
@@ -58,29 +64,34 @@ func BenchmarkFilters(b *testing.B) {
 		chainFeed  = new(event.Feed)
 		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
 		key1, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
-		addr1      = crypto.PubkeyToAddress(key1.PublicKey)
+		addr1      = common.BytesToAddress([]byte("bob"))
 		addr2      = common.BytesToAddress([]byte("jeff"))
 		addr3      = common.BytesToAddress([]byte("ethereum"))
 		addr4      = common.BytesToAddress([]byte("random addresses please"))
+		gspec      = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: core.GenesisAlloc{
+				crypto.PubkeyToAddress(key1.PublicKey): {Balance: big.NewInt(1000000)},
+				addr1:                                  {Code: logCode, Balance: new(big.Int)},
+				addr2:                                  {Code: logCode, Balance: new(big.Int)},
+				addr3:                                  {Code: logCode, Balance: new(big.Int)},
+				addr4:                                  {Code: logCode, Balance: new(big.Int)},
+			},
+		}
 	)
 	defer db.Close()
 
-	genesis := core.GenesisBlockForTesting(db, addr1, big.NewInt(1000000))
+	genesis := gspec.MustCommit(db)
 	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 100010, func(i int, gen *core.BlockGen) {
 		switch i {
 		case 2403:
-			receipt := makeReceipt(addr1)
-			gen.AddUncheckedReceipt(receipt)
+			addLogTx(gen, key1, addr1, common.Hash{})
 		case 1034:
-			receipt := makeReceipt(addr2)
-			gen.AddUncheckedReceipt(receipt)
+			addLogTx(gen, key1, addr2, common.Hash{})
 		case 34:
-			receipt := makeReceipt(addr3)
-			gen.AddUncheckedReceipt(receipt)
+			addLogTx(gen, key1, addr3, common.Hash{})
 		case 99999:
-			receipt := makeReceipt(addr4)
-			gen.AddUncheckedReceipt(receipt)
-
+			addLogTx(gen, key1, addr4, common.Hash{})
 		}
 	})
 	for i, block := range chain {
@@ -123,54 +134,34 @@ func TestFilters(t *testing.T) {
 		chainFeed  = new(event.Feed)
 		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
 		key1, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
-		addr       = crypto.PubkeyToAddress(key1.PublicKey)
+		addr       = common.BytesToAddress([]byte("jeff"))
 
 		hash1 = common.BytesToHash([]byte("topic1"))
 		hash2 = common.BytesToHash([]byte("topic2"))
 		hash3 = common.BytesToHash([]byte("topic3"))
 		hash4 = common.BytesToHash([]byte("topic4"))
+
+		gspec = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: core.GenesisAlloc{
+				crypto.PubkeyToAddress(key1.PublicKey): {Balance: big.NewInt(1000000)},
+				addr:                                   {Code: logCode, Balance: new(big.Int)},
+			},
+		}
 	)
 	defer db.Close()
 
-	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	genesis := gspec.MustCommit(db)
 	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 1000, func(i int, gen *core.BlockGen) {
 		switch i {
 		case 1:
-			receipt := types.NewReceipt(nil, false, 0)
-			receipt.Logs = []*types.Log{
-				{
-					Address: addr,
-					Topics:  []common.Hash{hash1},
-				},
-			}
-			gen.AddUncheckedReceipt(receipt)
+			addLogTx(gen, key1, addr, hash1)
 		case 2:
-			receipt := types.NewReceipt(nil, false, 0)
-			receipt.Logs = []*types.Log{
-				{
-					Address: addr,
-					Topics:  []common.Hash{hash2},
-				},
-			}
-			gen.AddUncheckedReceipt(receipt)
+			addLogTx(gen, key1, addr, hash2)
 		case 998:
-			receipt := types.NewReceipt(nil, false, 0)
-			receipt.Logs = []*types.Log{
-				{
-					Address: addr,
-					Topics:  []common.Hash{hash3},
-				},
-			}
-			gen.AddUncheckedReceipt(receipt)
+			addLogTx(gen, key1, addr, hash3)
 		case 999:
-			receipt := types.NewReceipt(nil, false, 0)
-			receipt.Logs = []*types.Log{
-				{
-					Address: addr,
-					Topics:  []common.Hash{hash4},
-				},
-			}
-			gen.AddUncheckedReceipt(receipt)
+			addLogTx(gen, key1, addr, hash4)
 		}
 	})
 	for i, block := range chain {
@@ -0,0 +1,91 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// TxTracer is a vm.Tracer producing a JSON result for the traced transaction,
+// which can be interrupted while running. Both the JavaScript and the native
+// tracers implement it.
+type TxTracer interface {
+	vm.Tracer
+
+	// GetResult returns the outcome of the tracing, or any error that occurred.
+	GetResult() (json.RawMessage, error)
+
+	// Stop terminates the tracing at the first opportune moment.
+	Stop(err error)
+}
+
+// natives contains all the registered native tracer constructors by name.
+var natives = make(map[string]func() TxTracer)
+
+// RegisterNative makes a native Go tracer available by name. It is meant to be
+// called during package initialization and panics if the name is already
+// registered.
+//
+// Native tracers take precedence over the bundled JavaScript tracers of the same
+// name, which can then no longer be selected by name (e.g. the native callTracer
+// and prestateTracer replace their JavaScript versions for all callers over RPC).
+// The JavaScript versions remain usable by passing their source as tracer code.
+func RegisterNative(name string, ctor func() TxTracer) {
+	if _, ok := natives[name]; ok {
+		panic(fmt.Sprintf("native tracer %q already registered", name))
+	}
+	natives[name] = ctor
+}
+
+// NewTxTracer creates the tracer selected by the given name or code: a native
+// tracer if one is registered by the name, otherwise a JavaScript tracer.
+func NewTxTracer(code string) (TxTracer, error) {
+	if ctor, ok := natives[code]; ok {
+		return ctor(), nil
+	}
+	tracer, err := New(code)
+	if err != nil {
+		return nil, err
+	}
+	return tracer, nil
+}
+
+// stackPeek returns the nth-from-the-top element of the stack, or zero if the
+// stack is too shallow.
+func stackPeek(stack *vm.Stack, n int) *big.Int {
+	if len(stack.Data()) <= n {
+		log.Warn("Tracer accessed out of bound stack", "size", len(stack.Data()), "index", n)
+		return new(big.Int)
+	}
+	return stack.Back(n)
+}
+
+// memorySlice returns a copy of the requested range of memory, or nil if it is
+// out of bounds.
+func memorySlice(memory *vm.Memory, offset, size *big.Int) []byte {
+	end := new(big.Int).Add(offset, size)
+	if end.BitLen() > 63 || int64(memory.Len()) < end.Int64() {
+		log.Warn("Tracer accessed out of bound memory", "available", memory.Len(), "offset", offset, "size", size)
+		return nil
+	}
+	return memory.Get(offset.Int64(), size.Int64())
+}
@@ -0,0 +1,271 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+func init() {
+	RegisterNative("callTracer", newCallTracer)
+}
+
+// callFrame is a single call of a callTracer result. Its fields mirror the ones
+// reported by the JavaScript call_tracer.js, including the ones omitted there.
+type callFrame struct {
+	Type    string          `json:"type"`
+	From    *common.Address `json:"from,omitempty"`
+	To      *common.Address `json:"to,omitempty"`
+	Value   *hexutil.Big    `json:"value,omitempty"`
+	Gas     *hexutil.Uint64 `json:"gas,omitempty"`
+	GasUsed *hexutil.Uint64 `json:"gasUsed,omitempty"`
+	Input   *hexutil.Bytes  `json:"input,omitempty"`
+	Output  *hexutil.Bytes  `json:"output,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Time    string          `json:"time,omitempty"`
+	Calls   []*callFrame    `json:"calls,omitempty"`
+
+	// Intermediate values needed to complete the call when it returns
+	gasIn, gasCost uint64
+	outOff, outLen *big.Int
+}
+
+// callTracer is a native Go port of the JavaScript callTracer, extracting and
+// reporting all the internal calls made by a transaction.
+type callTracer struct {
+	callstack []*callFrame // Current recursive call stack of the EVM execution
+	descended bool         // Whether we've just descended into an inner call
+
+	ctx callFrame // Transaction context gathered throughout execution
+	err error     // Error, if one has occurred
+
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// newCallTracer creates a native call tracer.
+func newCallTracer() TxTracer {
+	return &callTracer{callstack: []*callFrame{{}}}
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *callTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.ctx.Type = "CALL"
+	if create {
+		t.ctx.Type = "CREATE"
+	}
+	t.ctx.From, t.ctx.To = &from, &to
+	t.ctx.Input = (*hexutil.Bytes)(&input)
+	t.ctx.Gas = (*hexutil.Uint64)(&gas)
+	t.ctx.Value = (*hexutil.Big)(value)
+	return nil
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *callTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.err != nil {
+		return nil
+	}
+	// If tracing was interrupted, set the error and stop
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		t.err = t.reason
+		return nil
+	}
+	// Capture any errors immediately
+	if err != nil {
+		t.fault(err)
+		return nil
+	}
+	switch op {
+	case vm.CREATE:
+		// If a new contract is being created, add to the call stack
+		from := contract.Address()
+		input := hexutil.Bytes(memorySlice(memory, stackPeek(stack, 1), stackPeek(stack, 2)))
+
+		t.callstack = append(t.callstack, &callFrame{
+			Type:    op.String(),
+			From:    &from,
+			Input:   &input,
+			Value:   (*hexutil.Big)(new(big.Int).Set(stackPeek(stack, 0))),
+			gasIn:   gas,
+			gasCost: cost,
+		})
+		t.descended = true
+		return nil
+
+	case vm.SELFDESTRUCT:
+		// If a contract is being self destructed, gather that as a subcall too
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, &callFrame{Type: op.String()})
+		return nil
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		// Skip any pre-compile invocations, those are just fancy opcodes
+		to := common.BigToAddress(stackPeek(stack, 1))
+		if _, ok := vm.PrecompiledContractsByzantium[to]; ok {
+			return nil
+		}
+		off := 1
+		if op == vm.DELEGATECALL || op == vm.STATICCALL {
+			off = 0
+		}
+		from := contract.Address()
+		input := hexutil.Bytes(memorySlice(memory, stackPeek(stack, 2+off), stackPeek(stack, 3+off)))
+
+		call := &callFrame{
+			Type:    op.String(),
+			From:    &from,
+			To:      &to,
+			Input:   &input,
+			gasIn:   gas,
+			gasCost: cost,
+			outOff:  new(big.Int).Set(stackPeek(stack, 4+off)),
+			outLen:  new(big.Int).Set(stackPeek(stack, 5+off)),
+		}
+		if op != vm.DELEGATECALL && op != vm.STATICCALL {
+			call.Value = (*hexutil.Big)(new(big.Int).Set(stackPeek(stack, 2)))
+		}
+		t.callstack = append(t.callstack, call)
+		t.descended = true
+		return nil
+	}
+	// If we've just descended into an inner call, retrieve it's true allowance. We
+	// need to extract if from within the call as there may be funky gas dynamics
+	// with regard to requested and actually given gas (2300 stipend, 63/64 rule).
+	// Calls made to plain accounts have no code to step in, their gas is skipped.
+	if t.descended {
+		if depth >= len(t.callstack) {
+			t.callstack[len(t.callstack)-1].Gas = (*hexutil.Uint64)(&gas)
+		}
+		t.descended = false
+	}
+	// If an existing call is returning, pop off the call stack
+	if op == vm.REVERT {
+		t.callstack[len(t.callstack)-1].Error = "execution reverted"
+		return nil
+	}
+	if depth == len(t.callstack)-1 {
+		// Pop off the last call and get the execution results
+		call := t.callstack[len(t.callstack)-1]
+		t.callstack = t.callstack[:len(t.callstack)-1]
+
+		ret := stackPeek(stack, 0)
+		if call.Type == vm.CREATE.String() {
+			// If the call was a CREATE, retrieve the contract address and output code
+			gasUsed := call.gasIn - call.gasCost - gas
+			call.GasUsed = (*hexutil.Uint64)(&gasUsed)
+
+			if ret.Sign() != 0 {
+				to := common.BigToAddress(ret)
+				output := hexutil.Bytes(env.StateDB.GetCode(to))
+				call.To, call.Output = &to, &output
+			} else if call.Error == "" {
+				call.Error = "internal failure"
+			}
+		} else if call.Gas != nil {
+			// If the call was a contract call, retrieve the gas usage and output
+			gasUsed := call.gasIn - call.gasCost + uint64(*call.Gas) - gas
+			call.GasUsed = (*hexutil.Uint64)(&gasUsed)
+
+			if ret.Sign() != 0 {
+				output := hexutil.Bytes(memorySlice(memory, call.outOff, call.outLen))
+				call.Output = &output
+			} else if call.Error == "" {
+				call.Error = "internal failure"
+			}
+		}
+		// Inject the call into the previous one
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, call)
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *callTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.err == nil {
+		t.fault(err)
+	}
+	return nil
+}
+
+// fault handles the failure of the topmost call on the call stack.
+func (t *callTracer) fault(err error) {
+	// If the topmost call already reverted, don't handle the additional fault again
+	if t.callstack[len(t.callstack)-1].Error != "" {
+		return
+	}
+	// Pop off the just failed call, consuming all its available gas
+	call := t.callstack[len(t.callstack)-1]
+	t.callstack = t.callstack[:len(t.callstack)-1]
+
+	call.Error = err.Error()
+	if call.Gas != nil {
+		call.GasUsed = call.Gas
+	}
+	// Flatten the failed call into its parent, or leave it if it was the last one
+	if len(t.callstack) > 0 {
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, call)
+		return
+	}
+	t.callstack = append(t.callstack, call)
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *callTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	t.ctx.Output = (*hexutil.Bytes)(&output)
+	t.ctx.GasUsed = (*hexutil.Uint64)(&gasUsed)
+	t.ctx.Time = d.String()
+
+	if err != nil {
+		t.ctx.Error = err.Error()
+	}
+	return nil
+}
+
+// GetResult returns the call tree of the traced transaction, or any error that
+// occurred during tracing.
+func (t *callTracer) GetResult() (json.RawMessage, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	result := t.ctx
+	result.Calls = t.callstack[0].Calls
+
+	if t.callstack[0].Error != "" {
+		result.Error = t.callstack[0].Error
+	}
+	if result.Error != "" {
+		result.Output = nil
+	}
+	return json.Marshal(&result)
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *callTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
@@ -119,6 +119,61 @@ type callTracerTest struct {
 // Iterates over all the input-output datasets in the tracer test harness and
 // runs the JavaScript tracers against them.
 func TestCallTracer(t *testing.T) {
+	testCallTracer(t, func() (TxTracer, error) { return New("callTracer") })
+}
+
+// Iterates over all the input-output datasets in the tracer test harness and
+// runs the native Go tracers against them.
+func TestNativeCallTracer(t *testing.T) {
+	testCallTracer(t, func() (TxTracer, error) { return NewTxTracer("callTracer") })
+}
+
+func testCallTracer(t *testing.T, newTracer func() (TxTracer, error)) {
+	forEachCallTracerTest(t, func(t *testing.T, test *callTracerTest) {
+		tracer, err := newTracer()
+		if err != nil {
+			t.Fatalf("failed to create call tracer: %v", err)
+		}
+		res := runTracerTest(t, test, tracer)
+
+		ret := new(callTrace)
+		if err := json.Unmarshal(res, ret); err != nil {
+			t.Fatalf("failed to unmarshal trace result: %v", err)
+		}
+		if !reflect.DeepEqual(ret, test.Result) {
+			t.Fatalf("trace mismatch: have %+v, want %+v", ret, test.Result)
+		}
+	})
+}
+
+// Tests that the native prestate tracer assembles the same prestate as the
+// JavaScript one over all the datasets in the tracer test harness.
+func TestNativePrestateTracer(t *testing.T) {
+	forEachCallTracerTest(t, func(t *testing.T, test *callTracerTest) {
+		jsTracer, err := New("prestateTracer")
+		if err != nil {
+			t.Fatalf("failed to create JavaScript prestate tracer: %v", err)
+		}
+		nativeTracer, err := NewTxTracer("prestateTracer")
+		if err != nil {
+			t.Fatalf("failed to create native prestate tracer: %v", err)
+		}
+		var want, have interface{}
+		if err := json.Unmarshal(runTracerTest(t, test, jsTracer), &want); err != nil {
+			t.Fatalf("failed to unmarshal JavaScript trace result: %v", err)
+		}
+		if err := json.Unmarshal(runTracerTest(t, test, nativeTracer), &have); err != nil {
+			t.Fatalf("failed to unmarshal native trace result: %v", err)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Fatalf("prestate mismatch: have %+v, want %+v", have, want)
+		}
+	})
+}
+
+// forEachCallTracerTest loads all the call tracer datasets from the test harness
+// and runs the given check against each in a parallel subtest.
+func forEachCallTracerTest(t *testing.T, check func(t *testing.T, test *callTracerTest)) {
 	files, err := ioutil.ReadDir("testdata")
 	if err != nil {
 		t.Fatalf("failed to retrieve tracer test suite: %v", err)
@@ -140,55 +195,51 @@ func TestCallTracer(t *testing.T) {
 			if err := json.Unmarshal(blob, test); err != nil {
 				t.Fatalf("failed to parse testcase: %v", err)
 			}
-			// Configure a blockchain with the given prestate
-			tx := new(types.Transaction)
-			if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
-				t.Fatalf("failed to parse testcase input: %v", err)
-			}
-			signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
-			origin, _ := signer.Sender(tx)
-
-			context := vm.Context{
-				CanTransfer: core.CanTransfer,
-				Transfer:    core.Transfer,
-				Origin:      origin,
-				Coinbase:    test.Context.Miner,
-				BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
-				Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
-				Difficulty:  (*big.Int)(test.Context.Difficulty),
-				GasLimit:    uint64(test.Context.GasLimit),
-				GasPrice:    tx.GasPrice(),
-			}
-			db, _ := ethdb.NewMemDatabase()
-			statedb := tests.MakePreState(db, test.Genesis.Alloc)
+			check(t, test)
+		})
+	}
+}
 
-			// Create the tracer, the EVM environment and run it
-			tracer, err := New("callTracer")
-			if err != nil {
-				t.Fatalf("failed to create call tracer: %v", err)
-			}
-			evm := vm.NewEVM(context, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+// runTracerTest executes the transaction of a test case on top of its prestate
+// with the given tracer, returning the trace result.
+func runTracerTest(t *testing.T, test *callTracerTest, tracer TxTracer) json.RawMessage {
+	// Configure a blockchain with the given prestate
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
+		t.Fatalf("failed to parse testcase input: %v", err)
+	}
+	signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
+	origin, _ := signer.Sender(tx)
+
+	context := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Origin:      origin,
+		Coinbase:    test.Context.Miner,
+		BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
+		Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
+		Difficulty:  (*big.Int)(test.Context.Difficulty),
+		GasLimit:    uint64(test.Context.GasLimit),
+		GasPrice:    tx.GasPrice(),
+	}
+	db, _ := ethdb.NewMemDatabase()
+	statedb := tests.MakePreState(db, test.Genesis.Alloc)
 
-			msg, err := tx.AsMessage(signer)
-			if err != nil {
-				t.Fatalf("failed to prepare transaction for tracing: %v", err)
-			}
-			st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
-			if _, _, _, err = st.TransitionDb(); err != nil {
-				t.Fatalf("failed to execute transaction: %v", err)
-			}
-			// Retrieve the trace result and compare against the etalon
-			res, err := tracer.GetResult()
-			if err != nil {
-				t.Fatalf("failed to retrieve trace result: %v", err)
-			}
-			ret := new(callTrace)
-			if err := json.Unmarshal(res, ret); err != nil {
-				t.Fatalf("failed to unmarshal trace result: %v", err)
-			}
-			if !reflect.DeepEqual(ret, test.Result) {
-				t.Fatalf("trace mismatch: have %+v, want %+v", ret, test.Result)
-			}
-		})
+	// Run the transaction through the EVM with the tracer attached
+	evm := vm.NewEVM(context, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+
+	msg, err := tx.AsMessage(signer)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	if _, _, _, err = st.TransitionDb(); err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	// Retrieve the trace result
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
 	}
+	return res
 }
@@ -22,13 +22,14 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/filter"
-	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 
 	gometrics "github.com/rcrowley/go-metrics"
 )
@@ -145,8 +146,41 @@ func (db *LDBDatabase) Delete(key []byte) error {
 	return db.db.Delete(key, nil)
 }
 
-func (db *LDBDatabase) NewIterator() iterator.Iterator {
-	return db.db.NewIterator(nil, nil)
+// NewIterator creates a binary-alphabetical iterator over the subset of database
+// content with a particular key prefix, starting at a particular initial key.
+func (db *LDBDatabase) NewIterator(prefix []byte, start []byte) Iterator {
+	return db.db.NewIterator(bytesPrefixRange(prefix, start), nil)
+}
+
+// DeleteRange deletes all the keys in the range [start, end), flushing the
+// deletions to disk in batches.
+func (db *LDBDatabase) DeleteRange(start []byte, end []byte) error {
+	it := db.db.NewIterator(&util.Range{Start: start, Limit: end}, nil)
+	defer it.Release()
+
+	var (
+		batch = new(leveldb.Batch)
+		size  int
+	)
+	for it.Next() {
+		batch.Delete(it.Key())
+		if size += len(it.Key()); size >= IdealBatchSize {
+			if err := db.db.Write(batch, nil); err != nil {
+				return err
+			}
+			batch.Reset()
+			size = 0
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return db.db.Write(batch, nil)
+}
+
+// Compact flattens the underlying data store for the given key range.
+func (db *LDBDatabase) Compact(start []byte, limit []byte) error {
+	return db.db.CompactRange(util.Range{Start: start, Limit: limit})
 }
 
 func (db *LDBDatabase) Close() {
@@ -291,6 +325,12 @@ func (b *ldbBatch) Put(key, value []byte) error {
 	return nil
 }
 
+func (b *ldbBatch) Delete(key []byte) error {
+	b.b.Delete(key)
+	b.size += 1
+	return nil
+}
+
 func (b *ldbBatch) Write() error {
 	return b.db.Write(b.b, nil)
 }
@@ -299,6 +339,19 @@ func (b *ldbBatch) ValueSize() int {
 	return b.size
 }
 
+func (b *ldbBatch) Reset() {
+	b.b.Reset()
+	b.size = 0
+}
+
+// bytesPrefixRange returns the key range that satisfies the given prefix and
+// starts at the given position within it.
+func bytesPrefixRange(prefix, start []byte) *util.Range {
+	r := util.BytesPrefix(prefix)
+	r.Start = append(common.CopyBytes(prefix), start...)
+	return r
+}
+
 type table struct {
 	db     Database
 	prefix string
@@ -329,10 +382,78 @@ func (dt *table) Delete(key []byte) error {
 	return dt.db.Delete(append([]byte(dt.prefix), key...))
 }
 
+// NewIterator creates an iterator over the subset of the table content with a
+// particular key prefix, starting at a particular initial key. The table prefix
+// is stripped from the iterated keys.
+func (dt *table) NewIterator(prefix []byte, start []byte) Iterator {
+	return &tableIterator{
+		it:     dt.db.NewIterator(append([]byte(dt.prefix), prefix...), start),
+		prefix: dt.prefix,
+	}
+}
+
+// DeleteRange deletes all the keys in the range [start, end) of the table. The
+// open ends of the range are confined to the table.
+func (dt *table) DeleteRange(start []byte, end []byte) error {
+	start, end = dt.keyRange(start, end)
+	return dt.db.DeleteRange(start, end)
+}
+
+// Compact flattens the underlying data store for the given key range of the
+// table. The open ends of the range are confined to the table.
+func (dt *table) Compact(start []byte, limit []byte) error {
+	start, limit = dt.keyRange(start, limit)
+	return dt.db.Compact(start, limit)
+}
+
+// keyRange converts a key range of the table into the corresponding range of the
+// underlying database.
+func (dt *table) keyRange(start []byte, end []byte) ([]byte, []byte) {
+	r := util.BytesPrefix([]byte(dt.prefix))
+	if start != nil {
+		r.Start = append(r.Start, start...)
+	}
+	if end != nil {
+		r.Limit = append([]byte(dt.prefix), end...)
+	}
+	return r.Start, r.Limit
+}
+
 func (dt *table) Close() {
 	// Do nothing; don't close the underlying DB.
 }
 
+// tableIterator is a wrapper around a database iterator that strips the table
+// prefix from the keys.
+type tableIterator struct {
+	it     Iterator
+	prefix string
+}
+
+func (it *tableIterator) Next() bool {
+	return it.it.Next()
+}
+
+func (it *tableIterator) Error() error {
+	return it.it.Error()
+}
+
+func (it *tableIterator) Key() []byte {
+	key := it.it.Key()
+	if key == nil {
+		return nil
+	}
+	return key[len(it.prefix):]
+}
+
+func (it *tableIterator) Value() []byte {
+	return it.it.Value()
+}
+
+func (it *tableIterator) Release() {
+	it.it.Release()
+}
+
 type tableBatch struct {
 	batch  Batch
 	prefix string
@@ -351,6 +472,10 @@ func (tb *tableBatch) Put(key, value []byte) error {
 	return tb.batch.Put(append([]byte(tb.prefix), key...), value)
 }
 
+func (tb *tableBatch) Delete(key []byte) error {
+	return tb.batch.Delete(append([]byte(tb.prefix), key...))
+}
+
 func (tb *tableBatch) Write() error {
 	return tb.batch.Write()
 }
@@ -358,3 +483,7 @@ func (tb *tableBatch) Write() error {
 func (tb *tableBatch) ValueSize() int {
 	return tb.batch.ValueSize()
 }
+
+func (tb *tableBatch) Reset() {
+	tb.batch.Reset()
+}
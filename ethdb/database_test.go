@@ -21,11 +21,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/dbtest"
 )
 
 func newTestLDB() (*ethdb.LDBDatabase, func()) {
@@ -44,6 +46,44 @@ func newTestLDB() (*ethdb.LDBDatabase, func()) {
 	}
 }
 
+func TestLDB_Suite(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "ethdb_test_")
+	if err != nil {
+		t.Fatalf("failed to create test dir: %v", err)
+	}
+	defer os.RemoveAll(dirname)
+
+	var count int
+	dbtest.TestDatabaseSuite(t, func() ethdb.Database {
+		count++
+		db, err := ethdb.NewLDBDatabase(filepath.Join(dirname, strconv.Itoa(count)), 0, 0)
+		if err != nil {
+			t.Fatalf("failed to create test database: %v", err)
+		}
+		return db
+	})
+}
+
+func TestMemoryDB_Suite(t *testing.T) {
+	dbtest.TestDatabaseSuite(t, func() ethdb.Database {
+		db, _ := ethdb.NewMemDatabase()
+		return db
+	})
+}
+
+func TestTable_Suite(t *testing.T) {
+	dbtest.TestDatabaseSuite(t, func() ethdb.Database {
+		// Surround the table with entries which must stay invisible through it
+		db, _ := ethdb.NewMemDatabase()
+		db.Put([]byte("tablf"), []byte("after"))
+		db.Put([]byte("tabl"), []byte("before"))
+		db.Put([]byte("\x00"), []byte("first"))
+		db.Put([]byte("\xff"), []byte("last"))
+
+		return ethdb.NewTable(db, "table")
+	})
+}
+
 var test_values = []string{"", "a", "1251", "\x00123\x00"}
 
 func TestLDB_PutGet(t *testing.T) {
@@ -0,0 +1,427 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dbtest contains the conformance test suite every database engine
+// backing ethdb.Database has to pass.
+package dbtest
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// TestDatabaseSuite runs a suite of tests against a database implementation to
+// verify it behaves the way the rest of the codebase expects. Every subtest uses
+// a fresh, empty database created by New, which it closes when done.
+func TestDatabaseSuite(t *testing.T, New func() ethdb.Database) {
+	t.Run("PutGet", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		keys := [][]byte{{0x00}, {0x01, 0x02}, []byte("key"), bytes.Repeat([]byte{0xff}, 64)}
+		for i, key := range keys {
+			if err := db.Put(key, []byte{byte(i)}); err != nil {
+				t.Fatalf("failed to put key %x: %v", key, err)
+			}
+		}
+		for i, key := range keys {
+			value, err := db.Get(key)
+			if err != nil {
+				t.Fatalf("failed to get key %x: %v", key, err)
+			}
+			if !bytes.Equal(value, []byte{byte(i)}) {
+				t.Errorf("value mismatch for key %x: have %x, want %x", key, value, []byte{byte(i)})
+			}
+		}
+		if _, err := db.Get([]byte("missing")); err == nil {
+			t.Errorf("no error for missing key")
+		}
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		for i := byte(0); i < 3; i++ {
+			if err := db.Put([]byte("key"), bytes.Repeat([]byte{i}, int(i)+1)); err != nil {
+				t.Fatalf("failed to put value %d: %v", i, err)
+			}
+		}
+		if value, err := db.Get([]byte("key")); err != nil || !bytes.Equal(value, []byte{2, 2, 2}) {
+			t.Errorf("overwritten value mismatch: have %x, %v, want %x", value, err, []byte{2, 2, 2})
+		}
+	})
+
+	t.Run("EmptyValue", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		if err := db.Put([]byte("key"), []byte{}); err != nil {
+			t.Fatalf("failed to put empty value: %v", err)
+		}
+		if has, err := db.Has([]byte("key")); err != nil || !has {
+			t.Errorf("empty value not present: %v, %v", has, err)
+		}
+		if value, err := db.Get([]byte("key")); err != nil || len(value) != 0 {
+			t.Errorf("empty value mismatch: have %x, %v", value, err)
+		}
+	})
+
+	t.Run("HasDelete", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		if has, err := db.Has([]byte("key")); err != nil || has {
+			t.Fatalf("missing key reported present: %v, %v", has, err)
+		}
+		if err := db.Put([]byte("key"), []byte("value")); err != nil {
+			t.Fatalf("failed to put key: %v", err)
+		}
+		if has, err := db.Has([]byte("key")); err != nil || !has {
+			t.Fatalf("inserted key reported missing: %v, %v", has, err)
+		}
+		if err := db.Delete([]byte("key")); err != nil {
+			t.Fatalf("failed to delete key: %v", err)
+		}
+		if has, err := db.Has([]byte("key")); err != nil || has {
+			t.Errorf("deleted key reported present: %v, %v", has, err)
+		}
+		if _, err := db.Get([]byte("key")); err == nil {
+			t.Errorf("no error for deleted key")
+		}
+		if err := db.Delete([]byte("missing")); err != nil {
+			t.Errorf("failed to delete missing key: %v", err)
+		}
+	})
+
+	t.Run("Isolation", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		// Modifying the inserted slices must not change the stored data
+		key, value := []byte("key"), []byte("value")
+		if err := db.Put(key, value); err != nil {
+			t.Fatalf("failed to put key: %v", err)
+		}
+		key[0], value[0] = 'x', 'x'
+		if has, _ := db.Has([]byte("xey")); has {
+			t.Errorf("key modification leaked into the database")
+		}
+		stored, err := db.Get([]byte("key"))
+		if err != nil || !bytes.Equal(stored, []byte("value")) {
+			t.Fatalf("value modification leaked into the database: have %q, %v", stored, err)
+		}
+		// Modifying a retrieved slice must not change the stored data either
+		stored[0] = 'x'
+		if stored, _ := db.Get([]byte("key")); !bytes.Equal(stored, []byte("value")) {
+			t.Errorf("retrieved value modification leaked into the database: have %q", stored)
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		if err := db.Put([]byte("deleted"), []byte("value")); err != nil {
+			t.Fatalf("failed to put key: %v", err)
+		}
+		batch := db.NewBatch()
+		if err := batch.Put([]byte("key1"), []byte("value1")); err != nil {
+			t.Fatalf("failed to put into batch: %v", err)
+		}
+		if err := batch.Put([]byte("key2"), []byte("value2")); err != nil {
+			t.Fatalf("failed to put into batch: %v", err)
+		}
+		if err := batch.Delete([]byte("deleted")); err != nil {
+			t.Fatalf("failed to delete from batch: %v", err)
+		}
+		if batch.ValueSize() == 0 {
+			t.Errorf("batch size not tracked")
+		}
+		// Nothing may be visible before the batch is written
+		if has, _ := db.Has([]byte("key1")); has {
+			t.Errorf("batch insertion visible before write")
+		}
+		if has, _ := db.Has([]byte("deleted")); !has {
+			t.Errorf("batch deletion visible before write")
+		}
+		if err := batch.Write(); err != nil {
+			t.Fatalf("failed to write batch: %v", err)
+		}
+		for _, key := range []string{"key1", "key2"} {
+			if value, err := db.Get([]byte(key)); err != nil || !bytes.Equal(value, []byte("value"+key[3:])) {
+				t.Errorf("batch inserted value mismatch for %s: have %q, %v", key, value, err)
+			}
+		}
+		if has, _ := db.Has([]byte("deleted")); has {
+			t.Errorf("batch deleted key still present")
+		}
+		// Reset batches must be empty and reusable
+		batch.Reset()
+		if size := batch.ValueSize(); size != 0 {
+			t.Errorf("reset batch not empty: size %d", size)
+		}
+		batch.Put([]byte("key3"), []byte("value3"))
+		if err := batch.Write(); err != nil {
+			t.Fatalf("failed to write reused batch: %v", err)
+		}
+		if value, err := db.Get([]byte("key3")); err != nil || !bytes.Equal(value, []byte("value3")) {
+			t.Errorf("reused batch value mismatch: have %q, %v", value, err)
+		}
+	})
+
+	t.Run("BatchOrder", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		// Operations on the same key must be applied in insertion order
+		batch := db.NewBatch()
+		batch.Put([]byte("key"), []byte("first"))
+		batch.Delete([]byte("key"))
+		batch.Put([]byte("key"), []byte("second"))
+		batch.Put([]byte("gone"), []byte("value"))
+		batch.Delete([]byte("gone"))
+		if err := batch.Write(); err != nil {
+			t.Fatalf("failed to write batch: %v", err)
+		}
+		if value, err := db.Get([]byte("key")); err != nil || !bytes.Equal(value, []byte("second")) {
+			t.Errorf("value mismatch: have %q, %v, want %q", value, err, "second")
+		}
+		if has, _ := db.Has([]byte("gone")); has {
+			t.Errorf("deleted key still present")
+		}
+	})
+
+	t.Run("Iterator", func(t *testing.T) {
+		tests := []struct {
+			content map[string]string
+			prefix  string
+			start   string
+			order   []string
+		}{
+			// Empty databases should be iterable
+			{map[string]string{}, "", "", nil},
+			{map[string]string{}, "non-existent-prefix", "", nil},
+
+			// Single-item databases should be iterable
+			{map[string]string{"key": "val"}, "", "", []string{"key"}},
+			{map[string]string{"key": "val"}, "k", "", []string{"key"}},
+			{map[string]string{"key": "val"}, "l", "", nil},
+
+			// Multi-item databases should be fully iterable
+			{
+				map[string]string{"k1": "v1", "k5": "v5", "k2": "v2", "k4": "v4", "k3": "v3"},
+				"", "",
+				[]string{"k1", "k2", "k3", "k4", "k5"},
+			},
+			{
+				map[string]string{"k1": "v1", "k5": "v5", "k2": "v2", "k4": "v4", "k3": "v3"},
+				"k", "",
+				[]string{"k1", "k2", "k3", "k4", "k5"},
+			},
+			{
+				map[string]string{"k1": "v1", "k5": "v5", "k2": "v2", "k4": "v4", "k3": "v3"},
+				"l", "",
+				nil,
+			},
+			// Multi-item databases should be prefix-iterable
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"ka", "",
+				[]string{"ka1", "ka2", "ka3", "ka4", "ka5"},
+			},
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"kc", "",
+				nil,
+			},
+			// Multi-item databases should be prefix-iterable with start position
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"ka", "3",
+				[]string{"ka3", "ka4", "ka5"},
+			},
+			{
+				map[string]string{
+					"ka1": "va1", "ka5": "va5", "ka2": "va2", "ka4": "va4", "ka3": "va3",
+					"kb1": "vb1", "kb5": "vb5", "kb2": "vb2", "kb4": "vb4", "kb3": "vb3",
+				},
+				"ka", "8",
+				nil,
+			},
+			// Prefixes consisting of 0xff bytes have no upper bound
+			{
+				map[string]string{"\xff": "v1", "\xff\xff": "v2", "\xfe": "v3"},
+				"\xff", "",
+				[]string{"\xff", "\xff\xff"},
+			},
+		}
+		for i, tt := range tests {
+			db := New()
+			for key, val := range tt.content {
+				if err := db.Put([]byte(key), []byte(val)); err != nil {
+					t.Fatalf("test %d: failed to insert item %s:%s into database: %v", i, key, val, err)
+				}
+			}
+			it := db.NewIterator([]byte(tt.prefix), []byte(tt.start))
+			var idx int
+			for it.Next() {
+				if idx >= len(tt.order) {
+					t.Errorf("test %d: iterator produced too many items: have %q", i, it.Key())
+					break
+				}
+				if !bytes.Equal(it.Key(), []byte(tt.order[idx])) {
+					t.Errorf("test %d: item %d: key mismatch: have %q, want %q", i, idx, it.Key(), tt.order[idx])
+				}
+				if !bytes.Equal(it.Value(), []byte(tt.content[tt.order[idx]])) {
+					t.Errorf("test %d: item %d: value mismatch: have %q, want %q", i, idx, it.Value(), tt.content[tt.order[idx]])
+				}
+				idx++
+			}
+			if err := it.Error(); err != nil {
+				t.Errorf("test %d: iteration failed: %v", i, err)
+			}
+			if idx != len(tt.order) {
+				t.Errorf("test %d: iteration terminated prematurely: have %d, want %d", i, idx, len(tt.order))
+			}
+			it.Release()
+			db.Close()
+		}
+	})
+
+	t.Run("IteratorRelease", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		db.Put([]byte("key"), []byte("value"))
+
+		// Releasing an iterator multiple times, partially consumed or not, must work
+		it := db.NewIterator(nil, nil)
+		it.Release()
+		it.Release()
+
+		it = db.NewIterator(nil, nil)
+		if !it.Next() {
+			t.Fatalf("iterator exhausted prematurely")
+		}
+		it.Release()
+		it.Release()
+	})
+
+	t.Run("DeleteRange", func(t *testing.T) {
+		keys := []string{"a", "b1", "b2", "b3", "c", "d"}
+		tests := []struct {
+			start, end []byte
+			remaining  []string
+		}{
+			{[]byte("b1"), []byte("b3"), []string{"a", "b3", "c", "d"}},
+			{[]byte("b"), []byte("c"), []string{"a", "c", "d"}},
+			{nil, []byte("b2"), []string{"b2", "b3", "c", "d"}},
+			{[]byte("b3"), nil, []string{"a", "b1", "b2"}},
+			{nil, nil, nil},
+			{[]byte("x"), nil, keys},
+			{[]byte("b"), []byte("b"), keys},
+		}
+		for i, tt := range tests {
+			db := New()
+			for _, key := range keys {
+				if err := db.Put([]byte(key), []byte(key)); err != nil {
+					t.Fatalf("test %d: failed to insert key %s: %v", i, key, err)
+				}
+			}
+			if err := db.DeleteRange(tt.start, tt.end); err != nil {
+				t.Fatalf("test %d: failed to delete range: %v", i, err)
+			}
+			var remaining []string
+			it := db.NewIterator(nil, nil)
+			for it.Next() {
+				remaining = append(remaining, string(it.Key()))
+			}
+			it.Release()
+
+			if fmt.Sprint(remaining) != fmt.Sprint(tt.remaining) {
+				t.Errorf("test %d: remaining keys mismatch: have %v, want %v", i, remaining, tt.remaining)
+			}
+			db.Close()
+		}
+	})
+
+	t.Run("Compact", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		for i := 0; i < 256; i++ {
+			db.Put([]byte{byte(i)}, []byte{byte(i)})
+		}
+		if err := db.DeleteRange([]byte{0x40}, []byte{0x80}); err != nil {
+			t.Fatalf("failed to delete range: %v", err)
+		}
+		if err := db.Compact([]byte{0x20}, []byte{0xa0}); err != nil {
+			t.Fatalf("failed to compact range: %v", err)
+		}
+		if err := db.Compact(nil, nil); err != nil {
+			t.Fatalf("failed to compact database: %v", err)
+		}
+		// Compaction must not change the content of the database
+		for i := 0; i < 256; i++ {
+			has, err := db.Has([]byte{byte(i)})
+			if err != nil {
+				t.Fatalf("failed to check key %d: %v", i, err)
+			}
+			if deleted := i >= 0x40 && i < 0x80; has == deleted {
+				t.Errorf("key %d presence mismatch: have %v, want %v", i, has, !deleted)
+			}
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 64; j++ {
+					key := []byte(fmt.Sprintf("%d-%d", i, j))
+					if err := db.Put(key, key); err != nil {
+						t.Errorf("failed to put key %s: %v", key, err)
+						return
+					}
+					if value, err := db.Get(key); err != nil || !bytes.Equal(value, key) {
+						t.Errorf("value mismatch for %s: have %q, %v", key, value, err)
+						return
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,139 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultEngine is the database engine used for new databases if none is chosen.
+const DefaultEngine = "leveldb"
+
+// engineFile is the name of the file within a database directory recording the
+// engine the database was created with.
+const engineFile = "ENGINE"
+
+// Engine opens (or creates) a persistent key-value database of a particular kind
+// at the given path, with the requested cache memory (MB) and file handle limit.
+// Databases are directories, in which the engine may store anything apart from a
+// file named ENGINE, which is reserved for recording the engine itself.
+type Engine func(file string, cache int, handles int) (Database, error)
+
+var (
+	engines     = make(map[string]Engine)
+	enginesLock sync.RWMutex
+)
+
+func init() {
+	RegisterEngine(DefaultEngine, func(file string, cache int, handles int) (Database, error) {
+		db, err := NewLDBDatabase(file, cache, handles)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	})
+}
+
+// RegisterEngine makes a database engine available by the provided name. Engines
+// are usually registered from the init function of the package implementing
+// them. If RegisterEngine is called twice with the same name, it panics.
+func RegisterEngine(name string, engine Engine) {
+	enginesLock.Lock()
+	defer enginesLock.Unlock()
+
+	if engine == nil {
+		panic("ethdb: nil database engine " + name)
+	}
+	if _, dup := engines[name]; dup {
+		panic("ethdb: database engine registered twice: " + name)
+	}
+	engines[name] = engine
+}
+
+// Engines returns the sorted names of all the registered database engines.
+func Engines() []string {
+	enginesLock.RLock()
+	defer enginesLock.RUnlock()
+
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the persistent database at the given path with the named engine,
+// creating it if it doesn't exist yet. The engine is recorded within the database
+// directory on creation and opening the database with a different one afterwards
+// is refused. If no engine is specified, the recorded one is used, or the default
+// engine for new databases.
+func Open(engine string, file string, cache int, handles int) (Database, error) {
+	recorded, err := readEngine(file)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case engine == "" && recorded == "":
+		engine = DefaultEngine
+	case engine == "":
+		engine = recorded
+	case recorded != "" && recorded != engine:
+		return nil, fmt.Errorf("database engine mismatch: %s was created with %q, not %q", file, recorded, engine)
+	}
+	enginesLock.RLock()
+	open, ok := engines[engine]
+	enginesLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown database engine %q (available: %s)", engine, strings.Join(Engines(), ", "))
+	}
+	db, err := open(file, cache, handles)
+	if err != nil {
+		return nil, err
+	}
+	if recorded == "" {
+		if err := ioutil.WriteFile(filepath.Join(file, engineFile), []byte(engine+"\n"), 0644); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// readEngine retrieves the engine recorded within a database directory. Databases
+// predating the engine records are all LevelDB ones. An empty name is returned
+// if there's no database at the path.
+func readEngine(file string) (string, error) {
+	blob, err := ioutil.ReadFile(filepath.Join(file, engineFile))
+	switch {
+	case err == nil:
+		return strings.TrimSpace(string(blob)), nil
+	case !os.IsNotExist(err):
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(file, "CURRENT")); err == nil {
+		return DefaultEngine, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that the engine a database was created with is recorded, and that it is
+// used by default and enforced when reopening the database.
+func TestEngineRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethdb-engine-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	RegisterEngine("testengine", func(file string, cache int, handles int) (Database, error) {
+		if err := os.MkdirAll(file, 0755); err != nil {
+			return nil, err
+		}
+		return NewMemDatabase()
+	})
+	defer func() {
+		enginesLock.Lock()
+		delete(engines, "testengine")
+		enginesLock.Unlock()
+	}()
+
+	path := filepath.Join(dir, "db")
+	if _, err := Open("nonexistent", path, 0, 0); err == nil {
+		t.Fatalf("opened database with unknown engine")
+	}
+	db, err := Open("testengine", path, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	db.Close()
+
+	if engine, err := readEngine(path); err != nil || engine != "testengine" {
+		t.Fatalf("recorded engine mismatch: have %q, %v, want %q", engine, err, "testengine")
+	}
+	if _, err := Open(DefaultEngine, path, 0, 0); err == nil {
+		t.Fatalf("opened database with mismatching engine")
+	}
+	if db, err = Open("", path, 0, 0); err != nil {
+		t.Fatalf("failed to reopen database with recorded engine: %v", err)
+	}
+	if _, ok := db.(*MemDatabase); !ok {
+		t.Fatalf("reopened database with wrong engine: %T", db)
+	}
+	db.Close()
+}
+
+// Tests that databases created before engines were recorded are detected as
+// LevelDB ones.
+func TestEngineLegacyDetection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethdb-engine-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	db.Close()
+
+	if engine, err := readEngine(dir); err != nil || engine != DefaultEngine {
+		t.Fatalf("detected engine mismatch: have %q, %v, want %q", engine, err, DefaultEngine)
+	}
+	if _, err := Open("testengine", dir, 0, 0); err == nil {
+		t.Fatalf("opened legacy database with mismatching engine")
+	}
+	reopened, err := Open("", dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to reopen legacy database: %v", err)
+	}
+	reopened.Close()
+}
@@ -0,0 +1,247 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Names of the tables within the freezer, each storing one kind of ancient data
+// indexed by block number.
+const (
+	FreezerHeaderTable     = "headers"  // RLP encoded canonical headers
+	FreezerHashTable       = "hashes"   // Canonical block hashes
+	FreezerBodiesTable     = "bodies"   // RLP encoded canonical block bodies
+	FreezerReceiptTable    = "receipts" // RLP encoded canonical block receipts
+	FreezerDifficultyTable = "diffs"    // RLP encoded total difficulties
+)
+
+// freezerTables lists all the freezer tables, along with whether their contents
+// are incompressible hashes and numbers.
+var freezerTables = map[string]bool{
+	FreezerHeaderTable:     false,
+	FreezerHashTable:       true,
+	FreezerBodiesTable:     false,
+	FreezerReceiptTable:    false,
+	FreezerDifficultyTable: true,
+}
+
+// freezerTableSize defines the maximum size of freezer data files.
+const freezerTableSize = 2 * 1000 * 1000 * 1000
+
+// errUnknownTable is returned if the user attempts to read from a table that is
+// not tracked by the freezer.
+var errUnknownTable = errors.New("unknown table")
+
+// Freezer is an append-only database to store immutable chain data
+// into flat files:
+//
+//   - The append only nature ensures that disk writes are minimized.
+//   - The data files are split into chunks to avoid huge files, making backups
+//     and moving them onto cheaper storage simpler.
+type Freezer struct {
+	frozen uint64 // Number of blocks already frozen (atomic, keep 8-byte aligned)
+
+	tables map[string]*freezerTable // Data tables for storing everything
+}
+
+// NewFreezer creates a chain freezer that moves ancient chain data into
+// append-only flat file containers.
+func NewFreezer(datadir string) (*Freezer, error) {
+	freezer := &Freezer{
+		tables: make(map[string]*freezerTable),
+	}
+	for name, noCompression := range freezerTables {
+		table, err := newTable(datadir, name, freezerTableSize, noCompression)
+		if err != nil {
+			freezer.Close()
+			return nil, err
+		}
+		freezer.tables[name] = table
+	}
+	if err := freezer.repair(); err != nil {
+		freezer.Close()
+		return nil, err
+	}
+	log.Info("Opened ancient database", "path", datadir, "frozen", atomic.LoadUint64(&freezer.frozen))
+	return freezer, nil
+}
+
+// repair truncates all data tables to the same length.
+func (f *Freezer) repair() error {
+	min := uint64(math.MaxUint64)
+	for _, table := range f.tables {
+		if items := atomic.LoadUint64(&table.items); min > items {
+			min = items
+		}
+	}
+	for _, table := range f.tables {
+		if err := table.truncate(min); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.frozen, min)
+	return nil
+}
+
+// HasAncient returns an indicator whether the specified ancient data exists in
+// the freezer.
+func (f *Freezer) HasAncient(kind string, number uint64) (bool, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.has(number), nil
+	}
+	return false, nil
+}
+
+// Ancient retrieves an ancient binary blob from the append-only immutable files.
+func (f *Freezer) Ancient(kind string, number uint64) ([]byte, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.Retrieve(number)
+	}
+	return nil, errUnknownTable
+}
+
+// Ancients returns the length of the frozen items.
+func (f *Freezer) Ancients() (uint64, error) {
+	return atomic.LoadUint64(&f.frozen), nil
+}
+
+// AncientSize returns the ancient size of the specified category.
+func (f *Freezer) AncientSize(kind string) (uint64, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.size()
+	}
+	return 0, errUnknownTable
+}
+
+// AppendAncient injects all binary blobs belonging to a block at the end of the
+// append-only immutable table files.
+//
+// Notably, this function is lock free but kind of thread-safe. All out-of-order
+// injection will be rejected. But if two injections with the same number happen
+// at the same time, we can get into the trouble.
+func (f *Freezer) AppendAncient(number uint64, hash, header, body, receipts, td []byte) (err error) {
+	// Rollback all inserted data if any insertion below failed to ensure the
+	// tables won't go out of sync
+	defer func() {
+		if err != nil {
+			frozen := atomic.LoadUint64(&f.frozen)
+			for _, table := range f.tables {
+				table.truncate(frozen)
+			}
+		}
+	}()
+	blobs := map[string][]byte{
+		FreezerHashTable:       hash,
+		FreezerHeaderTable:     header,
+		FreezerBodiesTable:     body,
+		FreezerReceiptTable:    receipts,
+		FreezerDifficultyTable: td,
+	}
+	for name, blob := range blobs {
+		if err := f.tables[name].Append(number, blob); err != nil {
+			log.Error("Failed to append ancient", "table", name, "number", number, "err", err)
+			return err
+		}
+	}
+	atomic.AddUint64(&f.frozen, 1) // Only modify atomically
+	return nil
+}
+
+// TruncateAncients discards any recent data above the provided threshold number.
+func (f *Freezer) TruncateAncients(items uint64) error {
+	if atomic.LoadUint64(&f.frozen) <= items {
+		return nil
+	}
+	for _, table := range f.tables {
+		if err := table.truncate(items); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.frozen, items)
+	return nil
+}
+
+// Sync flushes all data tables to disk.
+func (f *Freezer) Sync() error {
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// Close terminates the chain freezer, closing all the data files.
+func (f *Freezer) Close() error {
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// freezerdb is a database wrapper that enables freezer data retrievals.
+type freezerdb struct {
+	Database
+	*Freezer
+}
+
+// NewDatabaseWithFreezer creates a high level database on top of a given key-
+// value data store with a freezer moving immutable chain segments into cold
+// storage at the given path.
+func NewDatabaseWithFreezer(db Database, freezer string) (Database, error) {
+	frdb, err := NewFreezer(freezer)
+	if err != nil {
+		return nil, err
+	}
+	return &freezerdb{
+		Database: db,
+		Freezer:  frdb,
+	}, nil
+}
+
+// Close implements Database, closing both the key-value store and the freezer.
+func (db *freezerdb) Close() {
+	if err := db.Freezer.Close(); err != nil {
+		log.Error("Failed to close ancient database", "err", err)
+	}
+	db.Database.Close()
+}
+
+// KeyValueStore returns the key-value store backing a database, unwrapping any
+// ancient store in front of it.
+func KeyValueStore(db Database) Database {
+	if frdb, ok := db.(*freezerdb); ok {
+		return frdb.Database
+	}
+	return db
+}
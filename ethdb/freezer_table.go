@@ -0,0 +1,411 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/snappy"
+)
+
+var (
+	// errClosed is returned if an operation attempts to read from or write to
+	// the freezer table after it has already been closed.
+	errClosed = errors.New("closed")
+
+	// errOutOfBounds is returned if the item requested is not contained within
+	// the freezer table.
+	errOutOfBounds = errors.New("out of bounds")
+)
+
+// indexEntrySize is the size of an index entry: a 2 byte data file number
+// followed by a 4 byte offset within that file.
+const indexEntrySize = 6
+
+// indexEntry contains the number/id of the file that the data resides in, as
+// well as the offset within the file to the end of the data. The start of an
+// item is the end of the previous one, or the beginning of the file if the
+// previous item is in another file.
+type indexEntry struct {
+	filenum uint32 // stored as uint16 (2 bytes)
+	offset  uint32 // stored as uint32 (4 bytes)
+}
+
+// unmarshalBinary deserializes an index entry.
+func (i *indexEntry) unmarshalBinary(b []byte) {
+	i.filenum = uint32(binary.BigEndian.Uint16(b[:2]))
+	i.offset = binary.BigEndian.Uint32(b[2:6])
+}
+
+// marshalBinary serializes an index entry.
+func (i *indexEntry) marshalBinary() []byte {
+	b := make([]byte, indexEntrySize)
+	binary.BigEndian.PutUint16(b[:2], uint16(i.filenum))
+	binary.BigEndian.PutUint32(b[2:6], i.offset)
+	return b
+}
+
+// freezerTable represents a single chained data table within the freezer (e.g.
+// blocks). It consists of a data file (snappy encoded arbitrary data blobs),
+// split into multiple files once they reach a maximum size, and an index file
+// (uncompressed 6 byte entries pointing to the end of each blob).
+type freezerTable struct {
+	items uint64 // Number of items stored in the table (atomic, keep 8-byte aligned)
+
+	noCompression bool   // If true, disables snappy compression
+	maxFileSize   uint32 // Max file size for data files
+	name          string // Name of the table, the prefix of all its files
+	path          string // Directory containing the table files
+
+	head      *os.File            // File descriptor for the data head of the table
+	files     map[uint32]*os.File // Open files, head included
+	headId    uint32              // Number/id of the current head file
+	headBytes uint32              // Number of bytes written to the head file
+	index     *os.File            // File descriptor for the index of the table
+
+	lock sync.RWMutex // Mutex protecting the data file descriptors
+}
+
+// newTable opens a freezer table, creating the data and index files if they
+// are non-existent. Both files are truncated to the shortest common length to
+// ensure they don't go out of sync.
+func newTable(path string, name string, maxFileSize uint32, noCompression bool) (*freezerTable, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	idxName := fmt.Sprintf("%s.ridx", name)
+	if !noCompression {
+		idxName = fmt.Sprintf("%s.cidx", name)
+	}
+	index, err := os.OpenFile(filepath.Join(path, idxName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	tab := &freezerTable{
+		noCompression: noCompression,
+		maxFileSize:   maxFileSize,
+		name:          name,
+		path:          path,
+		files:         make(map[uint32]*os.File),
+		index:         index,
+	}
+	if err := tab.repair(); err != nil {
+		tab.Close()
+		return nil, err
+	}
+	return tab, nil
+}
+
+// repair cross checks the head and the index file and truncates them to be in
+// sync with each other after a potential crash or data loss.
+func (t *freezerTable) repair() error {
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	// Ensure the index starts with the zero entry and holds only full entries
+	if stat.Size() == 0 {
+		if _, err := t.index.Write((&indexEntry{}).marshalBinary()); err != nil {
+			return err
+		}
+		stat, err = t.index.Stat()
+		if err != nil {
+			return err
+		}
+	}
+	offsetsSize := stat.Size()
+	if overflow := offsetsSize % indexEntrySize; overflow != 0 {
+		offsetsSize -= overflow
+		if err := t.index.Truncate(offsetsSize); err != nil {
+			return err
+		}
+	}
+	// Open the head file and drop any index entries beyond its data
+	var last indexEntry
+	for {
+		buf := make([]byte, indexEntrySize)
+		if _, err := t.index.ReadAt(buf, offsetsSize-indexEntrySize); err != nil {
+			return err
+		}
+		last.unmarshalBinary(buf)
+
+		head, err := t.openFile(last.filenum)
+		if err != nil {
+			return err
+		}
+		stat, err := head.Stat()
+		if err != nil {
+			return err
+		}
+		contentSize := stat.Size()
+		if contentSize > int64(last.offset) {
+			// Data beyond the last indexed item, drop it
+			if err := head.Truncate(int64(last.offset)); err != nil {
+				return err
+			}
+			contentSize = int64(last.offset)
+		}
+		if contentSize == int64(last.offset) || offsetsSize == indexEntrySize {
+			t.head, t.headId, t.headBytes = head, last.filenum, uint32(contentSize)
+			break
+		}
+		// Indexed item missing from the data, drop the index entry
+		offsetsSize -= indexEntrySize
+		if err := t.index.Truncate(offsetsSize); err != nil {
+			return err
+		}
+	}
+	if _, err := t.index.Seek(offsetsSize, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := t.head.Seek(int64(t.headBytes), io.SeekStart); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&t.items, uint64(offsetsSize/indexEntrySize-1))
+
+	// Drop any data files beyond the head and open all the older ones for reading
+	for num, f := range t.files {
+		if num > t.headId {
+			f.Close()
+			delete(t.files, num)
+			os.Remove(t.fileName(num))
+		}
+	}
+	for num := uint32(0); num < t.headId; num++ {
+		if _, err := t.openFile(num); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileName returns the name of a data file of the table.
+func (t *freezerTable) fileName(num uint32) string {
+	if t.noCompression {
+		return filepath.Join(t.path, fmt.Sprintf("%s.%04d.rdat", t.name, num))
+	}
+	return filepath.Join(t.path, fmt.Sprintf("%s.%04d.cdat", t.name, num))
+}
+
+// openFile opens (or creates) a data file and tracks its descriptor.
+func (t *freezerTable) openFile(num uint32) (*os.File, error) {
+	if f, ok := t.files[num]; ok {
+		return f, nil
+	}
+	f, err := os.OpenFile(t.fileName(num), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	t.files[num] = f
+	return f, nil
+}
+
+// truncate discards any recent data above the provided threshold number.
+func (t *freezerTable) truncate(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if atomic.LoadUint64(&t.items) <= items {
+		return nil
+	}
+	// Truncate the index file to the new item count
+	if err := t.index.Truncate(int64(items+1) * indexEntrySize); err != nil {
+		return err
+	}
+	if _, err := t.index.Seek(int64(items+1)*indexEntrySize, io.SeekStart); err != nil {
+		return err
+	}
+	buf := make([]byte, indexEntrySize)
+	if _, err := t.index.ReadAt(buf, int64(items)*indexEntrySize); err != nil {
+		return err
+	}
+	var last indexEntry
+	last.unmarshalBinary(buf)
+
+	// Drop any data files above the new head and truncate the head itself
+	for num := t.headId; num > last.filenum; num-- {
+		t.files[num].Close()
+		delete(t.files, num)
+		os.Remove(t.fileName(num))
+	}
+	head, err := t.openFile(last.filenum)
+	if err != nil {
+		return err
+	}
+	if err := head.Truncate(int64(last.offset)); err != nil {
+		return err
+	}
+	if _, err := head.Seek(int64(last.offset), io.SeekStart); err != nil {
+		return err
+	}
+	t.head, t.headId, t.headBytes = head, last.filenum, last.offset
+	atomic.StoreUint64(&t.items, items)
+	return nil
+}
+
+// Append injects a binary blob at the end of the freezer table. The item number
+// is a precautionary parameter to ensure data correctness, but the table will
+// reject already existing data.
+func (t *freezerTable) Append(item uint64, blob []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if items := atomic.LoadUint64(&t.items); items != item {
+		return fmt.Errorf("appending unexpected item: want %d, have %d", items, item)
+	}
+	if !t.noCompression {
+		blob = snappy.Encode(nil, blob)
+	}
+	// Start a new data file if the item doesn't fit into the current one
+	if t.headBytes > 0 && uint64(t.headBytes)+uint64(len(blob)) > uint64(t.maxFileSize) {
+		head, err := t.openFile(t.headId + 1)
+		if err != nil {
+			return err
+		}
+		t.head, t.headId, t.headBytes = head, t.headId+1, 0
+	}
+	if _, err := t.head.Write(blob); err != nil {
+		return err
+	}
+	t.headBytes += uint32(len(blob))
+
+	entry := indexEntry{filenum: t.headId, offset: t.headBytes}
+	if _, err := t.index.Write(entry.marshalBinary()); err != nil {
+		return err
+	}
+	atomic.AddUint64(&t.items, 1)
+	return nil
+}
+
+// Retrieve looks up the data offset of an item and returns its (decompressed)
+// contents.
+func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.index == nil {
+		return nil, errClosed
+	}
+	if atomic.LoadUint64(&t.items) <= item {
+		return nil, errOutOfBounds
+	}
+	// Look up the bounds of the item from the index
+	buf := make([]byte, 2*indexEntrySize)
+	if _, err := t.index.ReadAt(buf, int64(item)*indexEntrySize); err != nil {
+		return nil, err
+	}
+	var start, end indexEntry
+	start.unmarshalBinary(buf[:indexEntrySize])
+	end.unmarshalBinary(buf[indexEntrySize:])
+
+	if start.filenum != end.filenum {
+		start.offset = 0 // Item is at the beginning of a new file
+	}
+	f, ok := t.files[end.filenum]
+	if !ok {
+		return nil, fmt.Errorf("missing data file %d", end.filenum)
+	}
+	blob := make([]byte, end.offset-start.offset)
+	if _, err := f.ReadAt(blob, int64(start.offset)); err != nil {
+		return nil, err
+	}
+	if t.noCompression {
+		return blob, nil
+	}
+	return snappy.Decode(nil, blob)
+}
+
+// has returns an indicator whether the specified item is present in the table.
+func (t *freezerTable) has(item uint64) bool {
+	return atomic.LoadUint64(&t.items) > item
+}
+
+// size returns the total data size of the table.
+func (t *freezerTable) size() (uint64, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.index == nil {
+		return 0, errClosed
+	}
+	stat, err := t.index.Stat()
+	if err != nil {
+		return 0, err
+	}
+	total := uint64(stat.Size()) + uint64(t.headBytes)
+	for num := uint32(0); num < t.headId; num++ {
+		stat, err := t.files[num].Stat()
+		if err != nil {
+			return 0, err
+		}
+		total += uint64(stat.Size())
+	}
+	return total, nil
+}
+
+// Sync pushes any pending data from memory out to disk.
+func (t *freezerTable) Sync() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if err := t.index.Sync(); err != nil {
+		return err
+	}
+	return t.head.Sync()
+}
+
+// Close closes all opened files.
+func (t *freezerTable) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var errs []error
+	if t.index != nil {
+		if err := t.index.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		t.index = nil
+	}
+	for num, f := range t.files {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(t.files, num)
+	}
+	t.head = nil
+
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// getChunk returns a deterministic test blob of the given size.
+func getChunk(size int, b int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(b)
+	}
+	return data
+}
+
+// Tests that items written to a freezer table can be read back, also after the
+// table is split across multiple data files and reopened.
+func TestFreezerTableBasics(t *testing.T) {
+	for _, noCompression := range []bool{true, false} {
+		dir, err := ioutil.TempDir("", "freezer-")
+		if err != nil {
+			t.Fatalf("failed to create temporary directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		// Write 255 items of 15 bytes into 50 byte files, 3 items per file
+		table, err := newTable(dir, "test", 50, noCompression)
+		if err != nil {
+			t.Fatalf("failed to create table: %v", err)
+		}
+		for i := 0; i < 255; i++ {
+			if err := table.Append(uint64(i), getChunk(15, i)); err != nil {
+				t.Fatalf("failed to append item %d: %v", i, err)
+			}
+		}
+		if err := table.Append(300, getChunk(15, 0)); err == nil {
+			t.Fatalf("out of order append accepted")
+		}
+		table.Close()
+
+		if table, err = newTable(dir, "test", 50, noCompression); err != nil {
+			t.Fatalf("failed to reopen table: %v", err)
+		}
+		defer table.Close()
+
+		for i := 0; i < 255; i++ {
+			blob, err := table.Retrieve(uint64(i))
+			if err != nil {
+				t.Fatalf("failed to retrieve item %d: %v", i, err)
+			}
+			if !bytes.Equal(blob, getChunk(15, i)) {
+				t.Fatalf("item %d mismatch: have %x, want %x", i, blob, getChunk(15, i))
+			}
+		}
+		if _, err := table.Retrieve(255); err != errOutOfBounds {
+			t.Fatalf("out of bounds retrieval error mismatch: have %v, want %v", err, errOutOfBounds)
+		}
+	}
+}
+
+// Tests that a table whose data file lost some of its contents is repaired to
+// the last fully available item on open.
+func TestFreezerTableRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	table, err := newTable(dir, "test", 1000, true)
+	if err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		table.Append(uint64(i), getChunk(20, i))
+	}
+	table.Close()
+
+	// Cut the data file in the middle of the 8th item
+	if err := os.Truncate(filepath.Join(dir, "test.0000.rdat"), 7*20+10); err != nil {
+		t.Fatalf("failed to truncate data file: %v", err)
+	}
+	if table, err = newTable(dir, "test", 1000, true); err != nil {
+		t.Fatalf("failed to reopen table: %v", err)
+	}
+	defer table.Close()
+
+	if !table.has(6) || table.has(7) {
+		t.Fatalf("item count mismatch after repair: have %d, want %d", table.items, 7)
+	}
+	// Appending should continue at the repaired position
+	if err := table.Append(7, getChunk(20, 0xff)); err != nil {
+		t.Fatalf("failed to append after repair: %v", err)
+	}
+	if blob, _ := table.Retrieve(7); !bytes.Equal(blob, getChunk(20, 0xff)) {
+		t.Fatalf("item mismatch after repair: have %x", blob)
+	}
+}
+
+// Tests that truncating a table drops all items above the limit, including the
+// data files they were stored in.
+func TestFreezerTableTruncate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	table, err := newTable(dir, "test", 50, false)
+	if err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	defer table.Close()
+
+	for i := 0; i < 30; i++ {
+		table.Append(uint64(i), getChunk(15, i))
+	}
+	if err := table.truncate(4); err != nil {
+		t.Fatalf("failed to truncate table: %v", err)
+	}
+	if !table.has(3) || table.has(4) {
+		t.Fatalf("item count mismatch after truncation: have %d, want %d", table.items, 4)
+	}
+	if _, err := os.Stat(table.fileName(table.headId + 1)); !os.IsNotExist(err) {
+		t.Fatalf("data file above the head not removed: %v", err)
+	}
+	for i := 4; i < 8; i++ {
+		if err := table.Append(uint64(i), getChunk(15, 100+i)); err != nil {
+			t.Fatalf("failed to append item %d: %v", i, err)
+		}
+	}
+	for i := 0; i < 8; i++ {
+		want := getChunk(15, i)
+		if i >= 4 {
+			want = getChunk(15, 100+i)
+		}
+		if blob, err := table.Retrieve(uint64(i)); err != nil || !bytes.Equal(blob, want) {
+			t.Fatalf("item %d mismatch: have %x, %v, want %x", i, blob, err, want)
+		}
+	}
+}
+
+// Tests that the freezer keeps its tables in sync, rolling back to the shortest
+// one on open.
+func TestFreezerAppendTruncate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFreezer(dir)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	for i := uint64(0); i < 10; i++ {
+		blob := []byte(fmt.Sprintf("item-%d", i))
+		if err := f.AppendAncient(i, blob, blob, blob, blob, blob); err != nil {
+			t.Fatalf("failed to append block %d: %v", i, err)
+		}
+	}
+	if err := f.AppendAncient(20, nil, nil, nil, nil, nil); err == nil {
+		t.Fatalf("out of order append accepted")
+	}
+	if frozen, _ := f.Ancients(); frozen != 10 {
+		t.Fatalf("frozen count mismatch: have %d, want %d", frozen, 10)
+	}
+	// Grow a single table behind the freezer's back and ensure it's repaired
+	f.tables[FreezerBodiesTable].Append(10, []byte("dangling"))
+	f.Close()
+
+	if f, err = NewFreezer(dir); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	defer f.Close()
+
+	if ok, _ := f.HasAncient(FreezerBodiesTable, 10); ok {
+		t.Fatalf("dangling item not repaired")
+	}
+	if err := f.TruncateAncients(5); err != nil {
+		t.Fatalf("failed to truncate freezer: %v", err)
+	}
+	for kind := range freezerTables {
+		if blob, err := f.Ancient(kind, 4); err != nil || string(blob) != "item-4" {
+			t.Errorf("%s: item mismatch: have %q, %v, want %q", kind, blob, err, "item-4")
+		}
+		if ok, _ := f.HasAncient(kind, 5); ok {
+			t.Errorf("%s: truncated item still available", kind)
+		}
+	}
+}
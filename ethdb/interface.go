@@ -25,12 +25,86 @@ type Putter interface {
 	Put(key []byte, value []byte) error
 }
 
+// Deleter wraps the database delete operation supported by both batches and regular databases.
+type Deleter interface {
+	Delete(key []byte) error
+}
+
+// Iterator iterates over a database's key/value pairs in ascending key order.
+//
+// When it encounters an error any seek will return false and will yield no key/
+// value pairs. The error can be queried by calling the Error method. Calling
+// Release is still necessary.
+//
+// An iterator must be released after use, but it is not necessary to read an
+// iterator until exhaustion. An iterator is not safe for concurrent use, but it
+// is safe to use multiple iterators concurrently.
+type Iterator interface {
+	// Next moves the iterator to the next key/value pair. It returns whether the
+	// iterator is exhausted.
+	Next() bool
+
+	// Error returns any accumulated error. Exhausting all the key/value pairs
+	// is not considered to be an error.
+	Error() error
+
+	// Key returns the key of the current key/value pair, or nil if done. The
+	// caller should not modify the contents of the returned slice, and its
+	// contents may change on the next call to Next.
+	Key() []byte
+
+	// Value returns the value of the current key/value pair, or nil if done. The
+	// caller should not modify the contents of the returned slice, and its
+	// contents may change on the next call to Next.
+	Value() []byte
+
+	// Release releases associated resources. Release should always succeed and
+	// can be called multiple times without causing error.
+	Release()
+}
+
+// Iteratee wraps the NewIterator method of a backing data store.
+type Iteratee interface {
+	// NewIterator creates a binary-alphabetical iterator over the subset of the
+	// database content with a particular key prefix, starting at a particular
+	// initial key (or after, if it does not exist). The start key is relative to
+	// the prefix.
+	//
+	// The iterator reflects the content of the database at the time of creation,
+	// later modifications may or may not be visible through it.
+	NewIterator(prefix []byte, start []byte) Iterator
+}
+
+// RangeDeleter wraps the DeleteRange method of a backing data store.
+type RangeDeleter interface {
+	// DeleteRange deletes all the keys in the range [start, end). A nil start is
+	// treated as a key before all keys in the data store, a nil end is treated
+	// as a key after all keys in the data store.
+	DeleteRange(start []byte, end []byte) error
+}
+
+// Compacter wraps the Compact method of a backing data store.
+type Compacter interface {
+	// Compact flattens the underlying data store for the given key range. In
+	// essence, deleted and overwritten versions are discarded, and the data is
+	// rearranged to reduce the cost of operations needed to access them.
+	//
+	// A nil start is treated as a key before all keys in the data store, a nil
+	// limit is treated as a key after all keys in the data store. If both are
+	// nil then it will compact the entire data store. Data stores without any
+	// notion of compaction simply return nil.
+	Compact(start []byte, limit []byte) error
+}
+
 // Database wraps all database operations. All methods are safe for concurrent use.
 type Database interface {
 	Putter
+	Deleter
+	Iteratee
+	RangeDeleter
+	Compacter
 	Get(key []byte) ([]byte, error)
 	Has(key []byte) (bool, error)
-	Delete(key []byte) error
 	Close()
 	NewBatch() Batch
 }
@@ -39,6 +113,48 @@ type Database interface {
 // when Write is called. Batch cannot be used concurrently.
 type Batch interface {
 	Putter
+	Deleter
 	ValueSize() int // amount of data in the batch
 	Write() error
+	// Reset resets the batch for reuse
+	Reset()
+}
+
+// AncientReader contains the methods required to read from the immutable
+// ancient chain segment.
+type AncientReader interface {
+	// HasAncient returns an indicator whether the specified data exists in the
+	// ancient store.
+	HasAncient(kind string, number uint64) (bool, error)
+
+	// Ancient retrieves an ancient binary blob from the append-only immutable files.
+	Ancient(kind string, number uint64) ([]byte, error)
+
+	// Ancients returns the number of items frozen into the ancient store.
+	Ancients() (uint64, error)
+
+	// AncientSize returns the total data size of the specified category.
+	AncientSize(kind string) (uint64, error)
+}
+
+// AncientWriter contains the methods required to write to the immutable ancient
+// chain segment.
+type AncientWriter interface {
+	// AppendAncient injects all binary blobs belonging to a block at the end of
+	// the append-only immutable table files.
+	AppendAncient(number uint64, hash, header, body, receipts, td []byte) error
+
+	// TruncateAncients discards all but the first n ancient items.
+	TruncateAncients(n uint64) error
+
+	// Sync flushes all in-memory ancient data to disk.
+	Sync() error
+}
+
+// AncientStore is a database with an immutable ancient chain segment in front
+// of its key-value store.
+type AncientStore interface {
+	Database
+	AncientReader
+	AncientWriter
 }
@@ -26,22 +26,24 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/syndtr/goleveldb/leveldb"
-	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 const (
@@ -580,17 +582,14 @@ type CallArgs struct {
 	Data     hexutil.Bytes   `json:"data"`
 }
 
-func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, vmCfg vm.Config) ([]byte, uint64, bool, error) {
-	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
-
-	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
-	if state == nil || err != nil {
-		return nil, 0, false, err
-	}
+// ToMessage converts the call arguments to a message executable by the EVM. If
+// no sender is specified, the first account of the account manager is used, and
+// the gas allowance and price fall back to generous defaults if unset.
+func (args *CallArgs) ToMessage(am *accounts.Manager) types.Message {
 	// Set sender address or use a default if none specified
 	addr := args.From
 	if addr == (common.Address{}) {
-		if wallets := s.b.AccountManager().Wallets(); len(wallets) > 0 {
+		if wallets := am.Wallets(); len(wallets) > 0 {
 			if accounts := wallets[0].Accounts(); len(accounts) > 0 {
 				addr = accounts[0].Address
 			}
@@ -604,9 +603,68 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 	if gasPrice.Sign() == 0 {
 		gasPrice = new(big.Int).SetUint64(defaultGasPrice)
 	}
+	return types.NewMessage(addr, args.To, 0, args.Value.ToInt(), gas, gasPrice, args.Data, false)
+}
+
+// OverrideAccount indicates the overriding fields of an account during the
+// execution of a message call. State replaces the entire storage of the account,
+// whereas StateDiff only patches the given slots; they are mutually exclusive.
+type OverrideAccount struct {
+	Nonce     *hexutil.Uint64              `json:"nonce"`
+	Code      *hexutil.Bytes               `json:"code"`
+	Balance   *hexutil.Big                 `json:"balance"`
+	State     *map[common.Hash]common.Hash `json:"state"`
+	StateDiff *map[common.Hash]common.Hash `json:"stateDiff"`
+}
+
+// StateOverride is the collection of overridden accounts.
+type StateOverride map[common.Address]OverrideAccount
+
+// Apply overrides the fields of the specified accounts into the given state.
+func (diff *StateOverride) Apply(statedb *state.StateDB) error {
+	if diff == nil {
+		return nil
+	}
+	for addr, account := range *diff {
+		if account.State != nil && account.StateDiff != nil {
+			return fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
+		}
+		if account.Nonce != nil {
+			statedb.SetNonce(addr, uint64(*account.Nonce))
+		}
+		if account.Code != nil {
+			statedb.SetCode(addr, *account.Code)
+		}
+		if account.Balance != nil {
+			statedb.SetBalance(addr, (*big.Int)(account.Balance))
+		}
+		if account.State != nil {
+			statedb.SetStorage(addr, *account.State)
+		}
+		if account.StateDiff != nil {
+			for key, value := range *account.StateDiff {
+				statedb.SetState(addr, key, value)
+			}
+		}
+	}
+	return nil
+}
 
-	// Create new call message
-	msg := types.NewMessage(addr, args.To, 0, args.Value.ToInt(), gas, gasPrice, args.Data, false)
+func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride, vmCfg vm.Config) ([]byte, uint64, bool, error) {
+	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
+
+	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		return nil, 0, false, err
+	}
+	// Create new call message, funding the sender to pay for it. Overrides are
+	// applied afterwards, so they take precedence over the funding.
+	msg := args.ToMessage(s.b.AccountManager())
+	state.SetBalance(msg.From(), math.MaxBig256)
+
+	if err := overrides.Apply(state); err != nil {
+		return nil, 0, false, err
+	}
 
 	// Setup context so it may be cancelled the call has completed
 	// or, in case of unmetered gas, setup a context with a timeout.
@@ -642,16 +700,59 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 	return res, gas, failed, err
 }
 
+// errExecutionFailed is returned by calls that failed without returning any revert
+// data, e.g. by running out of gas or reverting without a reason.
+var errExecutionFailed = errors.New("execution failed")
+
+// revertError is an API error that encompasses an EVM revert with a JSON error
+// code and the hex encoded revert data.
+type revertError struct {
+	error
+	data string // revert data, hex encoded
+}
+
+// ErrorCode returns the JSON error code for a reverted execution.
+func (e *revertError) ErrorCode() int {
+	return 3
+}
+
+// ErrorData returns the hex encoded revert data.
+func (e *revertError) ErrorData() interface{} {
+	return e.data
+}
+
+// newRevertError creates a revertError from the data returned by a reverted
+// execution, decoding the revert reason into the error message if present.
+func newRevertError(ret []byte) *revertError {
+	err := errors.New("execution reverted")
+	if reason, errUnpack := abi.UnpackRevert(ret); errUnpack == nil {
+		err = fmt.Errorf("execution reverted: %v", reason)
+	}
+	return &revertError{error: err, data: hexutil.Encode(ret)}
+}
+
 // Call executes the given transaction on the state for the given block number.
 // It doesn't make and changes in the state/blockchain and is useful to execute and retrieve values.
-func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
-	result, _, _, err := s.doCall(ctx, args, blockNr, vm.Config{DisableGasMetering: true})
-	return (hexutil.Bytes)(result), err
+// The state of any accounts can optionally be overridden for the duration of the call.
+func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride) (hexutil.Bytes, error) {
+	result, _, failed, err := s.doCall(ctx, args, blockNr, overrides, vm.Config{DisableGasMetering: true})
+	if err != nil {
+		return nil, err
+	}
+	// Surface failed executions as errors, with the revert data if any was returned
+	if failed {
+		if len(result) > 0 {
+			return nil, newRevertError(result)
+		}
+		return nil, errExecutionFailed
+	}
+	return (hexutil.Bytes)(result), nil
 }
 
 // EstimateGas returns an estimate of the amount of gas needed to execute the
-// given transaction against the current pending block.
-func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (hexutil.Uint64, error) {
+// given transaction against the current pending block, with the optionally
+// overridden accounts.
+func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs, overrides *StateOverride) (hexutil.Uint64, error) {
 	// Binary search the gas requirement, as it may be higher than the amount used
 	var (
 		lo  uint64 = params.TxGas - 1
@@ -670,20 +771,24 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (h
 	}
 	cap = hi
 
-	// Create a helper to check if a gas allowance results in an executable transaction
-	executable := func(gas uint64) bool {
+	// Create a helper to check if a gas allowance results in an executable transaction,
+	// returning the revert data of failed executions too
+	executable := func(gas uint64) (bool, []byte) {
 		args.Gas = hexutil.Uint64(gas)
 
-		_, _, failed, err := s.doCall(ctx, args, rpc.PendingBlockNumber, vm.Config{})
-		if err != nil || failed {
-			return false
+		res, _, failed, err := s.doCall(ctx, args, rpc.PendingBlockNumber, overrides, vm.Config{})
+		if err != nil {
+			return false, nil
 		}
-		return true
+		if failed {
+			return false, res
+		}
+		return true, nil
 	}
 	// Execute the binary search and hone in on an executable gas limit
 	for lo+1 < hi {
 		mid := (hi + lo) / 2
-		if !executable(mid) {
+		if ok, _ := executable(mid); !ok {
 			lo = mid
 		} else {
 			hi = mid
@@ -691,13 +796,141 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (h
 	}
 	// Reject the transaction as invalid if it still fails at the highest allowance
 	if hi == cap {
-		if !executable(hi) {
+		if ok, revert := executable(hi); !ok {
+			if len(revert) > 0 {
+				return 0, newRevertError(revert)
+			}
 			return 0, fmt.Errorf("gas required exceeds allowance or always failing transaction")
 		}
 	}
 	return hexutil.Uint64(hi), nil
 }
 
+// BlockOverrides is a set of block context fields to override while simulating
+// calls on top of a block.
+type BlockOverrides struct {
+	Number   *hexutil.Big    `json:"number"`
+	Time     *hexutil.Big    `json:"timestamp"`
+	Coinbase *common.Address `json:"coinbase"`
+}
+
+// Apply overrides the specified fields of the given header.
+func (o *BlockOverrides) Apply(header *types.Header) {
+	if o == nil {
+		return
+	}
+	if o.Number != nil {
+		header.Number = new(big.Int).Set((*big.Int)(o.Number))
+	}
+	if o.Time != nil {
+		header.Time = new(big.Int).Set((*big.Int)(o.Time))
+	}
+	if o.Coinbase != nil {
+		header.Coinbase = *o.Coinbase
+	}
+}
+
+// BundleCallResult is the outcome of a single call of a simulated bundle.
+type BundleCallResult struct {
+	ReturnValue  hexutil.Bytes  `json:"returnValue"`            // Data returned by a successful call
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`                // Gas consumed by the call
+	Failed       bool           `json:"failed"`                 // Whether the call failed or reverted
+	Revert       hexutil.Bytes  `json:"revert,omitempty"`       // Data returned by a reverted call
+	RevertReason string         `json:"revertReason,omitempty"` // Decoded reason of a reverted call
+	Logs         []*types.Log   `json:"logs"`                   // Logs emitted by the call
+}
+
+// callBundleTimeout is the maximum time a whole call bundle may run for before
+// its execution is aborted.
+const callBundleTimeout = 5 * time.Second
+
+// CallBundle executes the given calls one after the other on top of the state of
+// the given block, each seeing the state changes of the previous ones, and returns
+// the outcome of all of them. As with Call, the senders are funded to pay for the
+// calls, once before the first call so that balance changes carry over between
+// them, and nothing is written to the state/blockchain. The block context of the
+// calls can optionally be overridden.
+//
+// The calls of a bundle share the gas limit of the block they are executed on:
+// calls without a gas allowance, or with one above the gas still available, are
+// capped to the remaining gas of the bundle.
+func (s *PublicBlockChainAPI) CallBundle(ctx context.Context, args []CallArgs, blockNr rpc.BlockNumber, overrides *BlockOverrides) ([]*BundleCallResult, error) {
+	defer func(start time.Time) { log.Debug("Executing EVM call bundle finished", "runtime", time.Since(start)) }(time.Now())
+
+	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	header = types.CopyHeader(header)
+	overrides.Apply(header)
+
+	// Abort the bundle if it runs for too long, and make sure the context is
+	// cancelled when the bundle has completed to clean up the resources
+	ctx, cancel := context.WithTimeout(ctx, callBundleTimeout)
+	defer cancel()
+
+	// Create the call messages and fund their senders
+	msgs := make([]types.Message, len(args))
+	for i, arg := range args {
+		msgs[i] = arg.ToMessage(s.b.AccountManager())
+		state.SetBalance(msgs[i].From(), math.MaxBig256)
+	}
+	var (
+		results = make([]*BundleCallResult, 0, len(args))
+		gp      = new(core.GasPool).AddGas(header.GasLimit)
+		logs    int
+	)
+	for i, msg := range msgs {
+		// Cap the gas allowance of the call to the gas left in the bundle
+		if gp.Gas() < params.TxGas {
+			return nil, fmt.Errorf("call %d failed: bundle gas limit %d exhausted", i, header.GasLimit)
+		}
+		if args[i].Gas == 0 || msg.Gas() > gp.Gas() {
+			msg = types.NewMessage(msg.From(), msg.To(), 0, msg.Value(), gp.Gas(), msg.GasPrice(), msg.Data(), false)
+		}
+		// Execute the next call on top of the cumulative state
+		state.Prepare(common.Hash{}, header.Hash(), i)
+
+		evm, vmError, err := s.b.GetEVM(ctx, msg, state, header, vm.Config{})
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			<-ctx.Done()
+			evm.Cancel()
+		}()
+		res, gas, failed, err := core.ApplyMessage(evm, msg, gp)
+		if err := vmError(); err != nil {
+			return nil, err
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("call %d aborted: bundle execution timed out after %v", i, callBundleTimeout)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("call %d failed: %v", i, err)
+		}
+		// Assemble the outcome of the call, including any new logs
+		result := &BundleCallResult{
+			GasUsed: hexutil.Uint64(gas),
+			Failed:  failed,
+			Logs:    append([]*types.Log{}, state.GetLogs(common.Hash{})[logs:]...),
+		}
+		for _, l := range result.Logs {
+			l.BlockNumber = header.Number.Uint64()
+		}
+		logs += len(result.Logs)
+
+		if failed {
+			result.Revert = res
+			result.RevertReason, _ = abi.UnpackRevert(res)
+		} else {
+			result.ReturnValue = res
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
 // ExecutionResult groups all structured logs emitted by the EVM
 // while replaying a transaction in debug mode as well as transaction
 // execution status, the amount of gas used and the return value
@@ -971,18 +1204,21 @@ func (s *PublicTransactionPoolAPI) GetTransactionCount(ctx context.Context, addr
 	return (*hexutil.Uint64)(&nonce), state.Error()
 }
 
-// GetTransactionByHash returns the transaction for the given hash
-func (s *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, hash common.Hash) *RPCTransaction {
+// GetTransactionByHash returns the transaction for the given hash, or nil if it
+// is unknown. If the transactions of the oldest blocks are not indexed due to the
+// transaction lookup limit, an unknown transaction may belong to one of them, so
+// an error is returned instead of nil.
+func (s *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, hash common.Hash) (*RPCTransaction, error) {
 	// Try to return an already finalized transaction
 	if tx, blockHash, blockNumber, index := core.GetTransaction(s.b.ChainDb(), hash); tx != nil {
-		return newRPCTransaction(tx, blockHash, blockNumber, index)
+		return newRPCTransaction(tx, blockHash, blockNumber, index), nil
 	}
 	// No finalized transaction, try to retrieve it from the pool
 	if tx := s.b.GetPoolTransaction(hash); tx != nil {
-		return newRPCPendingTransaction(tx)
+		return newRPCPendingTransaction(tx), nil
 	}
-	// Transaction unknown, return as such
-	return nil
+	// Transaction unknown, return as such unless it might be in a block being indexed
+	return nil, txIndexError(s.b)
 }
 
 // GetRawTransactionByHash returns the bytes of the transaction for the given hash.
@@ -993,7 +1229,7 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByHash(ctx context.Context,
 	if tx, _, _, _ = core.GetTransaction(s.b.ChainDb(), hash); tx == nil {
 		if tx = s.b.GetPoolTransaction(hash); tx == nil {
 			// Transaction not found anywhere, abort
-			return nil, nil
+			return nil, txIndexError(s.b)
 		}
 	}
 	// Serialize to RLP and return
@@ -1004,9 +1240,12 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByHash(ctx context.Context,
 func (s *PublicTransactionPoolAPI) GetTransactionReceipt(hash common.Hash) (map[string]interface{}, error) {
 	tx, blockHash, blockNumber, index := core.GetTransaction(s.b.ChainDb(), hash)
 	if tx == nil {
+		if err := txIndexError(s.b); err != nil {
+			return nil, err
+		}
 		return nil, errors.New("unknown transaction")
 	}
-	receipt, _, _, _ := core.GetReceipt(s.b.ChainDb(), hash) // Old receipts don't have the lookup data available
+	receipt, _, _, _ := core.GetReceipt(s.b.ChainDb(), hash, s.b.ChainConfig()) // Old receipts don't have the lookup data available
 	if receipt == nil {
 		return nil, errors.New("unknown receipt")
 	}
@@ -1047,6 +1286,20 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(hash common.Hash) (map[
 	return fields, nil
 }
 
+// txIndexError returns an error if the transactions of the oldest blocks are not
+// indexed, in which case a transaction missing from the index may still exist in
+// one of them. It returns nil if all blocks are indexed.
+func txIndexError(b Backend) error {
+	tail := core.GetTxIndexTail(b.ChainDb())
+	if tail == nil || *tail == 0 {
+		return nil
+	}
+	if b.TxIndexInProgress() {
+		return fmt.Errorf("transaction indexing in progress, not yet available for blocks below #%d", *tail)
+	}
+	return fmt.Errorf("transaction indexing not available for blocks below #%d", *tail)
+}
+
 // sign is a helper function that signs a transaction with the private key of the given address.
 func (s *PublicTransactionPoolAPI) sign(addr common.Address, tx *types.Transaction) (*types.Transaction, error) {
 	// Look up the wallet containing the requested signer
@@ -1364,11 +1617,11 @@ func NewPrivateDebugAPI(b Backend) *PrivateDebugAPI {
 
 // ChaindbProperty returns leveldb properties of the chain database.
 func (api *PrivateDebugAPI) ChaindbProperty(property string) (string, error) {
-	ldb, ok := api.b.ChainDb().(interface {
+	ldb, ok := ethdb.KeyValueStore(api.b.ChainDb()).(interface {
 		LDB() *leveldb.DB
 	})
 	if !ok {
-		return "", fmt.Errorf("chaindbProperty does not work for memory databases")
+		return "", fmt.Errorf("chaindbProperty only works for LevelDB databases")
 	}
 	if property == "" {
 		property = "leveldb.stats"
@@ -1379,16 +1632,9 @@ func (api *PrivateDebugAPI) ChaindbProperty(property string) (string, error) {
 }
 
 func (api *PrivateDebugAPI) ChaindbCompact() error {
-	ldb, ok := api.b.ChainDb().(interface {
-		LDB() *leveldb.DB
-	})
-	if !ok {
-		return fmt.Errorf("chaindbCompact does not work for memory databases")
-	}
 	for b := byte(0); b < 255; b++ {
 		log.Info("Compacting chain database", "range", fmt.Sprintf("0x%0.2X-0x%0.2X", b, b+1))
-		err := ldb.LDB().CompactRange(util.Range{Start: []byte{b}, Limit: []byte{b + 1}})
-		if err != nil {
+		if err := api.b.ChainDb().Compact([]byte{b}, []byte{b + 1}); err != nil {
 			log.Error("Database compaction failed", "err", err)
 			return err
 		}
@@ -27,6 +27,7 @@ var Modules = map[string]string{
 	"net":        Net_JS,
 	"personal":   Personal_JS,
 	"rpc":        RPC_JS,
+	"shard":      Shard_JS,
 	"shh":        Shh_JS,
 	"swarmfs":    SWARMFS_JS,
 	"txpool":     TxPool_JS,
@@ -342,6 +343,12 @@ web3._extend({
 			params: 2,
 			inputFormatter: [null, null]
 		}),
+		new web3._extend.Method({
+			name: 'traceCall',
+			call: 'debug_traceCall',
+			params: 3,
+			inputFormatter: [null, null, null]
+		}),
 		new web3._extend.Method({
 			name: 'preimage',
 			call: 'debug_preimage',
@@ -416,6 +423,12 @@ web3._extend({
 			params: 2,
 			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.utils.toHex]
 		}),
+		new web3._extend.Method({
+			name: 'callBundle',
+			call: 'eth_callBundle',
+			params: 3,
+			inputFormatter: [null, web3._extend.formatters.inputDefaultBlockNumberFormatter, null]
+		}),
 	],
 	properties: [
 		new web3._extend.Property({
@@ -527,6 +540,42 @@ web3._extend({
 })
 `
 
+const Shard_JS = `
+web3._extend({
+	property: 'shard',
+	methods: [
+		new web3._extend.Method({
+			name: 'getCollationByPeriod',
+			call: 'shard_getCollationByPeriod',
+			params: 3,
+			inputFormatter: [web3._extend.utils.fromDecimal, web3._extend.utils.fromDecimal, null]
+		}),
+		new web3._extend.Method({
+			name: 'getCollationByHash',
+			call: 'shard_getCollationByHash',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'getCollationHeader',
+			call: 'shard_getCollationHeader',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'sendTransaction',
+			call: 'shard_sendTransaction',
+			params: 2,
+			inputFormatter: [web3._extend.utils.fromDecimal, null]
+		}),
+	],
+	properties: [
+		new web3._extend.Property({
+			name: 'validatorSet',
+			getter: 'shard_validatorSet'
+		}),
+	]
+})
+`
+
 const RPC_JS = `
 web3._extend({
 	property: 'rpc',
@@ -22,12 +22,12 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/rlp"
-	"github.com/ethereum/go-ethereum/trie"
 )
 
-// NodeSet stores a set of trie nodes. It implements trie.Database and can also
-// act as a cache for another trie.Database.
+// NodeSet stores a set of trie nodes. It implements trie.DatabaseReader and
+// trie.DatabaseWriter and can also act as a cache for another trie database.
 type NodeSet struct {
 	db       map[string][]byte
 	dataSize int
@@ -99,7 +99,7 @@ func (db *NodeSet) NodeList() NodeList {
 }
 
 // Store writes the contents of the set to the given database
-func (db *NodeSet) Store(target trie.Database) {
+func (db *NodeSet) Store(target ethdb.Putter) {
 	db.lock.RLock()
 	defer db.lock.RUnlock()
 
@@ -112,7 +112,7 @@ func (db *NodeSet) Store(target trie.Database) {
 type NodeList []rlp.RawValue
 
 // Store writes the contents of the list to the given database
-func (n NodeList) Store(db trie.Database) {
+func (n NodeList) Store(db ethdb.Putter) {
 	for _, node := range n {
 		db.Put(crypto.Keccak256(node), node)
 	}
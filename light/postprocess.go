@@ -116,6 +116,7 @@ type ChtIndexerBackend struct {
 	db, cdb              ethdb.Database
 	section, sectionSize uint64
 	lastHash             common.Hash
+	triedb               *trie.Database
 	trie                 *trie.Trie
 }
 
@@ -131,7 +132,7 @@ func NewChtIndexer(db ethdb.Database, clientMode bool) *core.ChainIndexer {
 		sectionSize = ChtV1Frequency
 		confirmReq = HelperTrieProcessConfirmations
 	}
-	return core.NewChainIndexer(db, idb, &ChtIndexerBackend{db: db, cdb: cdb, sectionSize: sectionSize}, sectionSize, confirmReq, time.Millisecond*100, "cht")
+	return core.NewChainIndexer(db, idb, &ChtIndexerBackend{db: db, cdb: cdb, triedb: trie.NewDatabase(cdb), sectionSize: sectionSize}, sectionSize, confirmReq, time.Millisecond*100, "cht")
 }
 
 // Reset implements core.ChainIndexerBackend
@@ -141,7 +142,7 @@ func (c *ChtIndexerBackend) Reset(section uint64, lastSectionHead common.Hash) e
 		root = GetChtRoot(c.db, section-1, lastSectionHead)
 	}
 	var err error
-	c.trie, err = trie.New(root, c.cdb)
+	c.trie, err = trie.New(root, c.triedb)
 	c.section = section
 	return err
 }
@@ -163,12 +164,11 @@ func (c *ChtIndexerBackend) Process(header *types.Header) {
 
 // Commit implements core.ChainIndexerBackend
 func (c *ChtIndexerBackend) Commit() error {
-	batch := c.cdb.NewBatch()
-	root, err := c.trie.CommitTo(batch)
+	root, err := c.trie.Commit(nil)
 	if err != nil {
 		return err
 	} else {
-		batch.Write()
+		c.triedb.Commit(root, false)
 		if ((c.section+1)*c.sectionSize)%ChtFrequency == 0 {
 			log.Info("Storing CHT", "idx", c.section*c.sectionSize/ChtFrequency, "sectionHead", fmt.Sprintf("%064x", c.lastHash), "root", fmt.Sprintf("%064x", root))
 		}
@@ -207,6 +207,7 @@ func StoreBloomTrieRoot(db ethdb.Database, sectionIdx uint64, sectionHead, root
 type BloomTrieIndexerBackend struct {
 	db, cdb                                    ethdb.Database
 	section, parentSectionSize, bloomTrieRatio uint64
+	triedb                                     *trie.Database
 	trie                                       *trie.Trie
 	sectionHeads                               []common.Hash
 }
@@ -215,7 +216,7 @@ type BloomTrieIndexerBackend struct {
 func NewBloomTrieIndexer(db ethdb.Database, clientMode bool) *core.ChainIndexer {
 	cdb := ethdb.NewTable(db, BloomTrieTablePrefix)
 	idb := ethdb.NewTable(db, "bltIndex-")
-	backend := &BloomTrieIndexerBackend{db: db, cdb: cdb}
+	backend := &BloomTrieIndexerBackend{db: db, cdb: cdb, triedb: trie.NewDatabase(cdb)}
 	var confirmReq uint64
 	if clientMode {
 		backend.parentSectionSize = BloomTrieFrequency
@@ -236,7 +237,7 @@ func (b *BloomTrieIndexerBackend) Reset(section uint64, lastSectionHead common.H
 		root = GetBloomTrieRoot(b.db, section-1, lastSectionHead)
 	}
 	var err error
-	b.trie, err = trie.New(root, b.cdb)
+	b.trie, err = trie.New(root, b.triedb)
 	b.section = section
 	return err
 }
@@ -280,12 +281,11 @@ func (b *BloomTrieIndexerBackend) Commit() error {
 		}
 	}
 
-	batch := b.cdb.NewBatch()
-	root, err := b.trie.CommitTo(batch)
+	root, err := b.trie.Commit(nil)
 	if err != nil {
 		return err
 	} else {
-		batch.Write()
+		b.triedb.Commit(root, false)
 		sectionHead := b.sectionHeads[b.bloomTrieRatio-1]
 		log.Info("Storing BloomTrie", "section", b.section, "sectionHead", fmt.Sprintf("%064x", sectionHead), "root", fmt.Sprintf("%064x", root), "compression ratio", float64(compSize)/float64(decompSize))
 		StoreBloomTrieRoot(b.db, b.section, sectionHead, root)
@@ -180,7 +180,7 @@ func (pool *TxPool) checkMinedTxs(ctx context.Context, hash common.Hash, number
 	// If some transactions have been mined, write the needed data to disk and update
 	if list != nil {
 		// Retrieve all the receipts belonging to this block and write the loopup table
-		if _, err := GetBlockReceipts(ctx, pool.odr, hash, number); err != nil { // ODR caches, ignore results
+		if _, err := GetBlockReceipts(ctx, pool.odr, hash, number, pool.config); err != nil { // ODR caches, ignore results
 			return err
 		}
 		if err := core.WriteTxLookupEntries(pool.chainDb, block); err != nil {
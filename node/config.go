@@ -66,6 +66,12 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// DatabaseEngine is the name of the ethdb engine used for new persistent
+	// databases. Existing databases are always opened with the engine they were
+	// created with and refuse to open if a different one is requested. If empty,
+	// LevelDB is used for new databases.
+	DatabaseEngine string `toml:",omitempty"`
+
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
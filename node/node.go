@@ -646,7 +646,42 @@ func (n *Node) OpenDatabase(name string, cache, handles int) (ethdb.Database, er
 	if n.config.DataDir == "" {
 		return ethdb.NewMemDatabase()
 	}
-	return ethdb.NewLDBDatabase(n.config.resolvePath(name), cache, handles)
+	return ethdb.Open(n.config.DatabaseEngine, n.config.resolvePath(name), cache, handles)
+}
+
+// OpenDatabaseWithFreezer opens an existing database with the given name (or
+// creates one if no previous can be found) from within the node's instance
+// directory, also attaching a chain freezer to it that holds the ancient chain
+// data in append-only flat files. If the node is ephemeral, a memory database is
+// returned.
+func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer string) (ethdb.Database, error) {
+	if n.config.DataDir == "" {
+		return ethdb.NewMemDatabase()
+	}
+	return openDatabaseWithFreezer(n.config, name, cache, handles, freezer)
+}
+
+// openDatabaseWithFreezer opens a persistent database with a freezer attached. The
+// freezer defaults to the "ancient" folder within the database, relative paths
+// are resolved within the instance directory.
+func openDatabaseWithFreezer(config *Config, name string, cache, handles int, freezer string) (ethdb.Database, error) {
+	root := config.resolvePath(name)
+	switch {
+	case freezer == "":
+		freezer = filepath.Join(root, "ancient")
+	case !filepath.IsAbs(freezer):
+		freezer = config.resolvePath(freezer)
+	}
+	kvdb, err := ethdb.Open(config.DatabaseEngine, root, cache, handles)
+	if err != nil {
+		return nil, err
+	}
+	db, err := ethdb.NewDatabaseWithFreezer(kvdb, freezer)
+	if err != nil {
+		kvdb.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
 // ResolvePath returns the absolute path of a resource in the instance directory.
@@ -49,6 +49,28 @@ func TestClientRequest(t *testing.T) {
 	}
 }
 
+func TestClientErrorData(t *testing.T) {
+	server := newTestServer("service", new(Service))
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var resp string
+	err := client.Call(&resp, "service_returnError")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if err.Error() != "failed with data" {
+		t.Errorf("wrong error message: %q", err.Error())
+	}
+	if code := err.(Error).ErrorCode(); code != 3 {
+		t.Errorf("wrong error code: have %d, want 3", code)
+	}
+	if data := err.(DataError).ErrorData(); data != "0xbeef" {
+		t.Errorf("wrong error data: have %v, want %q", data, "0xbeef")
+	}
+}
+
 func TestClientBatchRequest(t *testing.T) {
 	server := newTestServer("service", new(Service))
 	defer server.Stop()
@@ -59,6 +59,20 @@ func (s *Service) Rets() (string, error) {
 	return "", nil
 }
 
+// dataError is an error with a custom code and additional data.
+type dataError struct {
+	message string
+	data    interface{}
+}
+
+func (e *dataError) Error() string          { return e.message }
+func (e *dataError) ErrorCode() int         { return 3 }
+func (e *dataError) ErrorData() interface{} { return e.data }
+
+func (s *Service) ReturnError() (string, error) {
+	return "", &dataError{"failed with data", "0xbeef"}
+}
+
 func (s *Service) InvalidRets1() (error, string) {
 	return nil, ""
 }
@@ -92,8 +106,8 @@ func TestServerRegisterName(t *testing.T) {
 		t.Fatalf("Expected service calc to be registered")
 	}
 
-	if len(svc.callbacks) != 5 {
-		t.Errorf("Expected 5 callbacks for service 'calc', got %d", len(svc.callbacks))
+	if len(svc.callbacks) != 6 {
+		t.Errorf("Expected 6 callbacks for service 'calc', got %d", len(svc.callbacks))
 	}
 
 	if len(svc.subscriptions) != 1 {
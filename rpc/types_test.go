@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
 )
 
@@ -64,3 +65,53 @@ func TestBlockNumberJSONUnmarshal(t *testing.T) {
 		}
 	}
 }
+
+func TestBlockNumberOrHashJSONUnmarshal(t *testing.T) {
+	hash := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+
+	tests := []struct {
+		input    string
+		mustFail bool
+		number   *BlockNumber
+		hash     *common.Hash
+	}{
+		0:  {`"0x0"`, false, newBlockNumber(0), nil},
+		1:  {`"0x12"`, false, newBlockNumber(18), nil},
+		2:  {`"latest"`, false, newBlockNumber(LatestBlockNumber), nil},
+		3:  {`"pending"`, false, newBlockNumber(PendingBlockNumber), nil},
+		4:  {`"` + hash.Hex() + `"`, false, nil, &hash},
+		5:  {`"0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdeg"`, true, nil, nil},
+		6:  {`{"blockNumber":"0x1"}`, false, newBlockNumber(1), nil},
+		7:  {`{"blockNumber":"earliest"}`, false, newBlockNumber(EarliestBlockNumber), nil},
+		8:  {`{"blockHash":"` + hash.Hex() + `"}`, false, nil, &hash},
+		9:  {`{"blockNumber":"0x1","blockHash":"` + hash.Hex() + `"}`, true, nil, nil},
+		10: {`{}`, true, nil, nil},
+		11: {`"ff"`, true, nil, nil},
+		12: {`someString`, true, nil, nil},
+	}
+	for i, test := range tests {
+		var bnh BlockNumberOrHash
+		err := json.Unmarshal([]byte(test.input), &bnh)
+		if test.mustFail && err == nil {
+			t.Errorf("Test %d should fail", i)
+			continue
+		}
+		if !test.mustFail && err != nil {
+			t.Errorf("Test %d should pass but got err: %v", i, err)
+			continue
+		}
+		if test.mustFail {
+			continue
+		}
+		if number, ok := bnh.Number(); ok != (test.number != nil) || (ok && number != *test.number) {
+			t.Errorf("Test %d got unexpected number, want %v, got %v (set: %v)", i, test.number, number, ok)
+		}
+		if hash, ok := bnh.Hash(); ok != (test.hash != nil) || (ok && hash != *test.hash) {
+			t.Errorf("Test %d got unexpected hash, want %v, got %x (set: %v)", i, test.hash, hash, ok)
+		}
+	}
+}
+
+func newBlockNumber(number BlockNumber) *BlockNumber {
+	return &number
+}
@@ -0,0 +1,183 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+// Validator is an entry of the validator pool of the validator manager contract.
+type Validator struct {
+	Index   hexutil.Uint64 `json:"index"`   // Slot of the validator in the pool
+	Address common.Address `json:"address"` // Account the validator deposited from
+	Deposit *hexutil.Big   `json:"deposit"` // Wei held in the contract for the validator
+}
+
+// PublicShardAPI provides an API to access the shard chains tracked by the
+// sharding client and to submit transactions to them.
+type PublicShardAPI struct {
+	c *Client
+}
+
+// NewPublicShardAPI creates a new shard API.
+func NewPublicShardAPI(c *Client) *PublicShardAPI {
+	return &PublicShardAPI{c}
+}
+
+// GetCollationByPeriod returns the canonical collation of a shard in the given
+// period. When fullTx is true all transactions in the collation are returned in
+// full detail, otherwise only the transaction hash is returned.
+func (api *PublicShardAPI) GetCollationByPeriod(shard, period hexutil.Uint64, fullTx bool) map[string]interface{} {
+	if collation := api.c.chain.GetCollationByPeriod(uint64(shard), uint64(period)); collation != nil {
+		return rpcOutputCollation(collation, fullTx)
+	}
+	return nil
+}
+
+// GetCollationByHash returns the collation with the given hash. When fullTx is
+// true all transactions in the collation are returned in full detail, otherwise
+// only the transaction hash is returned.
+func (api *PublicShardAPI) GetCollationByHash(hash common.Hash, fullTx bool) map[string]interface{} {
+	if collation := api.c.chain.GetCollation(hash); collation != nil {
+		return rpcOutputCollation(collation, fullTx)
+	}
+	return nil
+}
+
+// GetCollationHeader returns the header of the collation with the given hash.
+func (api *PublicShardAPI) GetCollationHeader(hash common.Hash) *shardtypes.CollationHeader {
+	if collation := api.c.chain.GetCollation(hash); collation != nil {
+		return collation.Header()
+	}
+	return nil
+}
+
+// SendTransaction submits an RLP encoded, signed transaction for inclusion into
+// a collation of the given shard and returns its hash. Transactions are only
+// accepted by proposers of the shard.
+func (api *PublicShardAPI) SendTransaction(shard hexutil.Uint64, encodedTx hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+		return common.Hash{}, err
+	}
+	if err := api.c.SendTransaction(uint64(shard), tx); err != nil {
+		return common.Hash{}, err
+	}
+	return tx.Hash(), nil
+}
+
+// ValidatorSet returns the validators currently deposited in the validator
+// manager contract.
+func (api *PublicShardAPI) ValidatorSet(ctx context.Context) ([]*Validator, error) {
+	vmc := api.c.VMC()
+	if vmc == nil {
+		return nil, errors.New("validator manager contract not available")
+	}
+	opts := api.c.CallOpts()
+	opts.Context = ctx
+
+	count, err := vmc.NumValidators(opts)
+	if err != nil {
+		return nil, err
+	}
+	validators := []*Validator{}
+	for i := int64(0); i < count.Int64(); i++ {
+		slot, err := vmc.Validators(opts, big.NewInt(i))
+		if err != nil {
+			return nil, err
+		}
+		// Withdrawn validators leave their slot empty
+		if slot.Addr == (common.Address{}) {
+			continue
+		}
+		validators = append(validators, &Validator{
+			Index:   hexutil.Uint64(i),
+			Address: slot.Addr,
+			Deposit: (*hexutil.Big)(slot.Deposit),
+		})
+	}
+	return validators, nil
+}
+
+// NewCollations sends a notification each time a collation is proposed to the
+// sharding client, either by the local proposer or by a peer.
+func (api *PublicShardAPI) NewCollations(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		proposals := make(chan ProposalEvent, 16)
+		proposalSub := api.c.SubscribeProposals(proposals)
+
+		for {
+			select {
+			case ev := <-proposals:
+				notifier.Notify(rpcSub.ID, ev.Collation.Header())
+			case <-rpcSub.Err():
+				proposalSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				proposalSub.Unsubscribe()
+				return
+			case <-proposalSub.Err():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// rpcOutputCollation converts the given collation to the RPC output, which is
+// the header JSON encoding extended with the size and transactions.
+func rpcOutputCollation(c *shardtypes.Collation, fullTx bool) map[string]interface{} {
+	header := c.Header()
+	fields := map[string]interface{}{
+		"shardId":           (*hexutil.Big)(header.ShardID),
+		"parentHash":        header.ParentHash,
+		"chunkRoot":         header.ChunkRoot,
+		"period":            (*hexutil.Big)(header.Period),
+		"proposerAddress":   header.ProposerAddress,
+		"proposerSignature": hexutil.Bytes(header.ProposerSignature),
+		"hash":              c.Hash(),
+		"size":              hexutil.Uint64(uint64(c.Size())),
+	}
+	txs := c.Transactions()
+	transactions := make([]interface{}, len(txs))
+	for i, tx := range txs {
+		if fullTx {
+			transactions[i] = tx
+		} else {
+			transactions[i] = tx.Hash()
+		}
+	}
+	fields["transactions"] = transactions
+	return fields
+}
@@ -0,0 +1,374 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package sharding implements a sharding client that bridges a running geth node
+// and the validator manager contract deployed on its chain.
+package sharding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/sharding/contracts"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+// ErrShardNotProposed is returned if a transaction is submitted to a client that
+// does not propose collations for its shard.
+var ErrShardNotProposed = errors.New("shard not proposed by this client")
+
+// recordSyncPeriods is the number of past periods whose VMC header records are
+// rechecked on every new period, to catch main chain reorganisations.
+const recordSyncPeriods = 4
+
+// Client is the sharding client service. It connects to a geth node over IPC,
+// makes sure the validator manager contract is available on its chain and
+// follows the main chain head, notifying the actor services running on top of
+// it about new periods and keeping the chain of its shard in sync with the
+// header records of the VMC.
+type Client struct {
+	config   *Config            // Sharding client configuration
+	keystore *keystore.KeyStore // Keystore holding the client account
+	account  accounts.Account   // Unlocked account signing main chain transactions
+
+	chainDb         ethdb.Database    // Database holding the shard chains
+	chain           *ShardChain       // Shard chain manager tracking canonical collations
+	txPool          *core.ShardTxPool // Pool of transactions submitted to the shards
+	protocolManager *ProtocolManager  // Shard sub-protocol gossiping collations
+
+	rpc     *rpc.Client       // Raw RPC connection to the main chain node
+	client  *ethclient.Client // Ethereum RPC client wrapping the connection
+	vmc     *contracts.VMC    // Binding to the validator manager contract
+	vmcAddr common.Address    // Address of the validator manager contract
+
+	periodFeed   event.Feed              // Feed announcing new main chain periods
+	proposalFeed event.Feed              // Feed relaying proposed collations
+	scope        event.SubscriptionScope // Tracks subscriptions to shut them down on stop
+
+	ctx    context.Context    // Context cancelled when the client is stopped
+	cancel context.CancelFunc // Cancels all pending main chain operations
+	wg     sync.WaitGroup     // Wait group tracking the event loop
+	lock   sync.Mutex         // Protects the RPC connection during startup and shutdown
+}
+
+// New creates a sharding client service connected to the geth node at the
+// configured IPC endpoint, binding to (or deploying) the validator manager
+// contract right away so the actor services can use it as soon as they start.
+// Main chain transactions are signed with the configured account, which must
+// already be unlocked in the node's keystore.
+func New(ctx *node.ServiceContext, config *Config) (*Client, error) {
+	backends := ctx.AccountManager.Backends(keystore.KeyStoreType)
+	if len(backends) == 0 {
+		return nil, errors.New("no keystore backend available")
+	}
+	ks := backends[0].(*keystore.KeyStore)
+
+	account := accounts.Account{Address: config.Account}
+	if !ks.HasAddress(account.Address) {
+		return nil, fmt.Errorf("account %x not found in keystore", account.Address)
+	}
+	chainDb, err := ctx.OpenDatabase("shardchaindata", 16, 16)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := NewShardChain(chainDb, config.Genesis)
+	if err != nil {
+		chainDb.Close()
+		return nil, err
+	}
+	cctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		config:   config,
+		keystore: ks,
+		account:  account,
+		chainDb:  chainDb,
+		chain:    chain,
+		ctx:      cctx,
+		cancel:   cancel,
+	}
+	// Connect to the main chain before any actor service starts using it
+	if err := c.connect(); err != nil {
+		c.cancel()
+		c.chain.Stop()
+		chainDb.Close()
+		c.close()
+		return nil, err
+	}
+	// Notaries subscribe to the shards they are sampled for once running
+	var shards []uint64
+	if config.Actor != NotaryActor {
+		shards = []uint64{uint64(config.ShardID)}
+	}
+	c.protocolManager = NewProtocolManager(config.NetworkId, shards, c.chain, func(collation *shardtypes.Collation) {
+		c.proposalFeed.Send(ProposalEvent{Collation: collation})
+	})
+	// Transactions are validated against the shard states derived by the chain
+	poolConfig := config.TxPool
+	if poolConfig.Journal != "" {
+		poolConfig.Journal = ctx.ResolvePath(poolConfig.Journal)
+	}
+	c.txPool = core.NewShardTxPool(poolConfig, ChainConfig, c.chain, uint64(ShardCount))
+
+	return c, nil
+}
+
+// Protocols implements node.Service, returning the P2P network protocols used
+// by the sharding client.
+func (c *Client) Protocols() []p2p.Protocol {
+	return c.protocolManager.SubProtocols
+}
+
+// APIs implements node.Service, returning the RPC APIs exposed by the sharding
+// client.
+func (c *Client) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "shard",
+			Version:   "1.0",
+			Service:   NewPublicShardAPI(c),
+			Public:    true,
+		},
+	}
+}
+
+// connect dials the main chain node and binds to (or deploys) the validator
+// manager contract.
+func (c *Client) connect() error {
+	log.Info("Connecting sharding client", "endpoint", c.config.Endpoint, "account", c.account.Address)
+
+	rpcClient, err := rpc.DialIPC(c.ctx, c.config.Endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to dial %s: %v", c.config.Endpoint, err)
+	}
+	c.lock.Lock()
+	c.rpc, c.client = rpcClient, ethclient.NewClient(rpcClient)
+	c.lock.Unlock()
+
+	addr, vmc, err := initVMC(c.ctx, c.client, c.TransactOpts(), c.config.VMCAddress)
+	if err != nil {
+		return err
+	}
+	if addr != c.config.VMCAddress {
+		log.Warn("Using newly deployed validator manager contract", "address", addr)
+	}
+	c.vmc, c.vmcAddr = vmc, addr
+	return nil
+}
+
+// Start implements node.Service, starting to follow the main chain.
+func (c *Client) Start(srvr *p2p.Server) error {
+	heads := make(chan *types.Header, 16)
+	sub, err := c.client.SubscribeNewHead(c.ctx, heads)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to chain head: %v", err)
+	}
+	c.wg.Add(1)
+	go c.loop(heads, sub)
+
+	log.Info("Sharding client started", "vmc", c.vmcAddr)
+	return nil
+}
+
+// Stop implements node.Service, terminating the sharding client, aborting any
+// pending main chain operations and closing the connection to the geth node.
+func (c *Client) Stop() error {
+	c.protocolManager.Stop()
+	c.cancel()
+	c.scope.Close()
+	c.wg.Wait()
+
+	c.txPool.Stop()
+	c.chain.Stop()
+	c.chainDb.Close()
+	c.close()
+
+	log.Info("Sharding client stopped")
+	return nil
+}
+
+// close tears down the connection to the main chain node, if any.
+func (c *Client) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.rpc != nil {
+		c.rpc.Close()
+		c.rpc = nil
+	}
+}
+
+// loop follows the main chain head, announcing new periods until the client is
+// stopped or the head subscription fails.
+func (c *Client) loop(heads chan *types.Header, sub ethereum.Subscription) {
+	defer c.wg.Done()
+	defer sub.Unsubscribe()
+
+	var period *big.Int
+	for {
+		select {
+		case head := <-heads:
+			current := new(big.Int).Div(head.Number, big.NewInt(PeriodLength))
+			if period == nil || current.Cmp(period) != 0 {
+				period = current
+				log.Info("Entered new period", "period", period, "number", head.Number, "hash", head.Hash())
+				c.syncRecords(period)
+				c.periodFeed.Send(PeriodEvent{Period: new(big.Int).Set(period), Head: head})
+			}
+		case err := <-sub.Err():
+			log.Error("Main chain head subscription failed", "err", err)
+			return
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// syncRecords feeds the VMC header records of the client's shard in the recent
+// periods into the shard chain, updating its canonical collations.
+func (c *Client) syncRecords(period *big.Int) {
+	var (
+		shard = big.NewInt(c.config.ShardID)
+		first = new(big.Int).Sub(period, big.NewInt(recordSyncPeriods))
+	)
+	if first.Sign() < 0 {
+		first.SetUint64(0)
+	}
+	for p := first; p.Cmp(period) <= 0; p = new(big.Int).Add(p, common.Big1) {
+		record, err := c.vmc.CollationRecords(c.CallOpts(), shard, p)
+		if err != nil {
+			log.Warn("Failed to retrieve collation record", "shard", shard, "period", p, "err", err)
+			return
+		}
+		var rec *CollationRecord
+		if record.Validator != (common.Address{}) {
+			rec = &CollationRecord{
+				ParentHash: record.ParentHash,
+				ChunkRoot:  record.ChunkRoot,
+				Proposer:   record.Proposer,
+				Notary:     record.Validator,
+			}
+		}
+		if err := c.chain.SetCollationRecord(shard.Uint64(), p.Uint64(), rec); err != nil {
+			log.Error("Failed to update collation record", "shard", shard, "period", p, "err", err)
+		}
+	}
+}
+
+// SubscribePeriods registers a subscription of PeriodEvent, fired whenever the
+// main chain enters a new period.
+func (c *Client) SubscribePeriods(ch chan<- PeriodEvent) event.Subscription {
+	return c.scope.Track(c.periodFeed.Subscribe(ch))
+}
+
+// SubscribeProposals registers a subscription of ProposalEvent, fired whenever
+// a collation is proposed to the client.
+func (c *Client) SubscribeProposals(ch chan<- ProposalEvent) event.Subscription {
+	return c.scope.Track(c.proposalFeed.Subscribe(ch))
+}
+
+// ProposeCollation relays a signed collation to all services subscribed to
+// collation proposals and announces it to the peers subscribed to its shard.
+// The collation must already be stored in the shard chain.
+func (c *Client) ProposeCollation(collation *shardtypes.Collation) {
+	c.proposalFeed.Send(ProposalEvent{Collation: collation})
+	c.protocolManager.BroadcastCollation(collation)
+}
+
+// SubscribeTxs registers a subscription of core.ShardTxPreEvent, fired whenever
+// a transaction of the shard transaction pool becomes executable.
+func (c *Client) SubscribeTxs(ch chan<- core.ShardTxPreEvent) event.Subscription {
+	return c.scope.Track(c.txPool.SubscribeShardTxPreEvent(ch))
+}
+
+// SendTransaction adds a signed transaction to the shard transaction pool for
+// the proposer of the given shard running on top of the client. The transaction
+// is validated against the current state of the shard and the pool limits.
+func (c *Client) SendTransaction(shard uint64, tx *types.Transaction) error {
+	if shard >= uint64(ShardCount) {
+		return core.ErrUnknownShard
+	}
+	if c.config.Actor != ProposerActor || shard != uint64(c.config.ShardID) {
+		return ErrShardNotProposed
+	}
+	return c.txPool.AddLocal(shard, tx)
+}
+
+// SubscribeShards replaces the set of shards the client receives collation
+// proposals for from the network.
+func (c *Client) SubscribeShards(shards []uint64) {
+	c.protocolManager.Subscribe(shards)
+}
+
+// Context returns the context cancelled when the client is stopped, which the
+// actor services use to bound main chain operations.
+func (c *Client) Context() context.Context { return c.ctx }
+
+func (c *Client) Config() *Config              { return c.config }
+func (c *Client) Account() accounts.Account    { return c.account }
+func (c *Client) MainChain() *ethclient.Client { return c.client }
+func (c *Client) RPC() *rpc.Client             { return c.rpc }
+func (c *Client) VMC() *contracts.VMC          { return c.vmc }
+func (c *Client) VMCAddress() common.Address   { return c.vmcAddr }
+func (c *Client) ShardChain() *ShardChain      { return c.chain }
+func (c *Client) TxPool() *core.ShardTxPool    { return c.txPool }
+
+// CallOpts creates the options for calling constant methods of the validator
+// manager contract on behalf of the client account.
+func (c *Client) CallOpts() *bind.CallOpts {
+	return &bind.CallOpts{From: c.account.Address, Context: c.ctx}
+}
+
+// TransactOpts creates the authorization data for sending main chain
+// transactions from the client account.
+func (c *Client) TransactOpts() *bind.TransactOpts {
+	return &bind.TransactOpts{
+		From: c.account.Address,
+		Signer: func(signer types.Signer, addr common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if addr != c.account.Address {
+				return nil, errors.New("not authorized to sign this account")
+			}
+			signature, err := c.keystore.SignHash(c.account, signer.Hash(tx).Bytes())
+			if err != nil {
+				return nil, err
+			}
+			return tx.WithSignature(signer, signature)
+		},
+		Context: c.ctx,
+	}
+}
+
+// SignHash signs the given hash with the client account, used for signing
+// collation headers.
+func (c *Client) SignHash(hash common.Hash) ([]byte, error) {
+	return c.keystore.SignHash(c.account, hash.Bytes())
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Protocol constants baked into the validator manager contract. These must be
+// kept in sync with contracts/validator_manager.sol.
+var (
+	ShardCount   = int64(100)                                                  // Number of shards tracked by the VMC
+	PeriodLength = int64(5)                                                    // Number of main chain blocks in a period
+	DepositSize  = new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether)) // Wei a validator has to deposit
+)
+
+// ChainConfig is the ruleset shard transactions are signed and executed with:
+// every main chain protocol change up to Byzantium, plus the sharding
+// instruction set from the first period on.
+var ChainConfig = &params.ChainConfig{
+	ChainId:        big.NewInt(1),
+	HomesteadBlock: big.NewInt(0),
+	EIP150Block:    big.NewInt(0),
+	EIP155Block:    big.NewInt(0),
+	EIP158Block:    big.NewInt(0),
+	ByzantiumBlock: big.NewInt(0),
+	ShardingBlock:  big.NewInt(0),
+}
+
+// Roles a sharding client can run in.
+const (
+	ProposerActor = "proposer" // Packs shard transactions into collations
+	NotaryActor   = "notary"   // Deposits into the VMC and submits collation headers
+	ObserverActor = "observer" // Only follows shards without taking part
+)
+
+// DefaultConfig contains the default settings for the sharding client.
+var DefaultConfig = Config{
+	Actor:     ObserverActor,
+	NetworkId: 1,
+	TxPool:    core.DefaultTxPoolConfig,
+}
+
+// Config contains the configuration options of the sharding client.
+type Config struct {
+	// Endpoint is the IPC endpoint of the main chain geth node.
+	Endpoint string
+
+	// VMCAddress is the main chain address of the validator manager contract. If
+	// no contract code is found there, a new contract is deployed on startup.
+	VMCAddress common.Address
+
+	// Account signs main chain transactions and collation headers. It must be
+	// unlocked in the keystore of the node running the client.
+	Account common.Address
+
+	// Actor is the role the client takes on, one of ProposerActor, NotaryActor
+	// and ObserverActor.
+	Actor string
+
+	// ShardID is the shard a proposer creates collations for or an observer
+	// follows. Notaries serve all shards they are sampled for.
+	ShardID int64
+
+	// NetworkId identifies the shard p2p network. Peers with a different
+	// network ID are disconnected during the handshake.
+	NetworkId uint64
+
+	// TxPool configures the pool of transactions submitted to the shards. The
+	// limits apply to every shard separately.
+	TxPool core.TxPoolConfig
+
+	// Genesis is the initial state of every shard. Shard accounts can only be
+	// funded through it, all clients of a network must use the same allocation.
+	Genesis core.GenesisAlloc
+}
@@ -0,0 +1,99 @@
+pragma solidity ^0.4.19;
+
+contract VMC {
+  struct Validator {
+    // Amount of wei the validator holds
+    uint deposit;
+    // The validator's address
+    address addr;
+  }
+
+  struct CollationRecord {
+    // Hash of the parent collation in the shard
+    bytes32 parentHash;
+    // Root of the collation body chunks
+    bytes32 chunkRoot;
+    // Address of the proposer that created the collation
+    address proposer;
+    // Address of the sampled validator that submitted the header
+    address validator;
+  }
+
+  // Validator pool, indexed by the validator index handed out on deposit
+  mapping (uint => Validator) public validators;
+  // Number of validator slots handed out so far (withdrawn slots stay empty)
+  uint public numValidators;
+  // Whether an address currently holds a validator deposit
+  mapping (address => bool) public isValidatorDeposited;
+  // Collation headers submitted for a shard, keyed by shard ID and period
+  mapping (uint => mapping (uint => CollationRecord)) public collationRecords;
+  // Last period a collation header was submitted for a shard
+  mapping (uint => uint) public lastSubmittedPeriod;
+
+  // Exact amount of wei a validator needs to deposit
+  uint constant DEPOSIT_SIZE = 100 ether;
+  // Number of main chain blocks in a period
+  uint constant PERIOD_LENGTH = 5;
+  // Number of shards tracked by the contract
+  uint constant SHARD_COUNT = 100;
+
+  // Adds the sender to the validator pool, returning its validator index.
+  function deposit() public payable returns(uint) {
+    require(!isValidatorDeposited[msg.sender]);
+    require(msg.value == DEPOSIT_SIZE);
+
+    uint index = numValidators;
+    validators[index] = Validator({
+      deposit: msg.value,
+      addr: msg.sender
+    });
+    numValidators++;
+    isValidatorDeposited[msg.sender] = true;
+
+    return index;
+  }
+
+  // Removes the sender from the validator pool and refunds its deposit.
+  function withdraw(uint _validatorIndex) public {
+    require(msg.sender == validators[_validatorIndex].addr);
+
+    uint amount = validators[_validatorIndex].deposit;
+    isValidatorDeposited[msg.sender] = false;
+    delete validators[_validatorIndex];
+
+    msg.sender.transfer(amount);
+  }
+
+  // Returns the validator eligible to submit a collation header for the given
+  // shard in the given period, or the zero address if there is none.
+  function sampleValidator(uint _shardId, uint _period) public view returns(address) {
+    require(_shardId < SHARD_COUNT);
+    require(_period <= block.number / PERIOD_LENGTH);
+
+    if (numValidators == 0) {
+      return 0x0;
+    }
+    bytes32 seed = block.blockhash(_period * PERIOD_LENGTH - 1);
+    uint index = uint(keccak256(seed, _shardId)) % numValidators;
+
+    return validators[index].addr;
+  }
+
+  // Records a collation header for the given shard in the current period. Only
+  // the sampled validator may submit, and only one header per shard per period.
+  function addHeader(uint _shardId, uint _period, bytes32 _parentHash, bytes32 _chunkRoot, address _proposer) public returns(bool) {
+    require(_period == block.number / PERIOD_LENGTH);
+    require(collationRecords[_shardId][_period].validator == 0x0);
+    require(msg.sender == sampleValidator(_shardId, _period));
+
+    collationRecords[_shardId][_period] = CollationRecord({
+      parentHash: _parentHash,
+      chunkRoot: _chunkRoot,
+      proposer: _proposer,
+      validator: msg.sender
+    });
+    lastSubmittedPeriod[_shardId] = _period;
+
+    return true;
+  }
+}
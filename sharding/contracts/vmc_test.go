@@ -0,0 +1,237 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package contracts
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var depositSize = new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))
+
+// setupVMCTest creates a blockchain simulator with a few funded accounts and
+// deploys a validator manager contract on it.
+func setupVMCTest(t *testing.T, accounts int) ([]*ecdsa.PrivateKey, *VMC, *backends.SimulatedBackend) {
+	keys := make([]*ecdsa.PrivateKey, accounts)
+	alloc := make(core.GenesisAlloc)
+	for i := 0; i < accounts; i++ {
+		keys[i], _ = crypto.GenerateKey()
+		alloc[crypto.PubkeyToAddress(keys[i].PublicKey)] = core.GenesisAccount{
+			Balance: new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether)),
+		}
+	}
+	sim := backends.NewSimulatedBackend(alloc)
+
+	_, _, vmc, err := DeployVMC(bind.NewKeyedTransactor(keys[0]), sim)
+	if err != nil {
+		t.Fatalf("Failed to deploy validator manager contract: %v", err)
+	}
+	sim.Commit()
+
+	return keys, vmc, sim
+}
+
+// depositOpts creates transaction options for depositing into the VMC.
+func depositOpts(key *ecdsa.PrivateKey, value *big.Int) *bind.TransactOpts {
+	opts := bind.NewKeyedTransactor(key)
+	opts.Value = value
+	return opts
+}
+
+// Tests that deposits are only accepted with the exact deposit size and at most
+// once per account.
+func TestDeposit(t *testing.T) {
+	keys, vmc, sim := setupVMCTest(t, 2)
+	addr := crypto.PubkeyToAddress(keys[1].PublicKey)
+
+	if _, err := vmc.Deposit(depositOpts(keys[1], big.NewInt(params.Ether))); err == nil {
+		t.Fatalf("Deposit with invalid value accepted")
+	}
+	if _, err := vmc.Deposit(depositOpts(keys[1], depositSize)); err != nil {
+		t.Fatalf("Failed to deposit: %v", err)
+	}
+	sim.Commit()
+
+	if _, err := vmc.Deposit(depositOpts(keys[1], depositSize)); err == nil {
+		t.Fatalf("Duplicate deposit accepted")
+	}
+	count, err := vmc.NumValidators(nil)
+	if err != nil {
+		t.Fatalf("Failed to retrieve validator count: %v", err)
+	}
+	if count.Cmp(big.NewInt(1)) != 0 {
+		t.Fatalf("Validator count mismatch: have %v, want %v", count, 1)
+	}
+	deposited, err := vmc.IsValidatorDeposited(nil, addr)
+	if err != nil {
+		t.Fatalf("Failed to retrieve deposit status: %v", err)
+	}
+	if !deposited {
+		t.Fatalf("Validator not marked as deposited")
+	}
+	validator, err := vmc.Validators(nil, big.NewInt(0))
+	if err != nil {
+		t.Fatalf("Failed to retrieve validator: %v", err)
+	}
+	if validator.Addr != addr {
+		t.Errorf("Validator address mismatch: have %x, want %x", validator.Addr, addr)
+	}
+	if validator.Deposit.Cmp(depositSize) != 0 {
+		t.Errorf("Validator deposit mismatch: have %v, want %v", validator.Deposit, depositSize)
+	}
+}
+
+// Tests that only the owner of a validator slot can withdraw it, and that the
+// deposit is refunded on withdrawal.
+func TestWithdraw(t *testing.T) {
+	keys, vmc, sim := setupVMCTest(t, 2)
+	addr := crypto.PubkeyToAddress(keys[1].PublicKey)
+
+	if _, err := vmc.Deposit(depositOpts(keys[1], depositSize)); err != nil {
+		t.Fatalf("Failed to deposit: %v", err)
+	}
+	sim.Commit()
+
+	if _, err := vmc.Withdraw(bind.NewKeyedTransactor(keys[0]), big.NewInt(0)); err == nil {
+		t.Fatalf("Withdrawal by non-owner accepted")
+	}
+	before, _ := sim.BalanceAt(context.Background(), addr, nil)
+	if _, err := vmc.Withdraw(bind.NewKeyedTransactor(keys[1]), big.NewInt(0)); err != nil {
+		t.Fatalf("Failed to withdraw: %v", err)
+	}
+	sim.Commit()
+
+	after, _ := sim.BalanceAt(context.Background(), addr, nil)
+	if gained := new(big.Int).Sub(after, before); gained.Cmp(new(big.Int).Sub(depositSize, big.NewInt(params.Ether))) < 0 {
+		t.Errorf("Deposit not refunded: balance gained %v", gained)
+	}
+	deposited, err := vmc.IsValidatorDeposited(nil, addr)
+	if err != nil {
+		t.Fatalf("Failed to retrieve deposit status: %v", err)
+	}
+	if deposited {
+		t.Errorf("Validator still marked as deposited")
+	}
+	validator, err := vmc.Validators(nil, big.NewInt(0))
+	if err != nil {
+		t.Fatalf("Failed to retrieve validator: %v", err)
+	}
+	if validator.Addr != (common.Address{}) || validator.Deposit.Sign() != 0 {
+		t.Errorf("Validator slot not cleared: %+v", validator)
+	}
+}
+
+// Tests that validator sampling returns nobody for an empty pool and a member
+// of the pool otherwise.
+func TestSampleValidator(t *testing.T) {
+	keys, vmc, sim := setupVMCTest(t, 3)
+
+	// Mine the first period so it can be sampled (deployment was block 1)
+	for i := 0; i < 5; i++ {
+		sim.Commit()
+	}
+	sampled, err := vmc.SampleValidator(nil, big.NewInt(0), big.NewInt(1))
+	if err != nil {
+		t.Fatalf("Failed to sample validator: %v", err)
+	}
+	if sampled != (common.Address{}) {
+		t.Fatalf("Validator sampled from empty pool: %x", sampled)
+	}
+	pool := make(map[common.Address]bool)
+	for _, key := range keys[1:] {
+		if _, err := vmc.Deposit(depositOpts(key, depositSize)); err != nil {
+			t.Fatalf("Failed to deposit: %v", err)
+		}
+		pool[crypto.PubkeyToAddress(key.PublicKey)] = true
+	}
+	sim.Commit()
+
+	for shard := int64(0); shard < 10; shard++ {
+		sampled, err := vmc.SampleValidator(nil, big.NewInt(shard), big.NewInt(1))
+		if err != nil {
+			t.Fatalf("Failed to sample validator for shard %d: %v", shard, err)
+		}
+		if !pool[sampled] {
+			t.Errorf("Sampled validator for shard %d not in pool: %x", shard, sampled)
+		}
+	}
+	if _, err := vmc.SampleValidator(nil, big.NewInt(100), big.NewInt(1)); err == nil {
+		t.Errorf("Sampling for out of range shard succeeded")
+	}
+	if _, err := vmc.SampleValidator(nil, big.NewInt(0), big.NewInt(100)); err == nil {
+		t.Errorf("Sampling for future period succeeded")
+	}
+}
+
+// Tests that collation headers can only be submitted by the sampled validator,
+// once per shard and period.
+func TestAddHeader(t *testing.T) {
+	keys, vmc, sim := setupVMCTest(t, 2)
+	validator := crypto.PubkeyToAddress(keys[1].PublicKey)
+
+	if _, err := vmc.Deposit(depositOpts(keys[1], depositSize)); err != nil {
+		t.Fatalf("Failed to deposit: %v", err)
+	}
+	sim.Commit()
+
+	// Mine up to block 9, so that the next pending block is the first of period 2
+	for i := 0; i < 7; i++ {
+		sim.Commit()
+	}
+	period := big.NewInt(2)
+
+	var (
+		shard     = big.NewInt(1)
+		parent    = common.HexToHash("0x01")
+		chunkRoot = common.HexToHash("0x02")
+		proposer  = common.HexToAddress("0x03")
+	)
+	if _, err := vmc.AddHeader(bind.NewKeyedTransactor(keys[0]), shard, period, parent, chunkRoot, proposer); err == nil {
+		t.Fatalf("Header submission by non-sampled account accepted")
+	}
+	if _, err := vmc.AddHeader(bind.NewKeyedTransactor(keys[1]), shard, period, parent, chunkRoot, proposer); err != nil {
+		t.Fatalf("Failed to add header: %v", err)
+	}
+	sim.Commit()
+
+	if _, err := vmc.AddHeader(bind.NewKeyedTransactor(keys[1]), shard, period, parent, chunkRoot, proposer); err == nil {
+		t.Fatalf("Duplicate header submission accepted")
+	}
+	record, err := vmc.CollationRecords(nil, shard, period)
+	if err != nil {
+		t.Fatalf("Failed to retrieve collation record: %v", err)
+	}
+	if record.ParentHash != parent || record.ChunkRoot != chunkRoot || record.Proposer != proposer || record.Validator != validator {
+		t.Errorf("Collation record mismatch: have %+v", record)
+	}
+	last, err := vmc.LastSubmittedPeriod(nil, shard)
+	if err != nil {
+		t.Fatalf("Failed to retrieve last submitted period: %v", err)
+	}
+	if last.Cmp(period) != 0 {
+		t.Errorf("Last submitted period mismatch: have %v, want %v", last, period)
+	}
+}
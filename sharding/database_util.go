@@ -0,0 +1,289 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+var (
+	// Data item prefixes of the shard chain database.
+	collationHeaderPrefix    = []byte("ch") // collationHeaderPrefix + hash -> collation header
+	collationBodyPrefix      = []byte("cb") // collationBodyPrefix + hash -> collation transactions
+	sigHashPrefix            = []byte("cs") // sigHashPrefix + signing hash -> collation hash
+	chunkRootPrefix          = []byte("cr") // chunkRootPrefix + chunk root -> hash of a collation with that body
+	canonicalCollationPrefix = []byte("cc") // canonicalCollationPrefix + shard (uint64 big endian) + period (uint64 big endian) -> hash
+	collationRecordPrefix    = []byte("cv") // collationRecordPrefix + shard (uint64 big endian) + period (uint64 big endian) -> VMC record
+	headCollationPrefix      = []byte("cH") // headCollationPrefix + shard (uint64 big endian) -> head collation hash
+	collationStatePrefix     = []byte("cS") // collationStatePrefix + hash -> root of the shard state after the collation
+)
+
+// CollationRecord is a collation header record as stored in the validator
+// manager contract, which decides the canonical collation of a shard period.
+type CollationRecord struct {
+	ParentHash common.Hash
+	ChunkRoot  common.Hash
+	Proposer   common.Address
+	Notary     common.Address
+}
+
+// SigHash returns the signing hash of the collation header the record refers
+// to. As the VMC stores every signed header field, this identifies the recorded
+// collation without knowing its proposer signature.
+func (r *CollationRecord) SigHash(shard, period uint64) common.Hash {
+	header := &shardtypes.CollationHeader{
+		ShardID:         new(big.Int).SetUint64(shard),
+		ParentHash:      r.ParentHash,
+		ChunkRoot:       r.ChunkRoot,
+		Period:          new(big.Int).SetUint64(period),
+		ProposerAddress: r.Proposer,
+	}
+	return header.SigHash()
+}
+
+// encodeUint64 encodes a shard ID or period number as big endian uint64.
+func encodeUint64(number uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, number)
+	return enc
+}
+
+func shardPeriodKey(prefix []byte, shard, period uint64) []byte {
+	return append(append(append([]byte{}, prefix...), encodeUint64(shard)...), encodeUint64(period)...)
+}
+
+// GetCollationHeader retrieves the collation header corresponding to the hash,
+// nil if none found.
+func GetCollationHeader(db core.DatabaseReader, hash common.Hash) *shardtypes.CollationHeader {
+	data, _ := db.Get(append(collationHeaderPrefix, hash.Bytes()...))
+	if len(data) == 0 {
+		return nil
+	}
+	header := new(shardtypes.CollationHeader)
+	if err := rlp.Decode(bytes.NewReader(data), header); err != nil {
+		log.Error("Invalid collation header RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return header
+}
+
+// GetCollationBody retrieves the transactions of the collation corresponding
+// to the hash, nil if none found.
+func GetCollationBody(db core.DatabaseReader, hash common.Hash) types.Transactions {
+	data, _ := db.Get(append(collationBodyPrefix, hash.Bytes()...))
+	if len(data) == 0 {
+		return nil
+	}
+	var txs types.Transactions
+	if err := rlp.Decode(bytes.NewReader(data), &txs); err != nil {
+		log.Error("Invalid collation body RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return txs
+}
+
+// GetCollation retrieves an entire collation corresponding to the hash,
+// assembling it back from the stored header and body. If either the header or
+// body could not be retrieved nil is returned.
+func GetCollation(db core.DatabaseReader, hash common.Hash) *shardtypes.Collation {
+	header := GetCollationHeader(db, hash)
+	if header == nil {
+		return nil
+	}
+	data, _ := db.Get(append(collationBodyPrefix, hash.Bytes()...))
+	if len(data) == 0 {
+		return nil
+	}
+	return shardtypes.NewCollationWithHeader(header).WithBody(GetCollationBody(db, hash))
+}
+
+// GetCollationHashBySigHash retrieves the hash of the last stored collation
+// with the given header signing hash, if any.
+func GetCollationHashBySigHash(db core.DatabaseReader, sigHash common.Hash) common.Hash {
+	data, _ := db.Get(append(sigHashPrefix, sigHash.Bytes()...))
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// GetCollationHashByChunkRoot retrieves the hash of the last stored collation
+// with the given chunk root, if any. As the chunk root commits to the body,
+// all such collations carry the same transactions.
+func GetCollationHashByChunkRoot(db core.DatabaseReader, chunkRoot common.Hash) common.Hash {
+	data, _ := db.Get(append(chunkRootPrefix, chunkRoot.Bytes()...))
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// GetCanonicalCollationHash retrieves the hash of the canonical collation of a
+// shard in the given period.
+func GetCanonicalCollationHash(db core.DatabaseReader, shard, period uint64) common.Hash {
+	data, _ := db.Get(shardPeriodKey(canonicalCollationPrefix, shard, period))
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// GetCollationByPeriod retrieves the canonical collation of a shard in the
+// given period, nil if none found.
+func GetCollationByPeriod(db core.DatabaseReader, shard, period uint64) *shardtypes.Collation {
+	hash := GetCanonicalCollationHash(db, shard, period)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return GetCollation(db, hash)
+}
+
+// GetCollationRecord retrieves the VMC header record of a shard period, nil if
+// none found.
+func GetCollationRecord(db core.DatabaseReader, shard, period uint64) *CollationRecord {
+	data, _ := db.Get(shardPeriodKey(collationRecordPrefix, shard, period))
+	if len(data) == 0 {
+		return nil
+	}
+	record := new(CollationRecord)
+	if err := rlp.Decode(bytes.NewReader(data), record); err != nil {
+		log.Error("Invalid collation record RLP", "shard", shard, "period", period, "err", err)
+		return nil
+	}
+	return record
+}
+
+// GetHeadCollationHash retrieves the hash of the current canonical head
+// collation of a shard.
+func GetHeadCollationHash(db core.DatabaseReader, shard uint64) common.Hash {
+	data, _ := db.Get(append(headCollationPrefix, encodeUint64(shard)...))
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// GetCollationStateRoot retrieves the root of the shard state resulting from
+// executing a collation, if it was executed already.
+func GetCollationStateRoot(db core.DatabaseReader, hash common.Hash) common.Hash {
+	data, _ := db.Get(append(collationStatePrefix, hash.Bytes()...))
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteCollation serializes a collation into the database, header and body
+// separately, and indexes it by its header signing hash and chunk root.
+func WriteCollation(db ethdb.Putter, collation *shardtypes.Collation) error {
+	hash := collation.Hash().Bytes()
+
+	// Store the body first to retain database consistency
+	body, err := rlp.EncodeToBytes(collation.Transactions())
+	if err != nil {
+		return err
+	}
+	if err := db.Put(append(collationBodyPrefix, hash...), body); err != nil {
+		log.Crit("Failed to store collation body", "err", err)
+	}
+	// Store the header too, signaling full collation ownership
+	header, err := rlp.EncodeToBytes(collation.Header())
+	if err != nil {
+		return err
+	}
+	if err := db.Put(append(collationHeaderPrefix, hash...), header); err != nil {
+		log.Crit("Failed to store collation header", "err", err)
+	}
+	if err := db.Put(append(sigHashPrefix, collation.Header().SigHash().Bytes()...), hash); err != nil {
+		log.Crit("Failed to store signing hash to hash mapping", "err", err)
+	}
+	if err := db.Put(append(chunkRootPrefix, collation.ChunkRoot().Bytes()...), hash); err != nil {
+		log.Crit("Failed to store chunk root to hash mapping", "err", err)
+	}
+	return nil
+}
+
+// WriteCanonicalCollationHash stores the canonical collation hash of a shard
+// period.
+func WriteCanonicalCollationHash(db ethdb.Putter, shard, period uint64, hash common.Hash) error {
+	if err := db.Put(shardPeriodKey(canonicalCollationPrefix, shard, period), hash.Bytes()); err != nil {
+		log.Crit("Failed to store period to collation hash mapping", "err", err)
+	}
+	return nil
+}
+
+// WriteCollationRecord stores the VMC header record of a shard period.
+func WriteCollationRecord(db ethdb.Putter, shard, period uint64, record *CollationRecord) error {
+	data, err := rlp.EncodeToBytes(record)
+	if err != nil {
+		return err
+	}
+	if err := db.Put(shardPeriodKey(collationRecordPrefix, shard, period), data); err != nil {
+		log.Crit("Failed to store collation record", "err", err)
+	}
+	return nil
+}
+
+// WriteHeadCollationHash stores the hash of a shard's head collation.
+func WriteHeadCollationHash(db ethdb.Putter, shard uint64, hash common.Hash) error {
+	if err := db.Put(append(headCollationPrefix, encodeUint64(shard)...), hash.Bytes()); err != nil {
+		log.Crit("Failed to store last collation's hash", "err", err)
+	}
+	return nil
+}
+
+// WriteCollationStateRoot stores the root of the shard state resulting from
+// executing a collation.
+func WriteCollationStateRoot(db ethdb.Putter, hash common.Hash, root common.Hash) error {
+	if err := db.Put(append(collationStatePrefix, hash.Bytes()...), root.Bytes()); err != nil {
+		log.Crit("Failed to store collation state root", "err", err)
+	}
+	return nil
+}
+
+// DeleteHeadCollationHash removes the head collation hash of a shard.
+func DeleteHeadCollationHash(db core.DatabaseDeleter, shard uint64) {
+	db.Delete(append(headCollationPrefix, encodeUint64(shard)...))
+}
+
+// DeleteCollation removes all collation data associated with a hash.
+func DeleteCollation(db core.DatabaseDeleter, hash common.Hash) {
+	db.Delete(append(collationHeaderPrefix, hash.Bytes()...))
+	db.Delete(append(collationBodyPrefix, hash.Bytes()...))
+	db.Delete(append(collationStatePrefix, hash.Bytes()...))
+}
+
+// DeleteCanonicalCollationHash removes the canonical collation hash of a shard
+// period.
+func DeleteCanonicalCollationHash(db core.DatabaseDeleter, shard, period uint64) {
+	db.Delete(shardPeriodKey(canonicalCollationPrefix, shard, period))
+}
+
+// DeleteCollationRecord removes the VMC header record of a shard period.
+func DeleteCollationRecord(db core.DatabaseDeleter, shard, period uint64) {
+	db.Delete(shardPeriodKey(collationRecordPrefix, shard, period))
+}
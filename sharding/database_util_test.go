@@ -0,0 +1,138 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+// newTestCollation creates a collation signed by the test key.
+func newTestCollation(t *testing.T, shard, period uint64, parent common.Hash, txs []*types.Transaction) *shardtypes.Collation {
+	collation, err := shardtypes.NewCollation(&shardtypes.CollationHeader{
+		ShardID:    new(big.Int).SetUint64(shard),
+		ParentHash: parent,
+		Period:     new(big.Int).SetUint64(period),
+	}, txs).WithSignature(testKey)
+	if err != nil {
+		t.Fatalf("Failed to sign collation: %v", err)
+	}
+	return collation
+}
+
+// Tests collation storage and retrieval operations.
+func TestCollationStorage(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	tx := types.NewTransaction(1, common.HexToAddress("0x01"), big.NewInt(1), 21000, big.NewInt(1), nil)
+	collation := newTestCollation(t, 1, 2, common.Hash{}, []*types.Transaction{tx})
+
+	if entry := GetCollation(db, collation.Hash()); entry != nil {
+		t.Fatalf("Non existent collation returned: %v", entry)
+	}
+	if err := WriteCollation(db, collation); err != nil {
+		t.Fatalf("Failed to write collation into database: %v", err)
+	}
+	entry := GetCollation(db, collation.Hash())
+	if entry == nil {
+		t.Fatalf("Stored collation not found")
+	}
+	if entry.Hash() != collation.Hash() {
+		t.Fatalf("Retrieved collation mismatch: have %x, want %x", entry.Hash(), collation.Hash())
+	}
+	if txs := entry.Transactions(); len(txs) != 1 || txs[0].Hash() != tx.Hash() {
+		t.Fatalf("Retrieved transactions mismatch: have %v, want %v", txs, []*types.Transaction{tx})
+	}
+	if hash := GetCollationHashBySigHash(db, collation.Header().SigHash()); hash != collation.Hash() {
+		t.Fatalf("Signing hash lookup mismatch: have %x, want %x", hash, collation.Hash())
+	}
+	if hash := GetCollationHashByChunkRoot(db, collation.ChunkRoot()); hash != collation.Hash() {
+		t.Fatalf("Chunk root lookup mismatch: have %x, want %x", hash, collation.Hash())
+	}
+	// Delete the collation and verify the execution
+	DeleteCollation(db, collation.Hash())
+	if entry := GetCollation(db, collation.Hash()); entry != nil {
+		t.Fatalf("Deleted collation returned: %v", entry)
+	}
+}
+
+// Tests that canonical collations can be mapped to shard periods and retrieved.
+func TestCanonicalCollationStorage(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	collation := newTestCollation(t, 3, 7, common.Hash{}, nil)
+
+	if err := WriteCollation(db, collation); err != nil {
+		t.Fatalf("Failed to write collation into database: %v", err)
+	}
+	if entry := GetCollationByPeriod(db, 3, 7); entry != nil {
+		t.Fatalf("Non existent canonical collation returned: %v", entry)
+	}
+	if err := WriteCanonicalCollationHash(db, 3, 7, collation.Hash()); err != nil {
+		t.Fatalf("Failed to write canonical mapping into database: %v", err)
+	}
+	if entry := GetCollationByPeriod(db, 3, 7); entry == nil || entry.Hash() != collation.Hash() {
+		t.Fatalf("Retrieved canonical collation mismatch: have %v, want %x", entry, collation.Hash())
+	}
+	// Mappings must not leak into other shards or periods
+	if hash := GetCanonicalCollationHash(db, 7, 3); hash != (common.Hash{}) {
+		t.Fatalf("Canonical hash leaked into other shard: %x", hash)
+	}
+	DeleteCanonicalCollationHash(db, 3, 7)
+	if hash := GetCanonicalCollationHash(db, 3, 7); hash != (common.Hash{}) {
+		t.Fatalf("Deleted canonical hash returned: %x", hash)
+	}
+}
+
+// Tests that VMC records and shard heads can be stored and retrieved.
+func TestRecordAndHeadStorage(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	record := &CollationRecord{
+		ParentHash: common.HexToHash("0x01"),
+		ChunkRoot:  common.HexToHash("0x02"),
+		Proposer:   common.HexToAddress("0x03"),
+		Notary:     common.HexToAddress("0x04"),
+	}
+	if entry := GetCollationRecord(db, 1, 1); entry != nil {
+		t.Fatalf("Non existent record returned: %v", entry)
+	}
+	if err := WriteCollationRecord(db, 1, 1, record); err != nil {
+		t.Fatalf("Failed to write record into database: %v", err)
+	}
+	if entry := GetCollationRecord(db, 1, 1); entry == nil || *entry != *record {
+		t.Fatalf("Retrieved record mismatch: have %v, want %v", entry, record)
+	}
+	DeleteCollationRecord(db, 1, 1)
+	if entry := GetCollationRecord(db, 1, 1); entry != nil {
+		t.Fatalf("Deleted record returned: %v", entry)
+	}
+	hash := common.HexToHash("0x05")
+	if err := WriteHeadCollationHash(db, 1, hash); err != nil {
+		t.Fatalf("Failed to write head hash into database: %v", err)
+	}
+	if head := GetHeadCollationHash(db, 1); head != hash {
+		t.Fatalf("Head hash mismatch: have %x, want %x", head, hash)
+	}
+	if head := GetHeadCollationHash(db, 2); head != (common.Hash{}) {
+		t.Fatalf("Head hash leaked into other shard: %x", head)
+	}
+}
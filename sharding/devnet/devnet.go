@@ -0,0 +1,378 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package devnet implements a local sharding development network, running a
+// clique main chain with the validator manager contract in its genesis block
+// and a set of sharding actors connected to it and to each other, all within a
+// single process.
+package devnet
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/sharding"
+	"github.com/ethereum/go-ethereum/sharding/contracts"
+	"github.com/ethereum/go-ethereum/sharding/notary"
+	"github.com/ethereum/go-ethereum/sharding/observer"
+	"github.com/ethereum/go-ethereum/sharding/proposer"
+)
+
+// VMCAddress is the address the validator manager contract is allocated at in
+// the genesis block of the devnet.
+var VMCAddress = common.HexToAddress("0x000000000000000000000000000000000000c0de")
+
+// accountBalance is the amount of wei every sharding actor is funded with on the
+// main chain and on every shard, large enough for a notary deposit and plenty of
+// transactions.
+var accountBalance = new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether))
+
+// Config contains the settings of a sharding devnet.
+type Config struct {
+	// DataDir is the root directory of all devnet nodes. If empty, a temporary
+	// directory is used and removed when the devnet is stopped.
+	DataDir string
+
+	// Period is the main chain block period in seconds. Sharding periods only
+	// advance with new blocks, so it must be positive.
+	Period uint64
+
+	// Number of sharding actors to launch in each role.
+	Proposers int
+	Notaries  int
+	Observers int
+
+	// ShardID is the shard the proposers and observers work on.
+	ShardID int64
+
+	// HTTPPort is the HTTP-RPC port of the main chain node, with the actors
+	// listening on the subsequent ports. Zero disables HTTP-RPC.
+	HTTPPort int
+
+	// ShardAlloc funds additional accounts on every shard. The accounts of the
+	// sharding actors are always funded.
+	ShardAlloc core.GenesisAlloc
+}
+
+// DefaultConfig contains the default settings of a sharding devnet.
+var DefaultConfig = Config{
+	Period:    1,
+	Proposers: 1,
+	Notaries:  1,
+}
+
+// Actor is a sharding client running in the devnet.
+type Actor struct {
+	Role    string         // Role the client was launched in
+	Account common.Address // Funded account of the client
+	Node    *node.Node     // Protocol stack running the client
+}
+
+// Client retrieves the sharding client service of the actor, nil if the actor
+// is not running.
+func (a *Actor) Client() *sharding.Client {
+	var client *sharding.Client
+	if err := a.Node.Service(&client); err != nil {
+		return nil
+	}
+	return client
+}
+
+// Devnet is a sharding development network.
+type Devnet struct {
+	config  *Config
+	datadir string // Root directory of the nodes
+	temp    bool   // Whether the root directory is removed on stop
+
+	Main   *node.Node // Main chain node, sealing the clique chain
+	Actors []*Actor   // Sharding clients connected to the main chain
+}
+
+// New assembles a sharding devnet: it creates the protocol stacks and funded
+// accounts of all nodes and the genesis block of the main chain, but does not
+// start anything yet.
+func New(config *Config) (*Devnet, error) {
+	if config.Period == 0 {
+		return nil, errors.New("devnet block period must be positive")
+	}
+	if config.ShardID < 0 || config.ShardID >= sharding.ShardCount {
+		return nil, fmt.Errorf("invalid shard %d, must be below %d", config.ShardID, sharding.ShardCount)
+	}
+	d := &Devnet{config: config, datadir: config.DataDir}
+	if d.datadir == "" {
+		dir, err := ioutil.TempDir("", "sharding-devnet-")
+		if err != nil {
+			return nil, err
+		}
+		d.datadir, d.temp = dir, true
+	}
+	// Create the sharding actors first, their accounts need funding in genesis
+	roles := []struct {
+		role  string
+		count int
+	}{
+		{sharding.ProposerActor, config.Proposers},
+		{sharding.NotaryActor, config.Notaries},
+		{sharding.ObserverActor, config.Observers},
+	}
+	for _, r := range roles {
+		for i := 0; i < r.count; i++ {
+			actor, err := d.newActor(r.role, i)
+			if err != nil {
+				d.cleanup()
+				return nil, err
+			}
+			d.Actors = append(d.Actors, actor)
+		}
+	}
+	if err := d.newMain(); err != nil {
+		d.cleanup()
+		return nil, err
+	}
+	return d, nil
+}
+
+// httpConfig enables HTTP-RPC on the given offset from the configured port.
+func (d *Devnet) httpConfig(cfg *node.Config, offset int) {
+	if d.config.HTTPPort == 0 {
+		return
+	}
+	cfg.HTTPHost = "127.0.0.1"
+	cfg.HTTPPort = d.config.HTTPPort + offset
+	cfg.HTTPModules = []string{"eth", "net", "web3", "shard"}
+}
+
+// newActor creates the protocol stack and funded account of a sharding client.
+func (d *Devnet) newActor(role string, index int) (*Actor, error) {
+	cfg := &node.Config{
+		Name:              "sharding",
+		DataDir:           filepath.Join(d.datadir, fmt.Sprintf("%s-%d", role, index)),
+		IPCPath:           "sharding.ipc",
+		UseLightweightKDF: true,
+		P2P: p2p.Config{
+			ListenAddr:  "127.0.0.1:0",
+			MaxPeers:    25,
+			NoDiscovery: true,
+		},
+	}
+	d.httpConfig(cfg, len(d.Actors)+1)
+
+	stack, err := node.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	account, err := devAccount(stack)
+	if err != nil {
+		return nil, err
+	}
+	config := sharding.DefaultConfig
+	config.VMCAddress = VMCAddress
+	config.Account = account
+	config.Actor = role
+	config.ShardID = d.config.ShardID
+
+	err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		// The main chain endpoint and the other actors are only known once the
+		// devnet is assembled
+		config.Endpoint = d.Main.IPCEndpoint()
+		config.Genesis = d.shardGenesis()
+		return sharding.New(ctx, &config)
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch role {
+	case sharding.ProposerActor:
+		err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+			return proposer.New(ctx, &config)
+		})
+	case sharding.NotaryActor:
+		err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+			return notary.New(ctx, &config)
+		})
+	case sharding.ObserverActor:
+		err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+			return observer.New(ctx, &config)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Actor{Role: role, Account: account, Node: stack}, nil
+}
+
+// shardGenesis returns the initial state of the devnet shards, funding all the
+// sharding actors and the configured additional accounts.
+func (d *Devnet) shardGenesis() core.GenesisAlloc {
+	alloc := make(core.GenesisAlloc)
+	for addr, account := range d.config.ShardAlloc {
+		alloc[addr] = account
+	}
+	for _, actor := range d.Actors {
+		alloc[actor.Account] = core.GenesisAccount{Balance: accountBalance}
+	}
+	return alloc
+}
+
+// newMain creates the main chain node, sealing a clique chain that allocates
+// the validator manager contract and funds all sharding actors.
+func (d *Devnet) newMain() error {
+	cfg := &node.Config{
+		Name:              "geth",
+		DataDir:           filepath.Join(d.datadir, "main"),
+		IPCPath:           "geth.ipc",
+		UseLightweightKDF: true,
+		P2P: p2p.Config{
+			MaxPeers:    0,
+			NoDiscovery: true,
+		},
+	}
+	d.httpConfig(cfg, 0)
+
+	stack, err := node.New(cfg)
+	if err != nil {
+		return err
+	}
+	developer, err := devAccount(stack)
+	if err != nil {
+		return err
+	}
+	accounts := make([]common.Address, len(d.Actors))
+	for i, actor := range d.Actors {
+		accounts[i] = actor.Account
+	}
+	genesis, err := Genesis(d.config.Period, developer, accounts)
+	if err != nil {
+		return err
+	}
+	config := eth.DefaultConfig
+	config.Genesis = genesis
+	config.Etherbase = developer
+	config.GasPrice = big.NewInt(1)
+
+	err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		return eth.New(ctx, &config)
+	})
+	if err != nil {
+		return err
+	}
+	d.Main = stack
+	return nil
+}
+
+// Start boots the main chain node and starts sealing blocks, then launches the
+// sharding actors and connects them to each other.
+func (d *Devnet) Start() error {
+	if err := d.Main.Start(); err != nil {
+		return fmt.Errorf("failed to start main chain node: %v", err)
+	}
+	var ethereum *eth.Ethereum
+	if err := d.Main.Service(&ethereum); err != nil {
+		return err
+	}
+	if err := ethereum.StartMining(true); err != nil {
+		return fmt.Errorf("failed to start mining: %v", err)
+	}
+	log.Info("Started devnet main chain", "ipc", d.Main.IPCEndpoint(), "http", d.Main.HTTPEndpoint())
+
+	for i, actor := range d.Actors {
+		if err := actor.Node.Start(); err != nil {
+			return fmt.Errorf("failed to start %s: %v", actor.Role, err)
+		}
+		// Connect to all previously started actors
+		for _, peer := range d.Actors[:i] {
+			actor.Node.Server().AddPeer(peer.Node.Server().Self())
+		}
+		log.Info("Started devnet sharding actor", "role", actor.Role, "account", actor.Account,
+			"ipc", actor.Node.IPCEndpoint(), "http", actor.Node.HTTPEndpoint())
+	}
+	return nil
+}
+
+// Stop terminates all running nodes of the devnet and, if the data directory
+// was temporary, removes it.
+func (d *Devnet) Stop() {
+	for _, actor := range d.Actors {
+		actor.Node.Stop()
+	}
+	d.Main.Stop()
+	d.cleanup()
+}
+
+// cleanup removes the data directory if it was temporary.
+func (d *Devnet) cleanup() {
+	if d.temp {
+		os.RemoveAll(d.datadir)
+	}
+}
+
+// devAccount reuses or creates the first account in the keystore of a node and
+// unlocks it with an empty password.
+func devAccount(stack *node.Node) (common.Address, error) {
+	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+
+	accs := ks.Accounts()
+	if len(accs) == 0 {
+		acc, err := ks.NewAccount("")
+		if err != nil {
+			return common.Address{}, fmt.Errorf("failed to create account: %v", err)
+		}
+		accs = append(accs, acc)
+	}
+	if err := ks.Unlock(accs[0], ""); err != nil {
+		return common.Address{}, fmt.Errorf("failed to unlock account: %v", err)
+	}
+	return accs[0].Address, nil
+}
+
+// Genesis returns the genesis block of a devnet main chain: the developer
+// genesis block sealed by the faucet account, with the validator manager
+// contract allocated at VMCAddress and the given accounts funded.
+func Genesis(period uint64, faucet common.Address, accounts []common.Address) (*core.Genesis, error) {
+	code, err := vmcCode()
+	if err != nil {
+		return nil, err
+	}
+	genesis := core.DeveloperGenesisBlock(period, faucet)
+	genesis.Alloc[VMCAddress] = core.GenesisAccount{Code: code, Balance: new(big.Int)}
+	for _, account := range accounts {
+		genesis.Alloc[account] = core.GenesisAccount{Balance: accountBalance}
+	}
+	return genesis, nil
+}
+
+// vmcCode returns the runtime code of the validator manager contract, obtained
+// by running its deployment code.
+func vmcCode() ([]byte, error) {
+	code, _, _, err := runtime.Create(common.FromHex(contracts.VMCBin), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VMC code: %v", err)
+	}
+	return code, nil
+}
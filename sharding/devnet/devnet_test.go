@@ -0,0 +1,82 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package devnet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/sharding"
+)
+
+// Tests that the genesis block of a devnet carries the validator manager
+// contract and funds all sharding actors.
+func TestGenesis(t *testing.T) {
+	var (
+		faucet   = common.HexToAddress("0x01")
+		accounts = []common.Address{common.HexToAddress("0x02"), common.HexToAddress("0x03")}
+	)
+	genesis, err := Genesis(1, faucet, accounts)
+	if err != nil {
+		t.Fatalf("Failed to create genesis: %v", err)
+	}
+	if code := genesis.Alloc[VMCAddress].Code; len(code) == 0 {
+		t.Fatalf("Validator manager contract missing from genesis")
+	}
+	for _, account := range accounts {
+		if balance := genesis.Alloc[account].Balance; balance == nil || balance.Cmp(sharding.DepositSize) <= 0 {
+			t.Errorf("Account %x underfunded: have %v", account, balance)
+		}
+	}
+	if genesis.Config.Clique == nil || genesis.Config.Clique.Period != 1 {
+		t.Errorf("Clique period mismatch: have %+v", genesis.Config.Clique)
+	}
+}
+
+// Tests that a devnet with a proposer and a notary extends the shard chain with
+// collations recorded in the validator manager contract.
+func TestDevnet(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping devnet test in short mode")
+	}
+	net, err := New(&DefaultConfig)
+	if err != nil {
+		t.Fatalf("Failed to create devnet: %v", err)
+	}
+	if err := net.Start(); err != nil {
+		net.Stop()
+		t.Fatalf("Failed to start devnet: %v", err)
+	}
+	defer net.Stop()
+
+	proposer := net.Actors[0]
+	if proposer.Role != sharding.ProposerActor {
+		t.Fatalf("First actor role mismatch: have %s, want %s", proposer.Role, sharding.ProposerActor)
+	}
+	timeout := time.After(90 * time.Second)
+	for {
+		if proposer.Client().ShardChain().CurrentCollation(uint64(DefaultConfig.ShardID)) != nil {
+			return
+		}
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-timeout:
+			t.Fatalf("Timed out waiting for a canonical collation")
+		}
+	}
+}
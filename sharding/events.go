@@ -0,0 +1,43 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+// PeriodEvent is posted when the main chain enters a new period.
+type PeriodEvent struct {
+	Period *big.Int      // Number of the period just entered
+	Head   *types.Header // Main chain head that started the period
+}
+
+// ProposalEvent is posted when a collation is proposed to the client.
+type ProposalEvent struct{ Collation *shardtypes.Collation }
+
+// CollationReorgEvent is posted when the canonical collation of a shard period
+// is replaced, either by another collation or by none at all.
+type CollationReorgEvent struct {
+	ShardID uint64      // Shard whose canonical chain changed
+	Period  uint64      // Period whose canonical collation was replaced
+	OldHash common.Hash // Hash of the previously canonical collation
+	NewHash common.Hash // Hash of the new canonical collation, empty if none
+}
@@ -0,0 +1,434 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/rlp"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+const (
+	softResponseLimit = 2 * 1024 * 1024  // Target maximum size of returned collation bodies
+	maxCollationFetch = 64               // Amount of collation bodies to be fetched per retrieval request
+	maxPendingBodies  = 256              // Maximum number of chunk roots awaiting their bodies
+	bodyFetchTimeout  = 10 * time.Second // Time allowance before an unanswered body request may be retried
+)
+
+func errResp(code errCode, format string, v ...interface{}) error {
+	return fmt.Errorf("%v - %v", code, fmt.Sprintf(format, v...))
+}
+
+// pendingBody is a collation body requested from the network, along with the
+// announced headers waiting for it.
+type pendingBody struct {
+	headers   []*shardtypes.CollationHeader // Announced headers committing to the body
+	requested time.Time                     // Time the body was requested
+}
+
+// ProtocolManager implements the shard sub-protocol, gossiping collations
+// between the nodes subscribed to the same shards. Collations are announced by
+// header, and their bodies are fetched by chunk root from the announcing peer.
+type ProtocolManager struct {
+	networkId uint64
+
+	chain   *ShardChain                 // Shard chain storing collations
+	deliver func(*shardtypes.Collation) // Callback for collations received from the network
+
+	shards  map[uint64]struct{}              // Shards the local node is subscribed to
+	recent  map[uint64]*shardtypes.Collation // Latest collation per shard, announced to new subscribers
+	pending map[common.Hash]*pendingBody     // Requested bodies, keyed by chunk root
+	lock    sync.RWMutex                     // Protects the subscriptions and the collation caches
+
+	peers        *peerSet
+	SubProtocols []p2p.Protocol
+
+	quitSync chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewProtocolManager returns a new shard sub-protocol manager subscribed to the
+// given shards. Valid collations received from the network are stored in the
+// shard chain and handed to the deliver callback, which may be nil.
+func NewProtocolManager(networkId uint64, shards []uint64, chain *ShardChain, deliver func(*shardtypes.Collation)) *ProtocolManager {
+	manager := &ProtocolManager{
+		networkId: networkId,
+		chain:     chain,
+		deliver:   deliver,
+		shards:    make(map[uint64]struct{}),
+		recent:    make(map[uint64]*shardtypes.Collation),
+		pending:   make(map[common.Hash]*pendingBody),
+		peers:     newPeerSet(),
+		quitSync:  make(chan struct{}),
+	}
+	for _, shard := range shards {
+		manager.shards[shard] = struct{}{}
+	}
+	manager.SubProtocols = make([]p2p.Protocol, 0, len(ProtocolVersions))
+	for i, version := range ProtocolVersions {
+		version := version // Closure for the run
+		manager.SubProtocols = append(manager.SubProtocols, p2p.Protocol{
+			Name:    ProtocolName,
+			Version: version,
+			Length:  ProtocolLengths[i],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				select {
+				case <-manager.quitSync:
+					return p2p.DiscQuitting
+				default:
+				}
+				manager.wg.Add(1)
+				defer manager.wg.Done()
+				return manager.handle(newPeer(int(version), p, rw))
+			},
+			NodeInfo: func() interface{} {
+				return manager.NodeInfo()
+			},
+			PeerInfo: func(id discover.NodeID) interface{} {
+				if p := manager.peers.Peer(fmt.Sprintf("%x", id[:8])); p != nil {
+					return p.Info()
+				}
+				return nil
+			},
+		})
+	}
+	return manager
+}
+
+// Stop terminates the shard sub-protocol, disconnecting all peers.
+func (pm *ProtocolManager) Stop() {
+	log.Info("Stopping shard protocol")
+
+	close(pm.quitSync)
+	pm.peers.Close()
+	pm.wg.Wait()
+
+	log.Info("Shard protocol stopped")
+}
+
+func (pm *ProtocolManager) removePeer(id string) {
+	// Short circuit if the peer was already removed
+	peer := pm.peers.Peer(id)
+	if peer == nil {
+		return
+	}
+	log.Debug("Removing shard peer", "peer", id)
+
+	if err := pm.peers.Unregister(id); err != nil {
+		log.Error("Peer removal failed", "peer", id, "err", err)
+	}
+	// Hard disconnect at the networking layer
+	peer.Peer.Disconnect(p2p.DiscUselessPeer)
+}
+
+// handle is the callback invoked to manage the life cycle of a shard peer. When
+// this function terminates, the peer is disconnected.
+func (pm *ProtocolManager) handle(p *peer) error {
+	p.Log().Debug("Shard peer connected", "name", p.Name())
+
+	// Execute the shard handshake
+	if err := p.Handshake(pm.networkId, pm.Shards()); err != nil {
+		p.Log().Debug("Shard handshake failed", "err", err)
+		return err
+	}
+	// Register the peer locally
+	if err := pm.peers.Register(p); err != nil {
+		p.Log().Error("Shard peer registration failed", "err", err)
+		return err
+	}
+	defer pm.removePeer(p.id)
+
+	// Announce the latest collations of the shards the peer is interested in
+	pm.announceRecent(p, p.Shards())
+
+	// main loop. handle incoming messages.
+	for {
+		if err := pm.handleMsg(p); err != nil {
+			p.Log().Debug("Shard message handling failed", "err", err)
+			return err
+		}
+	}
+}
+
+// handleMsg is invoked whenever an inbound message is received from a remote
+// peer. The remote connection is torn down upon returning any error.
+func (pm *ProtocolManager) handleMsg(p *peer) error {
+	// Read the next message from the remote peer, and ensure it's fully consumed
+	msg, err := p.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > ProtocolMaxMsgSize {
+		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	// Handle the message depending on its contents
+	switch {
+	case msg.Code == StatusMsg:
+		// Status messages should never arrive after the handshake
+		return errResp(ErrExtraStatusMsg, "uncontrolled status message")
+
+	case msg.Code == SubscribeMsg:
+		// The peer changed its shard subscriptions
+		var shards subscribeData
+		if err := msg.Decode(&shards); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if err := validateShards(shards); err != nil {
+			return err
+		}
+		pm.announceRecent(p, p.SetShards(shards))
+
+	case msg.Code == NewCollationHeadersMsg:
+		// A batch of new collations was announced, fetch the unknown bodies
+		var announces newCollationHeadersData
+		if err := msg.Decode(&announces); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		for _, header := range announces {
+			if header.ShardID.Cmp(big.NewInt(ShardCount)) >= 0 {
+				return errResp(ErrInvalidShard, "%v", header.ShardID)
+			}
+			if err := header.VerifySignature(); err != nil {
+				return errResp(ErrInvalidHeader, "%x: %v", header.Hash(), err)
+			}
+			p.MarkCollation(header.Hash())
+		}
+		if request := pm.scheduleBodies(announces); len(request) > 0 {
+			return p.RequestCollationBodies(request)
+		}
+
+	case msg.Code == GetCollationBodiesMsg:
+		// Decode the retrieval message
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		if _, err := msgStream.List(); err != nil {
+			return err
+		}
+		// Gather bodies until the fetch or network limits is reached
+		var (
+			root   common.Hash
+			bytes  int
+			bodies []types.Transactions
+		)
+		for bytes < softResponseLimit && len(bodies) < maxCollationFetch {
+			// Retrieve the chunk root of the next body
+			if err := msgStream.Decode(&root); err == rlp.EOL {
+				break
+			} else if err != nil {
+				return errResp(ErrDecode, "msg %v: %v", msg, err)
+			}
+			// Retrieve the requested body, stopping if enough was found
+			if body, ok := pm.chain.GetBodyByChunkRoot(root); ok {
+				bodies = append(bodies, body)
+				for _, tx := range body {
+					bytes += int(tx.Size())
+				}
+			}
+		}
+		return p.SendCollationBodies(bodies)
+
+	case msg.Code == CollationBodiesMsg:
+		// A batch of collation bodies arrived to one of our previous requests
+		var bodies collationBodiesData
+		if err := msg.Decode(&bodies); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		for _, body := range bodies {
+			root := shardtypes.DeriveChunkRoot(body)
+
+			pm.lock.Lock()
+			pending := pm.pending[root]
+			delete(pm.pending, root)
+			pm.lock.Unlock()
+
+			if pending == nil {
+				continue // Unrequested or already delivered
+			}
+			for _, header := range pending.headers {
+				pm.importCollation(shardtypes.NewCollationWithHeader(header).WithBody(body))
+			}
+		}
+
+	default:
+		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
+	}
+	return nil
+}
+
+// scheduleBodies files the announced headers of subscribed shards as waiting for
+// their bodies, returning the chunk roots that need to be requested.
+func (pm *ProtocolManager) scheduleBodies(headers []*shardtypes.CollationHeader) []common.Hash {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	// Drop any requests left unanswered for too long, allowing a refetch
+	for root, pending := range pm.pending {
+		if time.Since(pending.requested) > bodyFetchTimeout {
+			delete(pm.pending, root)
+		}
+	}
+	var request []common.Hash
+	for _, header := range headers {
+		if _, ok := pm.shards[header.ShardID.Uint64()]; !ok {
+			continue
+		}
+		hash := header.Hash()
+		if pm.chain.HasCollation(hash) {
+			continue
+		}
+		pending := pm.pending[header.ChunkRoot]
+		if pending == nil {
+			if len(pm.pending) >= maxPendingBodies {
+				log.Debug("Dropping collation announcement, too many pending bodies", "hash", hash)
+				continue
+			}
+			pending = &pendingBody{requested: time.Now()}
+			pm.pending[header.ChunkRoot] = pending
+			request = append(request, header.ChunkRoot)
+		}
+		known := false
+		for _, h := range pending.headers {
+			if h.Hash() == hash {
+				known = true
+				break
+			}
+		}
+		if !known {
+			pending.headers = append(pending.headers, header)
+		}
+	}
+	return request
+}
+
+// importCollation stores a collation assembled from network data, hands it to
+// the deliver callback and relays it to the other subscribed peers.
+func (pm *ProtocolManager) importCollation(collation *shardtypes.Collation) {
+	if pm.chain.HasCollation(collation.Hash()) {
+		return
+	}
+	if err := pm.chain.InsertCollation(collation); err != nil {
+		log.Debug("Discarded invalid collation", "hash", collation.Hash(), "err", err)
+		return
+	}
+	log.Debug("Received collation", "shard", collation.ShardID(), "period", collation.Period(), "hash", collation.Hash())
+	if pm.deliver != nil {
+		pm.deliver(collation)
+	}
+	pm.BroadcastCollation(collation)
+}
+
+// BroadcastCollation announces a collation to all peers subscribed to its shard
+// that do not know about it yet. The collation must already be stored in the
+// shard chain so that its body can be served.
+func (pm *ProtocolManager) BroadcastCollation(collation *shardtypes.Collation) {
+	hash, shard := collation.Hash(), collation.ShardID().Uint64()
+
+	pm.lock.Lock()
+	if prev := pm.recent[shard]; prev == nil || collation.Period().Cmp(prev.Period()) >= 0 {
+		pm.recent[shard] = collation
+	}
+	pm.lock.Unlock()
+
+	peers := pm.peers.PeersWithoutCollation(shard, hash)
+	for _, peer := range peers {
+		peer.SendCollationHeaders([]*shardtypes.CollationHeader{collation.Header()})
+	}
+	log.Trace("Announced collation", "hash", hash, "recipients", len(peers))
+}
+
+// announceRecent announces the latest known collations of the given shards to
+// a peer that just subscribed to them.
+func (pm *ProtocolManager) announceRecent(p *peer, shards []uint64) {
+	var headers []*shardtypes.CollationHeader
+
+	pm.lock.RLock()
+	for _, shard := range shards {
+		if collation := pm.recent[shard]; collation != nil && !p.knownCollations.Has(collation.Hash()) {
+			headers = append(headers, collation.Header())
+		}
+	}
+	pm.lock.RUnlock()
+
+	if len(headers) > 0 {
+		p.SendCollationHeaders(headers)
+	}
+}
+
+// Subscribe replaces the set of shards the local node is subscribed to and
+// notifies all connected peers about the change.
+func (pm *ProtocolManager) Subscribe(shards []uint64) {
+	pm.lock.Lock()
+	pm.shards = make(map[uint64]struct{}, len(shards))
+	for _, shard := range shards {
+		pm.shards[shard] = struct{}{}
+	}
+	pm.lock.Unlock()
+
+	for _, peer := range pm.peers.AllPeers() {
+		peer.SendSubscription(shards)
+	}
+}
+
+// Shards retrieves the list of shards the local node is subscribed to.
+func (pm *ProtocolManager) Shards() []uint64 {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+
+	shards := make([]uint64, 0, len(pm.shards))
+	for shard := range pm.shards {
+		shards = append(shards, shard)
+	}
+	return shards
+}
+
+// NodeInfo represents a short summary of the shard sub-protocol metadata known
+// about the host peer.
+type NodeInfo struct {
+	Network uint64   `json:"network"` // Sharding network ID
+	Shards  []uint64 `json:"shards"`  // Shards the node is subscribed to
+}
+
+// NodeInfo retrieves some protocol metadata about the running host node.
+func (pm *ProtocolManager) NodeInfo() *NodeInfo {
+	return &NodeInfo{
+		Network: pm.networkId,
+		Shards:  pm.Shards(),
+	}
+}
+
+// validateShards checks that a subscription only refers to existing shards.
+func validateShards(shards []uint64) error {
+	if int64(len(shards)) > ShardCount {
+		return errResp(ErrInvalidShard, "%d shards subscribed", len(shards))
+	}
+	for _, shard := range shards {
+		if shard >= uint64(ShardCount) {
+			return errResp(ErrInvalidShard, "%d", shard)
+		}
+	}
+	return nil
+}
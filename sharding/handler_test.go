@@ -0,0 +1,187 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/p2p"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+// Tests that peers with mismatching networks or invalid subscriptions are
+// rejected during the handshake.
+func TestHandshakeFailures(t *testing.T) {
+	tests := []struct {
+		status *statusData
+		want   errCode
+	}{
+		{&statusData{ProtocolVersion: shard1, NetworkId: DefaultConfig.NetworkId + 1}, ErrNetworkIdMismatch},
+		{&statusData{ProtocolVersion: shard1 + 1, NetworkId: DefaultConfig.NetworkId}, ErrProtocolVersionMismatch},
+		{&statusData{ProtocolVersion: shard1, NetworkId: DefaultConfig.NetworkId, Shards: []uint64{uint64(ShardCount)}}, ErrInvalidShard},
+	}
+	for i, tt := range tests {
+		pm, _ := newTestProtocolManager(1)
+		p, errc := newTestPeer(t, "peer", pm, false)
+
+		if err := p2p.ExpectMsg(p.app, StatusMsg, nil); err != nil {
+			t.Fatalf("test %d: status recv: %v", i, err)
+		}
+		if err := p2p.Send(p.app, StatusMsg, tt.status); err != nil {
+			t.Fatalf("test %d: status send: %v", i, err)
+		}
+		select {
+		case err := <-errc:
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want.String()) {
+				t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.want)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("test %d: peer not disconnected", i)
+		}
+		p.close()
+		pm.Stop()
+	}
+}
+
+// Tests that announced collations of subscribed shards are fetched by chunk
+// root, stored and delivered.
+func TestCollationFetching(t *testing.T) {
+	pm, delivered := newTestProtocolManager(1)
+	defer pm.Stop()
+
+	p, _ := newTestPeer(t, "peer", pm, true, 1)
+	defer p.close()
+
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	collation := newTestCollation(t, 1, 1, common.Hash{}, []*types.Transaction{tx})
+
+	if err := p2p.Send(p.app, NewCollationHeadersMsg, []*shardtypes.CollationHeader{collation.Header()}); err != nil {
+		t.Fatalf("failed to announce collation: %v", err)
+	}
+	if err := p2p.ExpectMsg(p.app, GetCollationBodiesMsg, []common.Hash{collation.ChunkRoot()}); err != nil {
+		t.Fatalf("body request mismatch: %v", err)
+	}
+	if err := p2p.Send(p.app, CollationBodiesMsg, []types.Transactions{collation.Transactions()}); err != nil {
+		t.Fatalf("failed to send body: %v", err)
+	}
+	select {
+	case c := <-delivered:
+		if c.Hash() != collation.Hash() {
+			t.Fatalf("delivered collation mismatch: have %x, want %x", c.Hash(), collation.Hash())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("collation not delivered")
+	}
+	if !pm.chain.HasCollation(collation.Hash()) {
+		t.Fatalf("delivered collation not stored")
+	}
+}
+
+// Tests that announcements of unsubscribed shards are ignored and that bodies
+// are served by chunk root.
+func TestCollationBodies(t *testing.T) {
+	pm, _ := newTestProtocolManager(1)
+	defer pm.Stop()
+
+	known := newTestCollation(t, 1, 1, common.Hash{}, []*types.Transaction{
+		types.NewTransaction(0, common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil),
+	})
+	if err := pm.chain.InsertCollation(known); err != nil {
+		t.Fatalf("failed to insert collation: %v", err)
+	}
+	p, _ := newTestPeer(t, "peer", pm, true, 1, 2)
+	defer p.close()
+
+	// Announce a collation of a shard the manager is not subscribed to
+	other := newTestCollation(t, 2, 1, common.Hash{}, nil)
+	if err := p2p.Send(p.app, NewCollationHeadersMsg, []*shardtypes.CollationHeader{other.Header()}); err != nil {
+		t.Fatalf("failed to announce collation: %v", err)
+	}
+	// Request a known and an unknown body, only the known should be returned
+	request := []common.Hash{known.ChunkRoot(), common.HexToHash("0xdeadbeef")}
+	if err := p2p.Send(p.app, GetCollationBodiesMsg, request); err != nil {
+		t.Fatalf("failed to request bodies: %v", err)
+	}
+	if err := p2p.ExpectMsg(p.app, CollationBodiesMsg, []types.Transactions{known.Transactions()}); err != nil {
+		t.Fatalf("body response mismatch: %v", err)
+	}
+	pm.lock.RLock()
+	pending := len(pm.pending)
+	pm.lock.RUnlock()
+	if pending != 0 {
+		t.Fatalf("unsubscribed shard scheduled for fetching: %d pending", pending)
+	}
+}
+
+// Tests that collations are announced to peers subscribed to their shard, and
+// to peers subscribing to the shard later on.
+func TestCollationBroadcast(t *testing.T) {
+	pm, _ := newTestProtocolManager(1)
+	defer pm.Stop()
+
+	subscribed, _ := newTestPeer(t, "subscribed", pm, true, 1)
+	defer subscribed.close()
+	late, _ := newTestPeer(t, "late", pm, true, 2)
+	defer late.close()
+
+	collation := newTestCollation(t, 1, 1, common.Hash{}, nil)
+	if err := pm.chain.InsertCollation(collation); err != nil {
+		t.Fatalf("failed to insert collation: %v", err)
+	}
+	go pm.BroadcastCollation(collation)
+
+	announce := []*shardtypes.CollationHeader{collation.Header()}
+	if err := p2p.ExpectMsg(subscribed.app, NewCollationHeadersMsg, announce); err != nil {
+		t.Fatalf("announcement mismatch: %v", err)
+	}
+	// Subscribe the second peer to the shard and expect the same announcement
+	if err := p2p.Send(late.app, SubscribeMsg, []uint64{1, 2}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if err := p2p.ExpectMsg(late.app, NewCollationHeadersMsg, announce); err != nil {
+		t.Fatalf("late announcement mismatch: %v", err)
+	}
+}
+
+// Tests that peers announcing collations with invalid signatures are dropped.
+func TestInvalidAnnouncement(t *testing.T) {
+	pm, _ := newTestProtocolManager(1)
+	defer pm.Stop()
+
+	p, errc := newTestPeer(t, "peer", pm, true, 1)
+	defer p.close()
+
+	header := newTestCollation(t, 1, 1, common.Hash{}, nil).Header()
+	header.ParentHash = common.HexToHash("0x01")
+
+	if err := p2p.Send(p.app, NewCollationHeadersMsg, []*shardtypes.CollationHeader{header}); err != nil {
+		t.Fatalf("failed to announce collation: %v", err)
+	}
+	select {
+	case err := <-errc:
+		if err == nil || !strings.HasPrefix(err.Error(), errCode(ErrInvalidHeader).String()) {
+			t.Errorf("error mismatch: have %v, want %v", err, errCode(ErrInvalidHeader))
+		}
+	case <-time.After(time.Second):
+		t.Errorf("peer not disconnected")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// This file contains some shared testing functionality, common to multiple
+// different files and modules being tested.
+
+package sharding
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+// newTestProtocolManager creates a new protocol manager subscribed to the given
+// shards on top of an empty in-memory shard chain. Collations delivered from
+// the network are forwarded on the returned channel.
+func newTestProtocolManager(shards ...uint64) (*ProtocolManager, chan *shardtypes.Collation) {
+	db, _ := ethdb.NewMemDatabase()
+	delivered := make(chan *shardtypes.Collation, 16)
+
+	chain, _ := NewShardChain(db, nil)
+	pm := NewProtocolManager(DefaultConfig.NetworkId, shards, chain, func(collation *shardtypes.Collation) {
+		delivered <- collation
+	})
+	return pm, delivered
+}
+
+// testPeer is a simulated peer to allow testing direct network calls.
+type testPeer struct {
+	net p2p.MsgReadWriter // Network layer reader/writer to simulate remote messaging
+	app *p2p.MsgPipeRW    // Application layer reader/writer to simulate the local side
+	*peer
+}
+
+// newTestPeer creates a new peer registered at the given protocol manager. If
+// shake is set, the handshake is executed with the peer subscribed to the
+// given shards.
+func newTestPeer(t *testing.T, name string, pm *ProtocolManager, shake bool, shards ...uint64) (*testPeer, <-chan error) {
+	// Create a message pipe to communicate through
+	app, net := p2p.MsgPipe()
+
+	// Generate a random id and create the peer
+	var id discover.NodeID
+	rand.Read(id[:])
+
+	peer := newPeer(shard1, p2p.NewPeer(id, name, nil), net)
+
+	// Start the peer on a new thread
+	errc := make(chan error, 1)
+	pm.wg.Add(1)
+	go func() {
+		defer pm.wg.Done()
+		errc <- pm.handle(peer)
+	}()
+	tp := &testPeer{app: app, net: net, peer: peer}
+
+	// Execute any implicitly requested handshakes and return
+	if shake {
+		tp.handshake(t, pm.Shards(), shards)
+	}
+	return tp, errc
+}
+
+// handshake simulates a trivial handshake that expects the local shard
+// subscriptions and announces the given remote ones.
+func (p *testPeer) handshake(t *testing.T, local []uint64, remote []uint64) {
+	msg := &statusData{
+		ProtocolVersion: uint32(p.version),
+		NetworkId:       DefaultConfig.NetworkId,
+		Shards:          local,
+	}
+	if err := p2p.ExpectMsg(p.app, StatusMsg, msg); err != nil {
+		t.Fatalf("status recv: %v", err)
+	}
+	msg.Shards = remote
+	if err := p2p.Send(p.app, StatusMsg, msg); err != nil {
+		t.Fatalf("status send: %v", err)
+	}
+}
+
+// close terminates the local side of the peer, notifying the remote protocol
+// manager of termination.
+func (p *testPeer) close() {
+	p.app.Close()
+}
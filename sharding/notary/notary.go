@@ -0,0 +1,239 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package notary implements the sharding notary service, which deposits into the
+// validator manager contract and submits collation headers to it for the shards
+// it is sampled for.
+package notary
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/sharding"
+	"github.com/ethereum/go-ethereum/sharding/contracts"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+var (
+	errStalePeriod   = errors.New("collation not from current period")
+	errNotEligible   = errors.New("not sampled for shard")
+	errSubmitted     = errors.New("header already submitted for shard")
+	errBadChunkRoot  = errors.New("chunk root mismatch")
+	errUnknownPeriod = errors.New("current period unknown")
+)
+
+// Notary is the sharding notary service. It makes sure the client account is
+// registered as a validator in the VMC and each period submits the headers of
+// proposed collations for the shards it is sampled for.
+type Notary struct {
+	config *sharding.Config
+	client *sharding.Client
+
+	period    *big.Int       // Current main chain period
+	eligible  map[int64]bool // Shards the notary is sampled for in the current period
+	submitted map[int64]bool // Shards a header was already submitted for in the current period
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a notary service on top of the sharding client registered in the
+// same node.
+func New(ctx *node.ServiceContext, config *sharding.Config) (*Notary, error) {
+	var client *sharding.Client
+	if err := ctx.Service(&client); err != nil {
+		return nil, err
+	}
+	return &Notary{
+		config: config,
+		client: client,
+		quit:   make(chan struct{}),
+	}, nil
+}
+
+// Protocols implements node.Service, returning the P2P network protocols used
+// by the notary (currently none).
+func (n *Notary) Protocols() []p2p.Protocol { return nil }
+
+// APIs implements node.Service, returning the RPC APIs exposed by the notary
+// (currently none).
+func (n *Notary) APIs() []rpc.API { return nil }
+
+// Start implements node.Service, depositing into the VMC if needed and starting
+// to notarize collations.
+func (n *Notary) Start(srvr *p2p.Server) error {
+	log.Info("Starting collation notary", "account", n.client.Account().Address)
+
+	periods := make(chan sharding.PeriodEvent, 4)
+	periodSub := n.client.SubscribePeriods(periods)
+	proposals := make(chan sharding.ProposalEvent, 64)
+	proposalSub := n.client.SubscribeProposals(proposals)
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		defer periodSub.Unsubscribe()
+		defer proposalSub.Unsubscribe()
+
+		ctx, opts := n.client.Context(), n.client.TransactOpts()
+		if err := deposit(ctx, n.client.MainChain(), n.client.VMC(), n.client.CallOpts(), opts); err != nil {
+			log.Error("Failed to deposit into validator manager contract", "err", err)
+			return
+		}
+		for {
+			select {
+			case ev := <-periods:
+				n.newPeriod(ev.Period)
+			case ev := <-proposals:
+				if err := n.notarize(ev.Collation); err != nil {
+					log.Debug("Skipped collation proposal", "shard", ev.Collation.ShardID(), "period", ev.Collation.Period(), "err", err)
+				}
+			case <-periodSub.Err():
+				return
+			case <-proposalSub.Err():
+				return
+			case <-n.quit:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop implements node.Service, terminating the notary.
+func (n *Notary) Stop() error {
+	close(n.quit)
+	n.wg.Wait()
+
+	log.Info("Collation notary stopped")
+	return nil
+}
+
+// newPeriod samples the shards the notary is eligible to submit headers for in
+// the given period.
+func (n *Notary) newPeriod(period *big.Int) {
+	n.period = period
+	n.eligible = make(map[int64]bool)
+	n.submitted = make(map[int64]bool)
+
+	vmc, opts, self := n.client.VMC(), n.client.CallOpts(), n.client.Account().Address
+	for shard := int64(0); shard < sharding.ShardCount; shard++ {
+		sampled, err := vmc.SampleValidator(opts, big.NewInt(shard), period)
+		if err != nil {
+			log.Warn("Failed to sample validator", "shard", shard, "period", period, "err", err)
+			return
+		}
+		if sampled == self {
+			n.eligible[shard] = true
+		}
+	}
+	// Only listen for proposals on the shards we may notarize
+	shards := make([]uint64, 0, len(n.eligible))
+	for shard := range n.eligible {
+		shards = append(shards, uint64(shard))
+	}
+	n.client.SubscribeShards(shards)
+
+	if len(n.eligible) > 0 {
+		log.Info("Sampled as notary", "period", period, "shards", len(n.eligible))
+	}
+}
+
+// notarize submits the header of a proposed collation to the VMC, provided the
+// notary is sampled for its shard in the current period and the collation is
+// valid.
+func (n *Notary) notarize(collation *shardtypes.Collation) error {
+	if err := n.checkProposal(collation); err != nil {
+		return err
+	}
+	shard := collation.ShardID()
+	tx, err := n.client.VMC().AddHeader(n.client.TransactOpts(), shard, collation.Period(), collation.ParentHash(), collation.ChunkRoot(), collation.ProposerAddress())
+	if err != nil {
+		return err
+	}
+	n.submitted[shard.Int64()] = true
+
+	if err := n.client.ShardChain().InsertCollation(collation); err != nil {
+		log.Warn("Failed to store notarized collation", "hash", collation.Hash(), "err", err)
+	}
+	log.Info("Submitted collation header", "shard", shard, "period", collation.Period(), "hash", collation.Hash(), "tx", tx.Hash())
+	return nil
+}
+
+// checkProposal verifies that a proposed collation may be notarized in the
+// current period.
+func (n *Notary) checkProposal(collation *shardtypes.Collation) error {
+	if n.period == nil {
+		return errUnknownPeriod
+	}
+	if collation.Period().Cmp(n.period) != 0 {
+		return errStalePeriod
+	}
+	shard := collation.ShardID().Int64()
+	if !n.eligible[shard] {
+		return errNotEligible
+	}
+	if n.submitted[shard] {
+		return errSubmitted
+	}
+	if err := collation.Header().VerifySignature(); err != nil {
+		return err
+	}
+	if !collation.VerifyChunkRoot() {
+		return errBadChunkRoot
+	}
+	return nil
+}
+
+// deposit registers the transacting account as a validator in the VMC unless it
+// already is, waiting for the deposit to be mined.
+func deposit(ctx context.Context, backend bind.DeployBackend, vmc *contracts.VMC, call *bind.CallOpts, opts *bind.TransactOpts) error {
+	deposited, err := vmc.IsValidatorDeposited(call, opts.From)
+	if err != nil {
+		return err
+	}
+	if deposited {
+		log.Info("Validator deposit already in place", "account", opts.From)
+		return nil
+	}
+	auth := *opts
+	auth.Value = sharding.DepositSize
+
+	tx, err := vmc.Deposit(&auth)
+	if err != nil {
+		return err
+	}
+	log.Info("Depositing into validator manager contract", "account", opts.From, "tx", tx.Hash())
+
+	receipt, err := bind.WaitMined(ctx, backend, tx)
+	if err != nil {
+		return err
+	}
+	if receipt.Status == types.ReceiptStatusFailed {
+		return errors.New("deposit transaction failed")
+	}
+	log.Info("Validator deposit mined", "account", opts.From)
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package notary
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/sharding/contracts"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddress = crypto.PubkeyToAddress(testKey.PublicKey)
+)
+
+// Tests that the notary deposits into the VMC exactly once.
+func TestDeposit(t *testing.T) {
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{
+		testAddress: {Balance: new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether))},
+	})
+	auth := bind.NewKeyedTransactor(testKey)
+
+	_, _, vmc, err := contracts.DeployVMC(auth, sim)
+	if err != nil {
+		t.Fatalf("Failed to deploy validator manager contract: %v", err)
+	}
+	sim.Commit()
+
+	// Keep mining blocks in the background so the deposit gets included
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case <-time.After(50 * time.Millisecond):
+				sim.Commit()
+			case <-done:
+				return
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := deposit(ctx, sim, vmc, nil, auth); err != nil {
+		t.Fatalf("Failed to deposit: %v", err)
+	}
+	if err := deposit(ctx, sim, vmc, nil, auth); err != nil {
+		t.Fatalf("Failed to check existing deposit: %v", err)
+	}
+	count, err := vmc.NumValidators(nil)
+	if err != nil {
+		t.Fatalf("Failed to retrieve validator count: %v", err)
+	}
+	if count.Cmp(big.NewInt(1)) != 0 {
+		t.Fatalf("Validator count mismatch: have %v, want %v", count, 1)
+	}
+}
+
+// Tests that only valid proposals for eligible shards of the current period are
+// accepted for notarization.
+func TestCheckProposal(t *testing.T) {
+	txs := []*types.Transaction{types.NewTransaction(0, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)}
+
+	propose := func(shard, period int64) *shardtypes.Collation {
+		collation, err := shardtypes.NewCollation(&shardtypes.CollationHeader{
+			ShardID: big.NewInt(shard),
+			Period:  big.NewInt(period),
+		}, txs).WithSignature(testKey)
+		if err != nil {
+			t.Fatalf("Failed to sign collation: %v", err)
+		}
+		return collation
+	}
+	n := &Notary{}
+	if err := n.checkProposal(propose(1, 2)); err != errUnknownPeriod {
+		t.Errorf("Proposal before first period: have %v, want %v", err, errUnknownPeriod)
+	}
+	n.period = big.NewInt(2)
+	n.eligible = map[int64]bool{1: true}
+	n.submitted = map[int64]bool{}
+
+	if err := n.checkProposal(propose(1, 1)); err != errStalePeriod {
+		t.Errorf("Stale proposal: have %v, want %v", err, errStalePeriod)
+	}
+	if err := n.checkProposal(propose(2, 2)); err != errNotEligible {
+		t.Errorf("Proposal for other shard: have %v, want %v", err, errNotEligible)
+	}
+	bad := propose(1, 2).WithBody(nil)
+	if err := n.checkProposal(bad); err != errBadChunkRoot {
+		t.Errorf("Proposal with invalid body: have %v, want %v", err, errBadChunkRoot)
+	}
+	unsigned := shardtypes.NewCollation(&shardtypes.CollationHeader{ShardID: big.NewInt(1), Period: big.NewInt(2)}, txs)
+	if err := n.checkProposal(unsigned); err != shardtypes.ErrInvalidSig {
+		t.Errorf("Unsigned proposal: have %v, want %v", err, shardtypes.ErrInvalidSig)
+	}
+	if err := n.checkProposal(propose(1, 2)); err != nil {
+		t.Errorf("Valid proposal rejected: %v", err)
+	}
+	n.submitted[1] = true
+	if err := n.checkProposal(propose(1, 2)); err != errSubmitted {
+		t.Errorf("Proposal for submitted shard: have %v, want %v", err, errSubmitted)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package observer implements the sharding observer service, which follows the
+// collation headers recorded for a shard without taking part in the protocol.
+package observer
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/sharding"
+)
+
+// Observer is the sharding observer service. Each period it looks up the
+// collation header recorded in the VMC for the previous period of its shard,
+// and it reports head changes and reorganisations of the shard chain.
+type Observer struct {
+	config *sharding.Config
+	client *sharding.Client
+	shard  *big.Int
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates an observer service on top of the sharding client registered in
+// the same node.
+func New(ctx *node.ServiceContext, config *sharding.Config) (*Observer, error) {
+	var client *sharding.Client
+	if err := ctx.Service(&client); err != nil {
+		return nil, err
+	}
+	return &Observer{
+		config: config,
+		client: client,
+		shard:  big.NewInt(config.ShardID),
+		quit:   make(chan struct{}),
+	}, nil
+}
+
+// Protocols implements node.Service, returning the P2P network protocols used
+// by the observer (currently none).
+func (o *Observer) Protocols() []p2p.Protocol { return nil }
+
+// APIs implements node.Service, returning the RPC APIs exposed by the observer
+// (currently none).
+func (o *Observer) APIs() []rpc.API { return nil }
+
+// Start implements node.Service, starting to follow the observed shard.
+func (o *Observer) Start(srvr *p2p.Server) error {
+	log.Info("Starting shard observer", "shard", o.shard)
+
+	var (
+		periods = make(chan sharding.PeriodEvent, 4)
+		heads   = make(chan core.ShardHeadEvent, 16)
+		reorgs  = make(chan sharding.CollationReorgEvent, 16)
+	)
+	sub := o.client.SubscribePeriods(periods)
+	headSub := o.client.ShardChain().SubscribeShardHeadEvent(heads)
+	reorgSub := o.client.ShardChain().SubscribeCollationReorgEvent(reorgs)
+
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		defer sub.Unsubscribe()
+		defer headSub.Unsubscribe()
+		defer reorgSub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-periods:
+				if ev.Period.Sign() > 0 {
+					o.observe(new(big.Int).Sub(ev.Period, common.Big1))
+				}
+			case ev := <-heads:
+				if ev.ShardID == o.shard.Uint64() {
+					log.Info("Shard head updated", "shard", ev.ShardID, "hash", ev.Hash)
+				}
+			case ev := <-reorgs:
+				if ev.ShardID == o.shard.Uint64() {
+					log.Info("Shard collation replaced", "shard", ev.ShardID, "period", ev.Period, "old", ev.OldHash, "new", ev.NewHash)
+				}
+			case <-sub.Err():
+				return
+			case <-o.quit:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop implements node.Service, terminating the observer.
+func (o *Observer) Stop() error {
+	close(o.quit)
+	o.wg.Wait()
+
+	log.Info("Shard observer stopped")
+	return nil
+}
+
+// observe reports the collation header recorded for the given period, if any.
+func (o *Observer) observe(period *big.Int) {
+	record, err := o.client.VMC().CollationRecords(o.client.CallOpts(), o.shard, period)
+	if err != nil {
+		log.Warn("Failed to retrieve collation record", "shard", o.shard, "period", period, "err", err)
+		return
+	}
+	if record.Validator == (common.Address{}) {
+		log.Debug("No collation recorded", "shard", o.shard, "period", period)
+		return
+	}
+	log.Info("Collation header recorded", "shard", o.shard, "period", period, "parent", record.ParentHash,
+		"chunkroot", record.ChunkRoot, "proposer", record.Proposer, "notary", record.Validator)
+}
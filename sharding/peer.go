@@ -0,0 +1,325 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/p2p"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+	"gopkg.in/fatih/set.v0"
+)
+
+var (
+	errClosed            = errors.New("peer set is closed")
+	errAlreadyRegistered = errors.New("peer is already registered")
+	errNotRegistered     = errors.New("peer is not registered")
+)
+
+const (
+	maxKnownCollations = 1024 // Maximum collation hashes to keep in the known list (prevent DOS)
+	handshakeTimeout   = 5 * time.Second
+)
+
+// PeerInfo represents a short summary of the shard sub-protocol metadata known
+// about a connected peer.
+type PeerInfo struct {
+	Version int      `json:"version"` // Shard protocol version negotiated
+	Shards  []uint64 `json:"shards"`  // Shards the peer is subscribed to
+}
+
+type peer struct {
+	id string
+
+	*p2p.Peer
+	rw p2p.MsgReadWriter
+
+	version int // Protocol version negotiated
+
+	shards map[uint64]struct{} // Shards the peer is subscribed to
+	lock   sync.RWMutex
+
+	knownCollations *set.Set // Set of collation hashes known to be known by this peer
+}
+
+func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
+	id := p.ID()
+
+	return &peer{
+		Peer:            p,
+		rw:              rw,
+		version:         version,
+		id:              fmt.Sprintf("%x", id[:8]),
+		shards:          make(map[uint64]struct{}),
+		knownCollations: set.New(),
+	}
+}
+
+// Info gathers and returns a collection of metadata known about a peer.
+func (p *peer) Info() *PeerInfo {
+	return &PeerInfo{
+		Version: p.version,
+		Shards:  p.Shards(),
+	}
+}
+
+// Shards retrieves the list of shards the peer is subscribed to.
+func (p *peer) Shards() []uint64 {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	shards := make([]uint64, 0, len(p.shards))
+	for shard := range p.shards {
+		shards = append(shards, shard)
+	}
+	return shards
+}
+
+// SetShards replaces the set of shards the peer is subscribed to, returning the
+// shards it was not subscribed to before.
+func (p *peer) SetShards(shards []uint64) []uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var added []uint64
+	subscribed := make(map[uint64]struct{}, len(shards))
+	for _, shard := range shards {
+		if _, ok := p.shards[shard]; !ok {
+			added = append(added, shard)
+		}
+		subscribed[shard] = struct{}{}
+	}
+	p.shards = subscribed
+	return added
+}
+
+// Subscribed checks whether the peer is subscribed to the given shard.
+func (p *peer) Subscribed(shard uint64) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	_, ok := p.shards[shard]
+	return ok
+}
+
+// MarkCollation marks a collation as known for the peer, ensuring that it will
+// never be announced to this particular peer.
+func (p *peer) MarkCollation(hash common.Hash) {
+	// If we reached the memory allowance, drop a previously known collation hash
+	for p.knownCollations.Size() >= maxKnownCollations {
+		p.knownCollations.Pop()
+	}
+	p.knownCollations.Add(hash)
+}
+
+// SendSubscription replaces the set of shards the remote peer should announce
+// collations of.
+func (p *peer) SendSubscription(shards []uint64) error {
+	return p2p.Send(p.rw, SubscribeMsg, subscribeData(shards))
+}
+
+// SendCollationHeaders announces the availability of a number of collations
+// and includes their hashes in the peer's known collation set.
+func (p *peer) SendCollationHeaders(headers []*shardtypes.CollationHeader) error {
+	for _, header := range headers {
+		p.MarkCollation(header.Hash())
+	}
+	return p2p.Send(p.rw, NewCollationHeadersMsg, newCollationHeadersData(headers))
+}
+
+// SendCollationBodies sends a batch of collation contents to the remote peer.
+func (p *peer) SendCollationBodies(bodies []types.Transactions) error {
+	return p2p.Send(p.rw, CollationBodiesMsg, collationBodiesData(bodies))
+}
+
+// RequestCollationBodies fetches a batch of collation bodies corresponding to
+// the chunk roots specified.
+func (p *peer) RequestCollationBodies(chunkRoots []common.Hash) error {
+	p.Log().Debug("Fetching batch of collation bodies", "count", len(chunkRoots))
+	return p2p.Send(p.rw, GetCollationBodiesMsg, getCollationBodiesData(chunkRoots))
+}
+
+// Handshake executes the shard protocol handshake, negotiating version number
+// and network IDs, and exchanging the initial shard subscriptions.
+func (p *peer) Handshake(network uint64, shards []uint64) error {
+	// Send out own handshake in a new thread
+	errc := make(chan error, 2)
+	var status statusData // safe to read after two values have been received from errc
+
+	go func() {
+		errc <- p2p.Send(p.rw, StatusMsg, &statusData{
+			ProtocolVersion: uint32(p.version),
+			NetworkId:       network,
+			Shards:          shards,
+		})
+	}()
+	go func() {
+		errc <- p.readStatus(network, &status)
+	}()
+	timeout := time.NewTimer(handshakeTimeout)
+	defer timeout.Stop()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errc:
+			if err != nil {
+				return err
+			}
+		case <-timeout.C:
+			return p2p.DiscReadTimeout
+		}
+	}
+	p.SetShards(status.Shards)
+	return nil
+}
+
+func (p *peer) readStatus(network uint64, status *statusData) (err error) {
+	msg, err := p.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Code != StatusMsg {
+		return errResp(ErrNoStatusMsg, "first msg has code %x (!= %x)", msg.Code, StatusMsg)
+	}
+	if msg.Size > ProtocolMaxMsgSize {
+		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
+	}
+	// Decode the handshake and make sure everything matches
+	if err := msg.Decode(&status); err != nil {
+		return errResp(ErrDecode, "msg %v: %v", msg, err)
+	}
+	if status.NetworkId != network {
+		return errResp(ErrNetworkIdMismatch, "%d (!= %d)", status.NetworkId, network)
+	}
+	if int(status.ProtocolVersion) != p.version {
+		return errResp(ErrProtocolVersionMismatch, "%d (!= %d)", status.ProtocolVersion, p.version)
+	}
+	if err := validateShards(status.Shards); err != nil {
+		return err
+	}
+	return nil
+}
+
+// String implements fmt.Stringer.
+func (p *peer) String() string {
+	return fmt.Sprintf("Peer %s [%s]", p.id,
+		fmt.Sprintf("shard/%d", p.version),
+	)
+}
+
+// peerSet represents the collection of active peers currently participating in
+// the shard sub-protocol.
+type peerSet struct {
+	peers  map[string]*peer
+	lock   sync.RWMutex
+	closed bool
+}
+
+// newPeerSet creates a new peer set to track the active participants.
+func newPeerSet() *peerSet {
+	return &peerSet{
+		peers: make(map[string]*peer),
+	}
+}
+
+// Register injects a new peer into the working set, or returns an error if the
+// peer is already known.
+func (ps *peerSet) Register(p *peer) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if ps.closed {
+		return errClosed
+	}
+	if _, ok := ps.peers[p.id]; ok {
+		return errAlreadyRegistered
+	}
+	ps.peers[p.id] = p
+	return nil
+}
+
+// Unregister removes a remote peer from the active set, disabling any further
+// actions to/from that particular entity.
+func (ps *peerSet) Unregister(id string) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if _, ok := ps.peers[id]; !ok {
+		return errNotRegistered
+	}
+	delete(ps.peers, id)
+	return nil
+}
+
+// Peer retrieves the registered peer with the given id.
+func (ps *peerSet) Peer(id string) *peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	return ps.peers[id]
+}
+
+// Len returns if the current number of peers in the set.
+func (ps *peerSet) Len() int {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	return len(ps.peers)
+}
+
+// AllPeers retrieves a flat list of all the peers within the set.
+func (ps *peerSet) AllPeers() []*peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*peer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		list = append(list, p)
+	}
+	return list
+}
+
+// PeersWithoutCollation retrieves a list of peers subscribed to a shard that do
+// not have a given collation in their set of known hashes.
+func (ps *peerSet) PeersWithoutCollation(shard uint64, hash common.Hash) []*peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*peer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		if p.Subscribed(shard) && !p.knownCollations.Has(hash) {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// Close disconnects all peers.
+// No new peers can be registered after Close has returned.
+func (ps *peerSet) Close() {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	for _, p := range ps.peers {
+		p.Disconnect(p2p.DiscQuitting)
+	}
+	ps.closed = true
+}
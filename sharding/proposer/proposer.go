@@ -0,0 +1,174 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package proposer implements the sharding proposer service, which packs shard
+// transactions into signed collations each period.
+package proposer
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/sharding"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+// maxCollationTxs is the maximum number of transactions packed into a single
+// collation.
+const maxCollationTxs = 256
+
+// signFn is a signer function callback used to sign collation headers.
+type signFn func(hash common.Hash) ([]byte, error)
+
+// Proposer is the sharding proposer service. Each period it creates a collation
+// for the configured shard out of the executable transactions of the shard
+// transaction pool and proposes it to the notaries.
+type Proposer struct {
+	config *sharding.Config
+	client *sharding.Client
+	shard  *big.Int
+	signer types.Signer
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a proposer service on top of the sharding client registered in
+// the same node.
+func New(ctx *node.ServiceContext, config *sharding.Config) (*Proposer, error) {
+	var client *sharding.Client
+	if err := ctx.Service(&client); err != nil {
+		return nil, err
+	}
+	shard := big.NewInt(config.ShardID)
+	return &Proposer{
+		config: config,
+		client: client,
+		shard:  shard,
+		signer: types.NewShardSigner(sharding.ChainConfig.ChainId, shard),
+		quit:   make(chan struct{}),
+	}, nil
+}
+
+// Protocols implements node.Service, returning the P2P network protocols used
+// by the proposer (currently none).
+func (p *Proposer) Protocols() []p2p.Protocol { return nil }
+
+// APIs implements node.Service, returning the RPC APIs exposed by the proposer
+// (currently none).
+func (p *Proposer) APIs() []rpc.API { return nil }
+
+// Start implements node.Service, starting to propose collations each period.
+func (p *Proposer) Start(srvr *p2p.Server) error {
+	log.Info("Starting collation proposer", "shard", p.shard)
+
+	periods := make(chan sharding.PeriodEvent, 4)
+	periodSub := p.client.SubscribePeriods(periods)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer periodSub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-periods:
+				p.propose(ev.Period)
+			case <-periodSub.Err():
+				return
+			case <-p.quit:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop implements node.Service, terminating the proposer.
+func (p *Proposer) Stop() error {
+	close(p.quit)
+	p.wg.Wait()
+
+	log.Info("Collation proposer stopped")
+	return nil
+}
+
+// propose creates a collation for the given period on top of the current head
+// of the shard chain and relays it to the notaries.
+func (p *Proposer) propose(period *big.Int) {
+	var parent common.Hash
+	if head := p.client.ShardChain().CurrentCollation(p.shard.Uint64()); head != nil {
+		parent = head.Hash()
+	}
+	pending, err := p.client.TxPool().Pending(p.shard.Uint64())
+	if err != nil {
+		log.Error("Failed to fetch pending shard transactions", "shard", p.shard, "err", err)
+		return
+	}
+	txs := collationTxs(p.signer, pending, maxCollationTxs)
+
+	collation, err := createCollation(p.shard, period, parent, txs, p.client.Account().Address, p.client.SignHash)
+	if err != nil {
+		log.Error("Failed to create collation", "shard", p.shard, "period", period, "err", err)
+		return
+	}
+	if err := p.client.ShardChain().InsertCollation(collation); err != nil {
+		log.Error("Failed to store proposed collation", "shard", p.shard, "period", period, "err", err)
+		return
+	}
+	p.client.ProposeCollation(collation)
+
+	log.Info("Proposed new collation", "shard", p.shard, "period", period, "txs", len(txs), "hash", collation.Hash())
+}
+
+// collationTxs selects at most limit transactions out of the executable ones of
+// the shard transaction pool, ordered by price and nonce.
+func collationTxs(signer types.Signer, pending map[common.Address]types.Transactions, limit int) types.Transactions {
+	var txs types.Transactions
+
+	set := types.NewTransactionsByPriceAndNonce(signer, pending)
+	for tx := set.Peek(); tx != nil && len(txs) < limit; tx = set.Peek() {
+		txs = append(txs, tx)
+		set.Shift()
+	}
+	return txs
+}
+
+// createCollation assembles a collation out of the given transactions and signs
+// its header on behalf of the proposer.
+func createCollation(shard, period *big.Int, parent common.Hash, txs []*types.Transaction, proposer common.Address, sign signFn) (*shardtypes.Collation, error) {
+	unsigned := shardtypes.NewCollation(&shardtypes.CollationHeader{
+		ShardID:         shard,
+		ParentHash:      parent,
+		Period:          period,
+		ProposerAddress: proposer,
+	}, txs)
+
+	header := unsigned.Header()
+	sig, err := sign(header.SigHash())
+	if err != nil {
+		return nil, err
+	}
+	header.ProposerSignature = sig
+
+	return shardtypes.NewCollationWithHeader(header).WithBody(unsigned.Transactions()), nil
+}
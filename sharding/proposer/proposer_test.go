@@ -0,0 +1,94 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package proposer
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/sharding"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddress = crypto.PubkeyToAddress(testKey.PublicKey)
+)
+
+func testSign(hash common.Hash) ([]byte, error) {
+	return crypto.Sign(hash.Bytes(), testKey)
+}
+
+// Tests that created collations carry the requested header fields, a matching
+// chunk root and a valid proposer signature.
+func TestCreateCollation(t *testing.T) {
+	txs := []*types.Transaction{
+		types.NewTransaction(0, common.HexToAddress("0x01"), big.NewInt(1), 21000, big.NewInt(1), nil),
+		types.NewTransaction(1, common.HexToAddress("0x02"), big.NewInt(2), 21000, big.NewInt(1), nil),
+	}
+	parent := common.HexToHash("0xdeadbeef")
+
+	collation, err := createCollation(big.NewInt(3), big.NewInt(7), parent, txs, testAddress, testSign)
+	if err != nil {
+		t.Fatalf("Failed to create collation: %v", err)
+	}
+	if collation.ShardID().Int64() != 3 || collation.Period().Int64() != 7 || collation.ParentHash() != parent {
+		t.Errorf("Collation header mismatch: %+v", collation.Header())
+	}
+	if collation.ProposerAddress() != testAddress {
+		t.Errorf("Proposer mismatch: have %x, want %x", collation.ProposerAddress(), testAddress)
+	}
+	if len(collation.Transactions()) != len(txs) {
+		t.Errorf("Transaction count mismatch: have %d, want %d", len(collation.Transactions()), len(txs))
+	}
+	if !collation.VerifyChunkRoot() {
+		t.Errorf("Chunk root does not match transactions")
+	}
+	if err := collation.Header().VerifySignature(); err != nil {
+		t.Errorf("Invalid proposer signature: %v", err)
+	}
+}
+
+// Tests that the transactions of a collation are picked out of the pending ones
+// of the pool in price and nonce order, up to the collation limit.
+func TestCollationTxs(t *testing.T) {
+	signer := types.NewShardSigner(sharding.ChainConfig.ChainId, common.Big1)
+	other, _ := crypto.GenerateKey()
+
+	sign := func(nonce uint64, price int64, key *ecdsa.PrivateKey) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, common.Address{}, big.NewInt(0), 21000, big.NewInt(price), nil), signer, key)
+		return tx
+	}
+	pending := map[common.Address]types.Transactions{
+		testAddress:                             {sign(0, 1, testKey), sign(1, 3, testKey)},
+		crypto.PubkeyToAddress(other.PublicKey): {sign(0, 2, other)},
+	}
+	want := types.Transactions{pending[crypto.PubkeyToAddress(other.PublicKey)][0], pending[testAddress][0]}
+
+	txs := collationTxs(signer, pending, 2)
+	if len(txs) != len(want) {
+		t.Fatalf("Transaction count mismatch: have %d, want %d", len(txs), len(want))
+	}
+	for i, tx := range txs {
+		if tx != want[i] {
+			t.Errorf("Transaction %d mismatch: have %x, want %x", i, tx.Hash(), want[i].Hash())
+		}
+	}
+}
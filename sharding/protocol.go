@@ -0,0 +1,101 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+// Constants to match up protocol versions and messages
+const (
+	shard1 = 1
+)
+
+// Official short name of the protocol used during capability negotiation.
+var ProtocolName = "shard"
+
+// Supported versions of the shard protocol (first is primary).
+var ProtocolVersions = []uint{shard1}
+
+// Number of implemented message corresponding to different protocol versions.
+var ProtocolLengths = []uint64{5}
+
+const ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
+
+// shard protocol message codes
+const (
+	StatusMsg              = 0x00
+	SubscribeMsg           = 0x01
+	NewCollationHeadersMsg = 0x02
+	GetCollationBodiesMsg  = 0x03
+	CollationBodiesMsg     = 0x04
+)
+
+type errCode int
+
+const (
+	ErrMsgTooLarge = iota
+	ErrDecode
+	ErrInvalidMsgCode
+	ErrProtocolVersionMismatch
+	ErrNetworkIdMismatch
+	ErrNoStatusMsg
+	ErrExtraStatusMsg
+	ErrInvalidShard
+	ErrInvalidHeader
+)
+
+func (e errCode) String() string {
+	return errorToString[int(e)]
+}
+
+var errorToString = map[int]string{
+	ErrMsgTooLarge:             "Message too long",
+	ErrDecode:                  "Invalid message",
+	ErrInvalidMsgCode:          "Invalid message code",
+	ErrProtocolVersionMismatch: "Protocol version mismatch",
+	ErrNetworkIdMismatch:       "NetworkId mismatch",
+	ErrNoStatusMsg:             "No status message",
+	ErrExtraStatusMsg:          "Extra status message",
+	ErrInvalidShard:            "Invalid shard",
+	ErrInvalidHeader:           "Invalid collation header",
+}
+
+// statusData is the network packet for the status message. Besides the
+// protocol version and network, it carries the initial set of shards the peer
+// is subscribed to.
+type statusData struct {
+	ProtocolVersion uint32
+	NetworkId       uint64
+	Shards          []uint64
+}
+
+// subscribeData is the network packet replacing the set of shards a peer is
+// subscribed to.
+type subscribeData []uint64
+
+// newCollationHeadersData is the network packet for collation announcements.
+type newCollationHeadersData []*shardtypes.CollationHeader
+
+// getCollationBodiesData is the network packet for requesting collation bodies
+// by their chunk roots.
+type getCollationBodiesData []common.Hash
+
+// collationBodiesData is the network packet for collation body distribution.
+type collationBodiesData []types.Transactions
@@ -0,0 +1,300 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+// ErrInvalidChunkRoot is returned if a collation's transactions do not match
+// the chunk root in its header.
+var ErrInvalidChunkRoot = errors.New("invalid collation chunk root")
+
+// ShardChain manages the collations of the shards tracked by the client. Fork
+// choice is delegated to the validator manager contract: the canonical
+// collation of a shard period is the one matching the header record submitted
+// to the VMC for that period, and the head of a shard is the canonical
+// collation of its most recent recorded period.
+//
+// Collations and VMC records may arrive in any order, the canonical chain is
+// updated as soon as both halves are known.
+//
+// The state of a shard is derived by executing its canonical collations with
+// the sharding ruleset, starting from the genesis state shared by all shards.
+// Collations are executed lazily, the first time the state after them is
+// requested.
+type ShardChain struct {
+	db          ethdb.Database // Database holding collations and the canonical chains
+	stateCache  state.Database // State database holding the shard states
+	genesisRoot common.Hash    // Root of the initial state of every shard
+
+	headFeed  event.Feed
+	reorgFeed event.Feed
+	scope     event.SubscriptionScope
+
+	mu        sync.Mutex // Serializes canonical chain updates
+	stateLock sync.Mutex // Serializes collation execution
+}
+
+// NewShardChain returns a shard chain manager on top of the given database. The
+// genesis allocation funds the accounts of every shard before its first
+// collation, there is no other way to move ether onto a shard yet.
+func NewShardChain(db ethdb.Database, genesis core.GenesisAlloc) (*ShardChain, error) {
+	sc := &ShardChain{
+		db:         db,
+		stateCache: state.NewDatabase(db),
+	}
+	statedb, err := state.New(common.Hash{}, sc.stateCache)
+	if err != nil {
+		return nil, err
+	}
+	for addr, account := range genesis {
+		statedb.AddBalance(addr, account.Balance)
+		statedb.SetCode(addr, account.Code)
+		statedb.SetNonce(addr, account.Nonce)
+		for key, value := range account.Storage {
+			statedb.SetState(addr, key, value)
+		}
+	}
+	if sc.genesisRoot, err = statedb.Commit(false); err != nil {
+		return nil, err
+	}
+	if err := sc.stateCache.TrieDB().Commit(sc.genesisRoot, false); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// Stop terminates all event subscriptions of the shard chain.
+func (sc *ShardChain) Stop() {
+	sc.scope.Close()
+}
+
+// InsertCollation validates a collation and stores it into the database. If the
+// VMC record of its shard period is already known and refers to the collation,
+// it becomes canonical.
+func (sc *ShardChain) InsertCollation(collation *shardtypes.Collation) error {
+	header := collation.Header()
+	if err := header.VerifySignature(); err != nil {
+		return err
+	}
+	if !collation.VerifyChunkRoot() {
+		return ErrInvalidChunkRoot
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if err := WriteCollation(sc.db, collation); err != nil {
+		return err
+	}
+	shard, period := header.ShardID.Uint64(), header.Period.Uint64()
+	if record := GetCollationRecord(sc.db, shard, period); record != nil && record.SigHash(shard, period) == header.SigHash() {
+		sc.setCanonical(shard, period, collation.Hash())
+	}
+	return nil
+}
+
+// SetCollationRecord updates the VMC header record of a shard period, making
+// the collation it refers to canonical. A nil record marks the period as not
+// having a recorded collation, e.g. after a main chain reorganisation dropped
+// the header submission.
+func (sc *ShardChain) SetCollationRecord(shard, period uint64, record *CollationRecord) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	var hash common.Hash
+	if record == nil {
+		DeleteCollationRecord(sc.db, shard, period)
+	} else {
+		if err := WriteCollationRecord(sc.db, shard, period, record); err != nil {
+			return err
+		}
+		hash = GetCollationHashBySigHash(sc.db, record.SigHash(shard, period))
+	}
+	sc.setCanonical(shard, period, hash)
+	return nil
+}
+
+// setCanonical assigns the canonical collation of a shard period, updating the
+// shard head and announcing any reorganisation. An empty hash removes the
+// canonical collation of the period. The caller must hold the lock.
+func (sc *ShardChain) setCanonical(shard, period uint64, hash common.Hash) {
+	old := GetCanonicalCollationHash(sc.db, shard, period)
+	if old == hash {
+		return
+	}
+	if hash == (common.Hash{}) {
+		DeleteCanonicalCollationHash(sc.db, shard, period)
+	} else {
+		WriteCanonicalCollationHash(sc.db, shard, period, hash)
+	}
+	if old != (common.Hash{}) {
+		log.Warn("Shard chain reorganised", "shard", shard, "period", period, "old", old, "new", hash)
+		sc.reorgFeed.Send(CollationReorgEvent{ShardID: shard, Period: period, OldHash: old, NewHash: hash})
+	}
+	// Move the head forward to the new collation, or back if the head was dropped
+	head := GetHeadCollationHash(sc.db, shard)
+
+	newHead := head
+	switch {
+	case hash != (common.Hash{}) && (head == (common.Hash{}) || period >= sc.period(head)):
+		newHead = hash
+	case hash == (common.Hash{}) && old == head:
+		newHead = common.Hash{}
+		for p := period; p > 0 && newHead == (common.Hash{}); p-- {
+			newHead = GetCanonicalCollationHash(sc.db, shard, p-1)
+		}
+	}
+	if newHead == head {
+		return
+	}
+	if newHead == (common.Hash{}) {
+		DeleteHeadCollationHash(sc.db, shard)
+	} else {
+		WriteHeadCollationHash(sc.db, shard, newHead)
+	}
+	log.Debug("Updated shard head", "shard", shard, "hash", newHead)
+	sc.headFeed.Send(core.ShardHeadEvent{ShardID: shard, Hash: newHead})
+}
+
+// period returns the period of a stored collation.
+func (sc *ShardChain) period(hash common.Hash) uint64 {
+	if header := GetCollationHeader(sc.db, hash); header != nil {
+		return header.Period.Uint64()
+	}
+	return 0
+}
+
+// CurrentCollation retrieves the head collation of a shard, nil if the shard
+// has no canonical collations yet.
+func (sc *ShardChain) CurrentCollation(shard uint64) *shardtypes.Collation {
+	hash := GetHeadCollationHash(sc.db, shard)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return GetCollation(sc.db, hash)
+}
+
+// GetCollation retrieves a collation from the database by hash.
+func (sc *ShardChain) GetCollation(hash common.Hash) *shardtypes.Collation {
+	return GetCollation(sc.db, hash)
+}
+
+// GetCollationByPeriod retrieves the canonical collation of a shard period.
+func (sc *ShardChain) GetCollationByPeriod(shard, period uint64) *shardtypes.Collation {
+	return GetCollationByPeriod(sc.db, shard, period)
+}
+
+// GetBodyByChunkRoot retrieves the transactions of any stored collation with
+// the given chunk root. The boolean reports whether such a collation is known,
+// as the body of an empty collation is empty too.
+func (sc *ShardChain) GetBodyByChunkRoot(chunkRoot common.Hash) (types.Transactions, bool) {
+	hash := GetCollationHashByChunkRoot(sc.db, chunkRoot)
+	if hash == (common.Hash{}) {
+		return nil, false
+	}
+	collation := GetCollation(sc.db, hash)
+	if collation == nil {
+		return nil, false
+	}
+	return collation.Transactions(), true
+}
+
+// HasCollation checks if a collation is fully present in the database or not.
+func (sc *ShardChain) HasCollation(hash common.Hash) bool {
+	return GetCollationHeader(sc.db, hash) != nil
+}
+
+// ShardState retrieves the state of a shard at its current head collation.
+func (sc *ShardChain) ShardState(shard uint64) (*state.StateDB, error) {
+	return sc.StateAt(GetHeadCollationHash(sc.db, shard))
+}
+
+// StateAt retrieves the shard state after the collation with the given hash,
+// executing it and any of its ancestors that were not executed yet. The empty
+// hash denotes the genesis state of a shard.
+func (sc *ShardChain) StateAt(hash common.Hash) (*state.StateDB, error) {
+	sc.stateLock.Lock()
+	defer sc.stateLock.Unlock()
+
+	// Gather the collations back to the last executed one, newest first
+	var (
+		pending []*shardtypes.Collation
+		root    = sc.genesisRoot
+	)
+	for hash != (common.Hash{}) {
+		if executed := GetCollationStateRoot(sc.db, hash); executed != (common.Hash{}) {
+			root = executed
+			break
+		}
+		collation := GetCollation(sc.db, hash)
+		if collation == nil {
+			return nil, fmt.Errorf("unknown collation %x", hash)
+		}
+		if len(pending) > 0 && collation.ShardID().Cmp(pending[0].ShardID()) != 0 {
+			return nil, fmt.Errorf("collation %x has parent %x in shard %v", pending[len(pending)-1].Hash(), hash, collation.ShardID())
+		}
+		pending = append(pending, collation)
+		hash = collation.ParentHash()
+	}
+	statedb, err := state.New(root, sc.stateCache)
+	if err != nil {
+		return nil, err
+	}
+	// Execute the gathered collations, persisting the state after each of them
+	for i := len(pending) - 1; i >= 0; i-- {
+		collation := pending[i]
+		ApplyCollation(ChainConfig, statedb, collation)
+
+		root, err := statedb.Commit(true)
+		if err != nil {
+			return nil, err
+		}
+		if err := sc.stateCache.TrieDB().Commit(root, false); err != nil {
+			return nil, err
+		}
+		WriteCollationStateRoot(sc.db, collation.Hash(), root)
+
+		if statedb, err = state.New(root, sc.stateCache); err != nil {
+			return nil, err
+		}
+	}
+	return statedb, nil
+}
+
+// SubscribeShardHeadEvent registers a subscription of core.ShardHeadEvent,
+// fired whenever the head collation of a shard changes.
+func (sc *ShardChain) SubscribeShardHeadEvent(ch chan<- core.ShardHeadEvent) event.Subscription {
+	return sc.scope.Track(sc.headFeed.Subscribe(ch))
+}
+
+// SubscribeCollationReorgEvent registers a subscription of CollationReorgEvent,
+// fired whenever a canonical collation is replaced.
+func (sc *ShardChain) SubscribeCollationReorgEvent(ch chan<- CollationReorgEvent) event.Subscription {
+	return sc.scope.Track(sc.reorgFeed.Subscribe(ch))
+}
@@ -0,0 +1,267 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+// recordOf creates the VMC header record referring to a collation.
+func recordOf(collation *shardtypes.Collation) *CollationRecord {
+	return &CollationRecord{
+		ParentHash: collation.ParentHash(),
+		ChunkRoot:  collation.ChunkRoot(),
+		Proposer:   collation.ProposerAddress(),
+		Notary:     common.HexToAddress("0xdeadbeef"),
+	}
+}
+
+// testGenesis funds the test account on every shard.
+var testGenesis = core.GenesisAlloc{testAddress: {Balance: big.NewInt(1000000000)}}
+
+func newTestShardChain() *ShardChain {
+	db, _ := ethdb.NewMemDatabase()
+	sc, _ := NewShardChain(db, testGenesis)
+	return sc
+}
+
+// checkHead verifies that the head of a shard is the expected collation.
+func checkHead(t *testing.T, sc *ShardChain, shard uint64, want *shardtypes.Collation) {
+	head := sc.CurrentCollation(shard)
+	switch {
+	case want == nil && head != nil:
+		t.Fatalf("shard %d: unexpected head %x", shard, head.Hash())
+	case want != nil && head == nil:
+		t.Fatalf("shard %d: missing head, want %x", shard, want.Hash())
+	case want != nil && head.Hash() != want.Hash():
+		t.Fatalf("shard %d: head mismatch: have %x, want %x", shard, head.Hash(), want.Hash())
+	}
+}
+
+// Tests that invalid collations are rejected by the shard chain.
+func TestShardChainInvalidCollation(t *testing.T) {
+	sc := newTestShardChain()
+
+	unsigned := shardtypes.NewCollation(&shardtypes.CollationHeader{ShardID: common.Big1, Period: common.Big1}, nil)
+	if err := sc.InsertCollation(unsigned); err != shardtypes.ErrInvalidSig {
+		t.Errorf("unsigned collation: error mismatch: have %v, want %v", err, shardtypes.ErrInvalidSig)
+	}
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	tampered := newTestCollation(t, 1, 1, common.Hash{}, nil).WithBody([]*types.Transaction{tx})
+	if err := sc.InsertCollation(tampered); err != ErrInvalidChunkRoot {
+		t.Errorf("tampered collation: error mismatch: have %v, want %v", err, ErrInvalidChunkRoot)
+	}
+	if sc.HasCollation(unsigned.Hash()) || sc.HasCollation(tampered.Hash()) {
+		t.Errorf("invalid collation stored")
+	}
+}
+
+// Tests that a collation becomes canonical once both the collation and its VMC
+// record are known, regardless of the order they arrive in.
+func TestShardChainRecordOrder(t *testing.T) {
+	sc := newTestShardChain()
+	defer sc.Stop()
+
+	heads := make(chan core.ShardHeadEvent, 4)
+	sub := sc.SubscribeShardHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	// Collation first, record afterwards
+	first := newTestCollation(t, 1, 1, common.Hash{}, nil)
+	if err := sc.InsertCollation(first); err != nil {
+		t.Fatalf("failed to insert collation: %v", err)
+	}
+	checkHead(t, sc, 1, nil)
+
+	if err := sc.SetCollationRecord(1, 1, recordOf(first)); err != nil {
+		t.Fatalf("failed to set record: %v", err)
+	}
+	checkHead(t, sc, 1, first)
+	checkHeadEvent(t, heads, 1, first.Hash())
+
+	// Record first, collation afterwards
+	second := newTestCollation(t, 1, 2, first.Hash(), nil)
+	if err := sc.SetCollationRecord(1, 2, recordOf(second)); err != nil {
+		t.Fatalf("failed to set record: %v", err)
+	}
+	checkHead(t, sc, 1, first)
+
+	if err := sc.InsertCollation(second); err != nil {
+		t.Fatalf("failed to insert collation: %v", err)
+	}
+	checkHead(t, sc, 1, second)
+	checkHeadEvent(t, heads, 1, second.Hash())
+
+	if c := sc.GetCollationByPeriod(1, 1); c == nil || c.Hash() != first.Hash() {
+		t.Errorf("canonical collation of period 1 mismatch: have %v, want %x", c, first.Hash())
+	}
+	// Other shards must not be affected
+	checkHead(t, sc, 2, nil)
+}
+
+// Tests that a changed VMC record reorganises the shard chain and that dropped
+// records roll the head back.
+func TestShardChainReorg(t *testing.T) {
+	sc := newTestShardChain()
+	defer sc.Stop()
+
+	var (
+		base = newTestCollation(t, 1, 1, common.Hash{}, nil)
+		tx   = types.NewTransaction(0, common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil)
+		a    = newTestCollation(t, 1, 3, base.Hash(), nil)
+		b    = newTestCollation(t, 1, 3, base.Hash(), []*types.Transaction{tx})
+	)
+	for _, c := range []*shardtypes.Collation{base, a, b} {
+		if err := sc.InsertCollation(c); err != nil {
+			t.Fatalf("failed to insert collation: %v", err)
+		}
+	}
+	sc.SetCollationRecord(1, 1, recordOf(base))
+	sc.SetCollationRecord(1, 3, recordOf(a))
+	checkHead(t, sc, 1, a)
+
+	heads := make(chan core.ShardHeadEvent, 4)
+	headSub := sc.SubscribeShardHeadEvent(heads)
+	defer headSub.Unsubscribe()
+
+	reorgs := make(chan CollationReorgEvent, 4)
+	reorgSub := sc.SubscribeCollationReorgEvent(reorgs)
+	defer reorgSub.Unsubscribe()
+
+	// Replace the record of period 3 with a competing collation
+	sc.SetCollationRecord(1, 3, recordOf(b))
+	checkHead(t, sc, 1, b)
+	checkReorgEvent(t, reorgs, CollationReorgEvent{ShardID: 1, Period: 3, OldHash: a.Hash(), NewHash: b.Hash()})
+	checkHeadEvent(t, heads, 1, b.Hash())
+
+	// Drop the record of period 3 and check that the head falls back to period 1
+	sc.SetCollationRecord(1, 3, nil)
+	checkHead(t, sc, 1, base)
+	checkReorgEvent(t, reorgs, CollationReorgEvent{ShardID: 1, Period: 3, OldHash: b.Hash()})
+	checkHeadEvent(t, heads, 1, base.Hash())
+
+	if c := sc.GetCollationByPeriod(1, 3); c != nil {
+		t.Errorf("dropped period still has canonical collation %x", c.Hash())
+	}
+	// Setting an unchanged record must not fire any events
+	sc.SetCollationRecord(1, 1, recordOf(base))
+	select {
+	case ev := <-heads:
+		t.Errorf("unexpected head event: %+v", ev)
+	case ev := <-reorgs:
+		t.Errorf("unexpected reorg event: %+v", ev)
+	default:
+	}
+}
+
+// Tests that the state of a shard is derived by executing its canonical
+// collations on top of the genesis state, with the shard ID and period available
+// to contracts.
+func TestShardChainState(t *testing.T) {
+	sc := newTestShardChain()
+	defer sc.Stop()
+
+	var (
+		signer = types.NewShardSigner(ChainConfig.ChainId, big.NewInt(3))
+		// SHARDID PUSH1 0 SSTORE PERIOD PUSH1 1 SSTORE
+		code     = common.FromHex("0x4660005547600155")
+		contract = crypto.CreateAddress(testAddress, 0)
+	)
+	create, _ := types.SignTx(types.NewContractCreation(0, common.Big0, 100000, common.Big0, code), signer, testKey)
+	future, _ := types.SignTx(types.NewTransaction(5, common.Address{1}, common.Big0, 21000, common.Big0, nil), signer, testKey)
+	transfer, _ := types.SignTx(types.NewTransaction(1, common.Address{1}, big.NewInt(1000), 21000, big.NewInt(10), nil), signer, testKey)
+	foreign, _ := types.SignTx(types.NewTransaction(2, common.Address{2}, big.NewInt(1000), 21000, common.Big0, nil), types.NewShardSigner(ChainConfig.ChainId, big.NewInt(4)), testKey)
+
+	first := newTestCollation(t, 3, 1, common.Hash{}, []*types.Transaction{create, future})
+	second := newTestCollation(t, 3, 2, first.Hash(), []*types.Transaction{transfer, foreign})
+	for i, c := range []*shardtypes.Collation{first, second} {
+		if err := sc.InsertCollation(c); err != nil {
+			t.Fatalf("failed to insert collation: %v", err)
+		}
+		sc.SetCollationRecord(3, uint64(i+1), recordOf(c))
+	}
+	statedb, err := sc.ShardState(3)
+	if err != nil {
+		t.Fatalf("failed to retrieve shard state: %v", err)
+	}
+	if nonce := statedb.GetNonce(testAddress); nonce != 2 {
+		t.Errorf("sender nonce mismatch: have %d, want 2", nonce)
+	}
+	if balance := statedb.GetBalance(common.Address{1}); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("recipient balance mismatch: have %v, want 1000", balance)
+	}
+	if balance := statedb.GetBalance(common.Address{2}); balance.Sign() != 0 {
+		t.Errorf("transaction signed for another shard executed, recipient balance %v", balance)
+	}
+	// The sender proposed the collations too, so it gets the fees back
+	if want := new(big.Int).Sub(testGenesis[testAddress].Balance, big.NewInt(1000)); statedb.GetBalance(testAddress).Cmp(want) != 0 {
+		t.Errorf("sender balance mismatch: have %v, want %v", statedb.GetBalance(testAddress), want)
+	}
+	if shard := statedb.GetState(contract, common.Hash{}); shard != common.BigToHash(big.NewInt(3)) {
+		t.Errorf("stored shard ID mismatch: have %x, want 3", shard)
+	}
+	if period := statedb.GetState(contract, common.BigToHash(common.Big1)); period != common.BigToHash(common.Big1) {
+		t.Errorf("stored period mismatch: have %x, want 1", period)
+	}
+	// The state after the first collation must be retained, other shards untouched
+	if statedb, err = sc.StateAt(first.Hash()); err != nil {
+		t.Fatalf("failed to retrieve collation state: %v", err)
+	}
+	if nonce := statedb.GetNonce(testAddress); nonce != 1 {
+		t.Errorf("sender nonce after first collation mismatch: have %d, want 1", nonce)
+	}
+	if statedb, err = sc.ShardState(4); err != nil {
+		t.Fatalf("failed to retrieve empty shard state: %v", err)
+	}
+	if nonce := statedb.GetNonce(testAddress); nonce != 0 {
+		t.Errorf("sender nonce in other shard mismatch: have %d, want 0", nonce)
+	}
+	if balance := statedb.GetBalance(testAddress); balance.Cmp(testGenesis[testAddress].Balance) != 0 {
+		t.Errorf("sender balance in other shard mismatch: have %v, want %v", balance, testGenesis[testAddress].Balance)
+	}
+}
+
+func checkHeadEvent(t *testing.T, ch <-chan core.ShardHeadEvent, shard uint64, hash common.Hash) {
+	select {
+	case ev := <-ch:
+		if ev.ShardID != shard || ev.Hash != hash {
+			t.Fatalf("head event mismatch: have %+v, want shard %d hash %x", ev, shard, hash)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("head event timeout")
+	}
+}
+
+func checkReorgEvent(t *testing.T, ch <-chan CollationReorgEvent, want CollationReorgEvent) {
+	select {
+	case ev := <-ch:
+		if ev != want {
+			t.Fatalf("reorg event mismatch: have %+v, want %+v", ev, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("reorg event timeout")
+	}
+}
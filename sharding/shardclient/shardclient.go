@@ -0,0 +1,136 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package shardclient provides a client for the sharding RPC API.
+package shardclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/sharding"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+// Client defines typed wrappers for the sharding RPC API.
+type Client struct {
+	c *rpc.Client
+}
+
+// Dial connects a client to the given URL.
+func Dial(rawurl string) (*Client, error) {
+	c, err := rpc.Dial(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(c), nil
+}
+
+// NewClient creates a client that uses the given RPC client.
+func NewClient(c *rpc.Client) *Client {
+	return &Client{c}
+}
+
+// Close closes the underlying RPC connection.
+func (sc *Client) Close() {
+	sc.c.Close()
+}
+
+// Shard Chain Access
+
+// CollationByHash returns the given full collation.
+func (sc *Client) CollationByHash(ctx context.Context, hash common.Hash) (*shardtypes.Collation, error) {
+	return sc.getCollation(ctx, "shard_getCollationByHash", hash, true)
+}
+
+// CollationByPeriod returns the canonical collation of a shard in the given
+// period.
+func (sc *Client) CollationByPeriod(ctx context.Context, shard, period uint64) (*shardtypes.Collation, error) {
+	return sc.getCollation(ctx, "shard_getCollationByPeriod", hexutil.Uint64(shard), hexutil.Uint64(period), true)
+}
+
+type rpcCollation struct {
+	Transactions []*types.Transaction `json:"transactions"`
+}
+
+func (sc *Client) getCollation(ctx context.Context, method string, args ...interface{}) (*shardtypes.Collation, error) {
+	var raw json.RawMessage
+	err := sc.c.CallContext(ctx, &raw, method, args...)
+	if err != nil {
+		return nil, err
+	} else if len(raw) == 0 {
+		return nil, ethereum.NotFound
+	}
+	// Decode header and transactions.
+	var head *shardtypes.CollationHeader
+	var body rpcCollation
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+	// Quick-verify the transaction list. This mostly helps with debugging the server.
+	if root := shardtypes.DeriveChunkRoot(body.Transactions); root != head.ChunkRoot {
+		return nil, fmt.Errorf("server returned transaction list with chunk root %x, header indicates %x", root, head.ChunkRoot)
+	}
+	return shardtypes.NewCollationWithHeader(head).WithBody(body.Transactions), nil
+}
+
+// CollationHeader returns the header of the collation with the given hash.
+func (sc *Client) CollationHeader(ctx context.Context, hash common.Hash) (*shardtypes.CollationHeader, error) {
+	var head *shardtypes.CollationHeader
+	err := sc.c.CallContext(ctx, &head, "shard_getCollationHeader", hash)
+	if err == nil && head == nil {
+		err = ethereum.NotFound
+	}
+	return head, err
+}
+
+// SubscribeNewCollations subscribes to notifications about the headers of the
+// collations proposed to the sharding client.
+func (sc *Client) SubscribeNewCollations(ctx context.Context, ch chan<- *shardtypes.CollationHeader) (ethereum.Subscription, error) {
+	return sc.c.Subscribe(ctx, "shard", ch, "newCollations")
+}
+
+// Validator Pool Access
+
+// ValidatorSet returns the validators currently deposited in the validator
+// manager contract.
+func (sc *Client) ValidatorSet(ctx context.Context) ([]*sharding.Validator, error) {
+	var validators []*sharding.Validator
+	err := sc.c.CallContext(ctx, &validators, "shard_validatorSet")
+	return validators, err
+}
+
+// Shard Transactions
+
+// SendTransaction injects a signed transaction into the pending transactions of
+// the proposer of the given shard.
+func (sc *Client) SendTransaction(ctx context.Context, shard uint64, tx *types.Transaction) error {
+	data, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return err
+	}
+	return sc.c.CallContext(ctx, nil, "shard_sendTransaction", hexutil.Uint64(shard), common.ToHex(data))
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package shardclient
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/sharding"
+	"github.com/ethereum/go-ethereum/sharding/devnet"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+// Tests the sharding RPC API against the proposer of a local devnet.
+func TestShardClient(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping devnet test in short mode")
+	}
+	// Fund a test account on the shards to submit transactions from
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	config := devnet.DefaultConfig
+	config.ShardAlloc = core.GenesisAlloc{addr: {Balance: big.NewInt(params.Ether)}}
+
+	net, err := devnet.New(&config)
+	if err != nil {
+		t.Fatalf("Failed to create devnet: %v", err)
+	}
+	if err := net.Start(); err != nil {
+		net.Stop()
+		t.Fatalf("Failed to start devnet: %v", err)
+	}
+	defer net.Stop()
+
+	client, err := Dial(net.Actors[0].Node.IPCEndpoint())
+	if err != nil {
+		t.Fatalf("Failed to dial proposer: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+
+	heads := make(chan *shardtypes.CollationHeader, 16)
+	sub, err := client.SubscribeNewCollations(ctx, heads)
+	if err != nil {
+		t.Fatalf("Failed to subscribe to new collations: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	// Submit a transaction to the shard and wait for it to be proposed
+	shard := uint64(config.ShardID)
+
+	var (
+		signer = types.NewShardSigner(sharding.ChainConfig.ChainId, new(big.Int).SetUint64(shard))
+		other  = types.NewShardSigner(sharding.ChainConfig.ChainId, new(big.Int).SetUint64(shard+1))
+	)
+	tx, _ := types.SignTx(types.NewTransaction(0, common.Address{1}, big.NewInt(1000), 21000, big.NewInt(params.Shannon), nil), signer, key)
+	invalid, _ := types.SignTx(types.NewTransaction(0, common.Address{1}, big.NewInt(params.Ether), 21000, big.NewInt(params.Shannon), nil), signer, key)
+	foreign, _ := types.SignTx(types.NewTransaction(0, common.Address{1}, big.NewInt(1000), 21000, big.NewInt(params.Shannon), nil), other, key)
+	if err := client.SendTransaction(ctx, shard, invalid); err == nil {
+		t.Fatalf("Transaction exceeding the sender's shard balance accepted")
+	}
+	if err := client.SendTransaction(ctx, shard, foreign); err == nil {
+		t.Fatalf("Transaction signed for another shard accepted")
+	}
+	if err := client.SendTransaction(ctx, shard+1, foreign); err == nil {
+		t.Fatalf("Transaction to unproposed shard accepted")
+	}
+	if err := client.SendTransaction(ctx, shard, tx); err != nil {
+		t.Fatalf("Failed to send transaction: %v", err)
+	}
+	// Proposals made before the notary deposited are never recorded, so track
+	// every collation including the transaction until one becomes canonical
+	var (
+		candidates []*shardtypes.Collation
+		canonical  *shardtypes.Collation
+	)
+	for canonical == nil {
+		select {
+		case head := <-heads:
+			proposed, err := client.CollationByHash(ctx, head.Hash())
+			if err != nil {
+				t.Fatalf("Failed to retrieve collation %x: %v", head.Hash(), err)
+			}
+			if proposed.Hash() != head.Hash() {
+				t.Fatalf("Collation hash mismatch: have %x, want %x", proposed.Hash(), head.Hash())
+			}
+			// Main chain transactions are proposed too, look for ours only
+			for _, included := range proposed.Transactions() {
+				if included.Hash() == tx.Hash() {
+					candidates = append(candidates, proposed)
+				}
+			}
+		case <-time.After(100 * time.Millisecond):
+			for _, candidate := range candidates {
+				recorded, err := client.CollationByPeriod(ctx, shard, candidate.Period().Uint64())
+				if err == ethereum.NotFound {
+					continue
+				}
+				if err != nil {
+					t.Fatalf("Failed to retrieve canonical collation: %v", err)
+				}
+				if recorded.Hash() == candidate.Hash() {
+					canonical = recorded
+				}
+			}
+		case err := <-sub.Err():
+			t.Fatalf("Collation subscription failed: %v", err)
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for transaction to become canonical (%d proposals)", len(candidates))
+		}
+	}
+	// The transaction must have been executed on top of the funded shard state
+	statedb, err := net.Actors[0].Client().ShardChain().StateAt(canonical.Hash())
+	if err != nil {
+		t.Fatalf("Failed to retrieve shard state: %v", err)
+	}
+	if balance := statedb.GetBalance(common.Address{1}); balance.Cmp(tx.Value()) != 0 {
+		t.Errorf("Recipient shard balance mismatch: have %v, want %v", balance, tx.Value())
+	}
+	header, err := client.CollationHeader(ctx, canonical.Hash())
+	if err != nil {
+		t.Fatalf("Failed to retrieve collation header: %v", err)
+	}
+	if header.Hash() != canonical.Hash() {
+		t.Errorf("Collation header hash mismatch: have %x, want %x", header.Hash(), canonical.Hash())
+	}
+	if _, err := client.CollationHeader(ctx, common.Hash{1}); err != ethereum.NotFound {
+		t.Errorf("Unknown collation header error mismatch: have %v, want %v", err, ethereum.NotFound)
+	}
+	validators, err := client.ValidatorSet(ctx)
+	if err != nil {
+		t.Fatalf("Failed to retrieve validator set: %v", err)
+	}
+	if len(validators) != 1 || validators[0].Address != net.Actors[1].Account {
+		t.Errorf("Validator set mismatch: have %+v, want notary %x", validators, net.Actors[1].Account)
+	}
+}
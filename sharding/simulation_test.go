@@ -0,0 +1,180 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/simulations"
+	"github.com/ethereum/go-ethereum/p2p/simulations/adapters"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// simService is a minimal node service running the shard protocol on top of an
+// in-memory shard chain, used to simulate shard networks.
+type simService struct {
+	pm *ProtocolManager
+}
+
+func (s *simService) Protocols() []p2p.Protocol { return s.pm.SubProtocols }
+func (s *simService) APIs() []rpc.API           { return nil }
+func (s *simService) Start(*p2p.Server) error   { return nil }
+func (s *simService) Stop() error               { s.pm.Stop(); return nil }
+
+// simServices tracks the shard services of a simulated network by node.
+type simServices struct {
+	services map[discover.NodeID]*simService
+	lock     sync.Mutex
+}
+
+// serviceFunc returns a service constructor for nodes subscribed to the given
+// shard.
+func (s *simServices) serviceFunc(shard uint64) adapters.ServiceFunc {
+	return func(ctx *adapters.ServiceContext) (node.Service, error) {
+		db, _ := ethdb.NewMemDatabase()
+		chain, err := NewShardChain(db, nil)
+		if err != nil {
+			return nil, err
+		}
+		service := &simService{pm: NewProtocolManager(DefaultConfig.NetworkId, []uint64{shard}, chain, nil)}
+
+		s.lock.Lock()
+		s.services[ctx.Config.ID] = service
+		s.lock.Unlock()
+
+		return service, nil
+	}
+}
+
+func (s *simServices) get(id discover.NodeID) *simService {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.services[id]
+}
+
+// Tests that a collation proposed in a simulated shard network is relayed to
+// every node subscribed to its shard, but not to nodes following other shards.
+func TestShardNetworkSimulation(t *testing.T) {
+	services := &simServices{services: make(map[discover.NodeID]*simService)}
+	adapter := adapters.NewSimAdapter(adapters.Services{
+		"shard1": services.serviceFunc(1),
+		"shard2": services.serviceFunc(2),
+	})
+	network := simulations.NewNetwork(adapter, &simulations.NetworkConfig{
+		DefaultService: "shard1",
+	})
+	defer network.Shutdown()
+
+	// Create a line of shard 1 nodes, and a shard 2 node hanging off its start
+	var ids []discover.NodeID
+	for i := 0; i < 5; i++ {
+		conf := adapters.RandomNodeConfig()
+		if i == 4 {
+			conf.Services = []string{"shard2"}
+		}
+		node, err := network.NewNodeWithConfig(conf)
+		if err != nil {
+			t.Fatalf("error creating node: %v", err)
+		}
+		if err := network.Start(node.ID()); err != nil {
+			t.Fatalf("error starting node: %v", err)
+		}
+		ids = append(ids, node.ID())
+	}
+	for i := 1; i < len(ids)-1; i++ {
+		if err := network.Connect(ids[i-1], ids[i]); err != nil {
+			t.Fatalf("error connecting nodes: %v", err)
+		}
+	}
+	if err := network.Connect(ids[0], ids[4]); err != nil {
+		t.Fatalf("error connecting nodes: %v", err)
+	}
+	collation := newTestCollation(t, 1, 1, common.Hash{}, nil)
+
+	// Propose the collation on the first node once all peers are connected
+	action := func(ctx context.Context) error {
+		for services.get(ids[0]).pm.peers.Len() < 2 || services.get(ids[3]).pm.peers.Len() < 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		pm := services.get(ids[0]).pm
+		if err := pm.chain.InsertCollation(collation); err != nil {
+			return err
+		}
+		pm.BroadcastCollation(collation)
+		return nil
+	}
+	check := func(ctx context.Context, id discover.NodeID) (bool, error) {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		default:
+		}
+		service := services.get(id)
+		if service == nil {
+			return false, fmt.Errorf("unknown node: %s", id)
+		}
+		return service.pm.chain.HasCollation(collation.Hash()), nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	trigger := make(chan discover.NodeID)
+	go func() {
+		for {
+			for _, id := range ids[1:4] {
+				select {
+				case trigger <- id:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-time.After(50 * time.Millisecond):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	result := simulations.NewSimulation(network).Run(ctx, &simulations.Step{
+		Action:  action,
+		Trigger: trigger,
+		Expect: &simulations.Expectation{
+			Nodes: ids[1:4],
+			Check: check,
+		},
+	})
+	if result.Error != nil {
+		t.Fatalf("simulation failed: %v", result.Error)
+	}
+	if services.get(ids[4]).pm.chain.HasCollation(collation.Hash()) {
+		t.Errorf("collation relayed to node not subscribed to its shard")
+	}
+}
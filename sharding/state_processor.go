@@ -0,0 +1,64 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+import (
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	shardtypes "github.com/ethereum/go-ethereum/sharding/types"
+)
+
+// ApplyCollation executes the transactions of a collation on top of the state
+// of its parent, with the shard ID and period of the collation available to the
+// sharding instruction set. The amount of gas used is returned.
+//
+// Collation validity does not depend on execution yet, notaries only check data
+// availability. Transactions that can't be applied, e.g. because of a nonce gap,
+// insufficient funds or a signature for another shard, are skipped without
+// affecting the state.
+func ApplyCollation(config *params.ChainConfig, statedb *state.StateDB, collation *shardtypes.Collation) uint64 {
+	var (
+		header = collation.Header()
+		signer = types.MakeShardSigner(config, header.ShardID, header.Period)
+		gp     = new(core.GasPool).AddGas(params.CollationGasLimit)
+		used   uint64
+	)
+	for i, tx := range collation.Transactions() {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			log.Debug("Skipping unsigned shard transaction", "hash", tx.Hash(), "err", err)
+			continue
+		}
+		statedb.Prepare(tx.Hash(), collation.Hash(), i)
+		snapshot := statedb.Snapshot()
+
+		context := core.NewShardEVMContext(msg, header.ShardID, header.Period, header.ProposerAddress)
+		_, gas, _, err := core.ApplyMessage(vm.NewEVM(context, statedb, config, vm.Config{}), msg, gp)
+		if err != nil {
+			statedb.RevertToSnapshot(snapshot)
+			log.Debug("Skipping inapplicable shard transaction", "hash", tx.Hash(), "err", err)
+			continue
+		}
+		statedb.Finalise(true)
+		used += gas
+	}
+	return used
+}
@@ -0,0 +1,273 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package types contains data types related to shard chains.
+package types
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"io"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/sha3"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// ErrInvalidSig is returned if a collation header signature is malformed.
+	ErrInvalidSig = errors.New("invalid collation header signature")
+
+	// ErrProposerMismatch is returned if a collation header is signed by some
+	// other account than its proposer.
+	ErrProposerMismatch = errors.New("collation header not signed by proposer")
+)
+
+//go:generate gencodec -type CollationHeader -field-override collationHeaderMarshaling -out gen_collation_header_json.go
+
+// CollationHeader represents a collation header in a shard chain.
+type CollationHeader struct {
+	ShardID           *big.Int       `json:"shardId"           gencodec:"required"` // Shard the collation belongs to
+	ParentHash        common.Hash    `json:"parentHash"        gencodec:"required"` // Hash of the parent collation in the same shard
+	ChunkRoot         common.Hash    `json:"chunkRoot"         gencodec:"required"` // Root hash of the collation's transaction list
+	Period            *big.Int       `json:"period"            gencodec:"required"` // Main chain period the collation was proposed in
+	ProposerAddress   common.Address `json:"proposerAddress"   gencodec:"required"` // Account that proposed the collation
+	ProposerSignature []byte         `json:"proposerSignature" gencodec:"required"` // Proposer signature over the header's signing hash
+}
+
+// field type overrides for gencodec
+type collationHeaderMarshaling struct {
+	ShardID           *hexutil.Big
+	Period            *hexutil.Big
+	ProposerSignature hexutil.Bytes
+	Hash              common.Hash `json:"hash"` // adds call to Hash() in MarshalJSON
+}
+
+// Hash returns the collation hash of the header, which is the keccak256 hash of
+// its RLP encoding, including the proposer signature.
+func (h *CollationHeader) Hash() common.Hash {
+	return rlpHash(h)
+}
+
+// SigHash returns the hash signed by the proposer, which covers every header
+// field except the signature itself.
+func (h *CollationHeader) SigHash() common.Hash {
+	return rlpHash([]interface{}{
+		h.ShardID,
+		h.ParentHash,
+		h.ChunkRoot,
+		h.Period,
+		h.ProposerAddress,
+	})
+}
+
+// Signer recovers the address of the account that signed the header.
+func (h *CollationHeader) Signer() (common.Address, error) {
+	if len(h.ProposerSignature) != 65 {
+		return common.Address{}, ErrInvalidSig
+	}
+	pub, err := crypto.SigToPub(h.SigHash().Bytes(), h.ProposerSignature)
+	if err != nil {
+		return common.Address{}, ErrInvalidSig
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// VerifySignature checks that the header was signed by its proposer.
+func (h *CollationHeader) VerifySignature() error {
+	signer, err := h.Signer()
+	if err != nil {
+		return err
+	}
+	if signer != h.ProposerAddress {
+		return ErrProposerMismatch
+	}
+	return nil
+}
+
+// SignHeader returns a copy of the header with the proposer address set to the
+// account of the given key and the signature filled in.
+func SignHeader(h *CollationHeader, prv *ecdsa.PrivateKey) (*CollationHeader, error) {
+	cpy := CopyCollationHeader(h)
+	cpy.ProposerAddress = crypto.PubkeyToAddress(prv.PublicKey)
+
+	sig, err := crypto.Sign(cpy.SigHash().Bytes(), prv)
+	if err != nil {
+		return nil, err
+	}
+	cpy.ProposerSignature = sig
+	return cpy, nil
+}
+
+// CopyCollationHeader creates a deep copy of a collation header to prevent side
+// effects from modifying a header variable.
+func CopyCollationHeader(h *CollationHeader) *CollationHeader {
+	cpy := *h
+	if cpy.ShardID = new(big.Int); h.ShardID != nil {
+		cpy.ShardID.Set(h.ShardID)
+	}
+	if cpy.Period = new(big.Int); h.Period != nil {
+		cpy.Period.Set(h.Period)
+	}
+	cpy.ProposerSignature = common.CopyBytes(h.ProposerSignature)
+	return &cpy
+}
+
+// Collation represents an entire collation in a shard chain.
+type Collation struct {
+	header       *CollationHeader
+	transactions types.Transactions
+
+	// caches
+	hash atomic.Value
+	size atomic.Value
+}
+
+// "external" collation encoding, used for the shard protocol and storage.
+type extcollation struct {
+	Header *CollationHeader
+	Txs    []*types.Transaction
+}
+
+// NewCollation creates a new collation. The input data is copied, changes to
+// header and to the field values will not affect the collation.
+//
+// The value of ChunkRoot in header is ignored and set to the root derived from
+// the given transactions. As the chunk root is covered by the proposer
+// signature, the collation needs to be signed afterwards.
+func NewCollation(header *CollationHeader, txs []*types.Transaction) *Collation {
+	c := &Collation{header: CopyCollationHeader(header)}
+
+	c.header.ChunkRoot = DeriveChunkRoot(txs)
+	if len(txs) > 0 {
+		c.transactions = make(types.Transactions, len(txs))
+		copy(c.transactions, txs)
+	}
+	return c
+}
+
+// NewCollationWithHeader creates a collation with the given header data and no
+// transactions. The header data is copied, changes to header and to the field
+// values will not affect the collation.
+func NewCollationWithHeader(header *CollationHeader) *Collation {
+	return &Collation{header: CopyCollationHeader(header)}
+}
+
+// WithSignature returns a new collation with the contents of c, but its header
+// signed by the given proposer key.
+func (c *Collation) WithSignature(prv *ecdsa.PrivateKey) (*Collation, error) {
+	header, err := SignHeader(c.header, prv)
+	if err != nil {
+		return nil, err
+	}
+	return &Collation{header: header, transactions: c.transactions}, nil
+}
+
+// WithBody returns a new collation with the header of c and the given
+// transactions. The chunk root of the header is not recomputed.
+func (c *Collation) WithBody(txs []*types.Transaction) *Collation {
+	cpy := &Collation{
+		header:       CopyCollationHeader(c.header),
+		transactions: make(types.Transactions, len(txs)),
+	}
+	copy(cpy.transactions, txs)
+	return cpy
+}
+
+// DecodeRLP implements rlp.Decoder, decoding the external collation format.
+func (c *Collation) DecodeRLP(s *rlp.Stream) error {
+	var ec extcollation
+	_, size, _ := s.Kind()
+	if err := s.Decode(&ec); err != nil {
+		return err
+	}
+	c.header, c.transactions = ec.Header, ec.Txs
+	c.size.Store(common.StorageSize(rlp.ListSize(size)))
+	return nil
+}
+
+// EncodeRLP implements rlp.Encoder, serializing c into the external collation
+// format.
+func (c *Collation) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, extcollation{
+		Header: c.header,
+		Txs:    c.transactions,
+	})
+}
+
+func (c *Collation) ShardID() *big.Int                { return new(big.Int).Set(c.header.ShardID) }
+func (c *Collation) Period() *big.Int                 { return new(big.Int).Set(c.header.Period) }
+func (c *Collation) ParentHash() common.Hash          { return c.header.ParentHash }
+func (c *Collation) ChunkRoot() common.Hash           { return c.header.ChunkRoot }
+func (c *Collation) ProposerAddress() common.Address  { return c.header.ProposerAddress }
+func (c *Collation) Transactions() types.Transactions { return c.transactions }
+
+// Header returns a copy of the collation header.
+func (c *Collation) Header() *CollationHeader { return CopyCollationHeader(c.header) }
+
+// Hash returns the keccak256 hash of the collation's header. The hash is
+// computed on the first call and cached thereafter.
+func (c *Collation) Hash() common.Hash {
+	if hash := c.hash.Load(); hash != nil {
+		return hash.(common.Hash)
+	}
+	v := c.header.Hash()
+	c.hash.Store(v)
+	return v
+}
+
+// Size returns the true RLP encoded storage size of the collation, either by
+// encoding and returning it, or returning a previously cached value.
+func (c *Collation) Size() common.StorageSize {
+	if size := c.size.Load(); size != nil {
+		return size.(common.StorageSize)
+	}
+	w := writeCounter(0)
+	rlp.Encode(&w, c)
+	c.size.Store(common.StorageSize(w))
+	return common.StorageSize(w)
+}
+
+// VerifyChunkRoot checks that the chunk root in the header matches the
+// transactions carried by the collation.
+func (c *Collation) VerifyChunkRoot() bool {
+	return DeriveChunkRoot(c.transactions) == c.header.ChunkRoot
+}
+
+// DeriveChunkRoot computes the chunk root of a list of transactions, which is
+// the root of the same trie used for block transaction roots.
+func DeriveChunkRoot(txs []*types.Transaction) common.Hash {
+	return types.DeriveSha(types.Transactions(txs))
+}
+
+type writeCounter common.StorageSize
+
+func (c *writeCounter) Write(b []byte) (int, error) {
+	*c += writeCounter(len(b))
+	return len(b), nil
+}
+
+func rlpHash(x interface{}) (h common.Hash) {
+	hw := sha3.NewKeccak256()
+	rlp.Encode(hw, x)
+	hw.Sum(h[:0])
+	return h
+}
@@ -0,0 +1,186 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var testKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+
+// makeTestCollation creates a signed collation with a few transactions.
+func makeTestCollation(t *testing.T) *Collation {
+	txs := []*types.Transaction{
+		types.NewTransaction(0, common.HexToAddress("0x01"), big.NewInt(1), 21000, big.NewInt(1), nil),
+		types.NewTransaction(1, common.HexToAddress("0x02"), big.NewInt(2), 21000, big.NewInt(1), []byte{0xde, 0xad}),
+	}
+	header := &CollationHeader{
+		ShardID:    big.NewInt(3),
+		ParentHash: common.HexToHash("0xdeadbeef"),
+		Period:     big.NewInt(42),
+	}
+	collation, err := NewCollation(header, txs).WithSignature(testKey)
+	if err != nil {
+		t.Fatalf("failed to sign collation: %v", err)
+	}
+	return collation
+}
+
+func TestCollationEncoding(t *testing.T) {
+	collation := makeTestCollation(t)
+
+	enc, err := rlp.EncodeToBytes(collation)
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	var dec Collation
+	if err := rlp.DecodeBytes(enc, &dec); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if dec.Hash() != collation.Hash() {
+		t.Errorf("hash mismatch: have %x, want %x", dec.Hash(), collation.Hash())
+	}
+	if !reflect.DeepEqual(dec.Header(), collation.Header()) {
+		t.Errorf("header mismatch:\nhave %+v\nwant %+v", dec.Header(), collation.Header())
+	}
+	if len(dec.Transactions()) != len(collation.Transactions()) {
+		t.Fatalf("transaction count mismatch: have %d, want %d", len(dec.Transactions()), len(collation.Transactions()))
+	}
+	for i, tx := range dec.Transactions() {
+		if tx.Hash() != collation.Transactions()[i].Hash() {
+			t.Errorf("transaction %d hash mismatch: have %x, want %x", i, tx.Hash(), collation.Transactions()[i].Hash())
+		}
+	}
+	if dec.Size() != common.StorageSize(len(enc)) {
+		t.Errorf("size mismatch: have %v, want %v", dec.Size(), len(enc))
+	}
+	if !dec.VerifyChunkRoot() {
+		t.Errorf("chunk root mismatch after decoding")
+	}
+	reenc, err := rlp.EncodeToBytes(&dec)
+	if err != nil {
+		t.Fatalf("re-encode error: %v", err)
+	}
+	if !bytes.Equal(enc, reenc) {
+		t.Errorf("re-encoding mismatch:\nhave %x\nwant %x", reenc, enc)
+	}
+}
+
+func TestCollationHashing(t *testing.T) {
+	collation := makeTestCollation(t)
+	header := collation.Header()
+
+	if collation.Hash() != rlpHash(header) {
+		t.Errorf("collation hash mismatch: have %x, want %x", collation.Hash(), rlpHash(header))
+	}
+	// The signing hash must not depend on the signature, the full hash must
+	unsigned := CopyCollationHeader(header)
+	unsigned.ProposerSignature = nil
+
+	if unsigned.SigHash() != header.SigHash() {
+		t.Errorf("signing hash depends on signature")
+	}
+	if unsigned.Hash() == header.Hash() {
+		t.Errorf("collation hash does not depend on signature")
+	}
+}
+
+func TestChunkRoot(t *testing.T) {
+	collation := makeTestCollation(t)
+
+	if want := types.DeriveSha(collation.Transactions()); collation.ChunkRoot() != want {
+		t.Errorf("chunk root mismatch: have %x, want %x", collation.ChunkRoot(), want)
+	}
+	if root := NewCollation(&CollationHeader{}, nil).ChunkRoot(); root != types.EmptyRootHash {
+		t.Errorf("empty chunk root mismatch: have %x, want %x", root, types.EmptyRootHash)
+	}
+	if tampered := collation.WithBody(collation.Transactions()[:1]); tampered.VerifyChunkRoot() {
+		t.Errorf("chunk root verified for tampered body")
+	}
+}
+
+func TestCollationSignature(t *testing.T) {
+	collation := makeTestCollation(t)
+	header := collation.Header()
+
+	want := crypto.PubkeyToAddress(testKey.PublicKey)
+	if header.ProposerAddress != want {
+		t.Fatalf("proposer mismatch: have %x, want %x", header.ProposerAddress, want)
+	}
+	signer, err := header.Signer()
+	if err != nil {
+		t.Fatalf("failed to recover signer: %v", err)
+	}
+	if signer != want {
+		t.Errorf("signer mismatch: have %x, want %x", signer, want)
+	}
+	if err := header.VerifySignature(); err != nil {
+		t.Errorf("failed to verify signature: %v", err)
+	}
+	// Modifying any signed field must invalidate the signature
+	tampered := CopyCollationHeader(header)
+	tampered.Period.Add(tampered.Period, big.NewInt(1))
+	if err := tampered.VerifySignature(); err != ErrProposerMismatch {
+		t.Errorf("tampered header error mismatch: have %v, want %v", err, ErrProposerMismatch)
+	}
+	// Claiming someone else's signature must be rejected
+	impostor := CopyCollationHeader(header)
+	impostor.ProposerAddress = common.HexToAddress("0x01")
+	if err := impostor.VerifySignature(); err != ErrProposerMismatch {
+		t.Errorf("impostor header error mismatch: have %v, want %v", err, ErrProposerMismatch)
+	}
+	unsigned := CopyCollationHeader(header)
+	unsigned.ProposerSignature = nil
+	if err := unsigned.VerifySignature(); err != ErrInvalidSig {
+		t.Errorf("unsigned header error mismatch: have %v, want %v", err, ErrInvalidSig)
+	}
+}
+
+func TestCollationHeaderJSON(t *testing.T) {
+	header := makeTestCollation(t).Header()
+
+	enc, err := json.Marshal(header)
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(enc, &fields); err != nil {
+		t.Fatalf("field decode error: %v", err)
+	}
+	if fields["hash"] != header.Hash().Hex() {
+		t.Errorf("hash field mismatch: have %v, want %x", fields["hash"], header.Hash())
+	}
+	var dec CollationHeader
+	if err := json.Unmarshal(enc, &dec); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !reflect.DeepEqual(&dec, header) {
+		t.Errorf("decoded header mismatch:\nhave %+v\nwant %+v", &dec, header)
+	}
+	if err := json.Unmarshal([]byte(`{"shardId":"0x1"}`), &dec); err == nil {
+		t.Errorf("decoded header with missing fields")
+	}
+}
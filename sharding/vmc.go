@@ -0,0 +1,64 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+//go:generate abigen --sol contracts/validator_manager.sol --pkg contracts --out contracts/validator_manager.go
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/sharding/contracts"
+)
+
+// vmcBackend is the main chain functionality needed to locate, deploy and
+// interact with the validator manager contract.
+type vmcBackend interface {
+	bind.ContractBackend
+	bind.DeployBackend
+}
+
+// initVMC binds to the validator manager contract at the given address. If no
+// contract code exists there, a new contract is deployed and the call blocks
+// until the deployment is mined or the context is cancelled.
+func initVMC(ctx context.Context, backend vmcBackend, opts *bind.TransactOpts, addr common.Address) (common.Address, *contracts.VMC, error) {
+	code, err := backend.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("failed to retrieve VMC code: %v", err)
+	}
+	if len(code) == 0 {
+		log.Warn("No validator manager contract found, deploying", "address", addr)
+
+		_, tx, _, err := contracts.DeployVMC(opts, backend)
+		if err != nil {
+			return common.Address{}, nil, fmt.Errorf("failed to deploy VMC: %v", err)
+		}
+		log.Info("Waiting for validator manager contract to be mined", "tx", tx.Hash())
+		if addr, err = bind.WaitDeployed(ctx, backend, tx); err != nil {
+			return common.Address{}, nil, fmt.Errorf("failed to deploy VMC: %v", err)
+		}
+		log.Info("Deployed validator manager contract", "address", addr)
+	}
+	vmc, err := contracts.NewVMC(addr, backend)
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("failed to bind VMC: %v", err)
+	}
+	return addr, vmc, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sharding
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddress = crypto.PubkeyToAddress(testKey.PublicKey)
+)
+
+// Tests that a validator manager contract is deployed if none exists at the
+// configured address, and that an existing one is reused.
+func TestInitVMC(t *testing.T) {
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{testAddress: {Balance: big.NewInt(1000000000000000000)}})
+	auth := bind.NewKeyedTransactor(testKey)
+
+	// Keep mining blocks in the background so deployments get included
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case <-time.After(50 * time.Millisecond):
+				sim.Commit()
+			case <-done:
+				return
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	addr, vmc, err := initVMC(ctx, sim, auth, common.Address{})
+	if err != nil {
+		t.Fatalf("Failed to deploy validator manager contract: %v", err)
+	}
+	if addr == (common.Address{}) {
+		t.Fatalf("Validator manager contract deployed to zero address")
+	}
+	if _, err := vmc.NumValidators(nil); err != nil {
+		t.Fatalf("Failed to call deployed contract: %v", err)
+	}
+	// Initializing against the deployed address should not redeploy
+	again, _, err := initVMC(ctx, sim, auth, addr)
+	if err != nil {
+		t.Fatalf("Failed to bind existing validator manager contract: %v", err)
+	}
+	if again != addr {
+		t.Fatalf("Validator manager contract redeployed: have %x, want %x", again, addr)
+	}
+}
@@ -20,6 +20,8 @@ func (s stEnv) MarshalJSON() ([]byte, error) {
 		GasLimit   math.HexOrDecimal64      `json:"currentGasLimit"   gencodec:"required"`
 		Number     math.HexOrDecimal64      `json:"currentNumber"     gencodec:"required"`
 		Timestamp  math.HexOrDecimal64      `json:"currentTimestamp"  gencodec:"required"`
+		ShardID    math.HexOrDecimal64      `json:"currentShardID"`
+		Period     math.HexOrDecimal64      `json:"currentPeriod"`
 	}
 	var enc stEnv
 	enc.Coinbase = common.UnprefixedAddress(s.Coinbase)
@@ -27,6 +29,8 @@ func (s stEnv) MarshalJSON() ([]byte, error) {
 	enc.GasLimit = math.HexOrDecimal64(s.GasLimit)
 	enc.Number = math.HexOrDecimal64(s.Number)
 	enc.Timestamp = math.HexOrDecimal64(s.Timestamp)
+	enc.ShardID = math.HexOrDecimal64(s.ShardID)
+	enc.Period = math.HexOrDecimal64(s.Period)
 	return json.Marshal(&enc)
 }
 
@@ -37,6 +41,8 @@ func (s *stEnv) UnmarshalJSON(input []byte) error {
 		GasLimit   *math.HexOrDecimal64      `json:"currentGasLimit"   gencodec:"required"`
 		Number     *math.HexOrDecimal64      `json:"currentNumber"     gencodec:"required"`
 		Timestamp  *math.HexOrDecimal64      `json:"currentTimestamp"  gencodec:"required"`
+		ShardID    *math.HexOrDecimal64      `json:"currentShardID"`
+		Period     *math.HexOrDecimal64      `json:"currentPeriod"`
 	}
 	var dec stEnv
 	if err := json.Unmarshal(input, &dec); err != nil {
@@ -62,5 +68,11 @@ func (s *stEnv) UnmarshalJSON(input []byte) error {
 		return errors.New("missing required field 'currentTimestamp' for stEnv")
 	}
 	s.Timestamp = uint64(*dec.Timestamp)
+	if dec.ShardID != nil {
+		s.ShardID = uint64(*dec.ShardID)
+	}
+	if dec.Period != nil {
+		s.Period = uint64(*dec.Period)
+	}
 	return nil
 }
@@ -40,6 +40,10 @@ var (
 	vmTestDir          = filepath.Join(baseDir, "VMTests")
 	rlpTestDir         = filepath.Join(baseDir, "RLPTests")
 	difficultyTestDir  = filepath.Join(baseDir, "BasicTests")
+
+	// Tests of the sharding rules live in the repository itself, as they are not
+	// part of the upstream test suite.
+	shardingStateTestDir = filepath.Join(".", "sharding")
 )
 
 func readJson(reader io.Reader, value interface{}) error {